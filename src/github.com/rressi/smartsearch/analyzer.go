@@ -0,0 +1,488 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/text/language"
+	"io"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// A filter applied by an Analyzer to the text before splitting it in tokens,
+// for example to strip some markup. A Normalizer is a CharFilter as well.
+//
+// It must be safe for concurrent use.
+type CharFilter interface {
+	Apply(text string) (result string)
+}
+
+// A filter applied by an Analyzer to the tokens of a text, in their original
+// order: it can change, remove or add tokens, for example to remove stop
+// words or to reduce words to their stem.
+//
+// It must be safe for concurrent use, and it can modify the given slice.
+type TokenFilter interface {
+	Apply(tokens []string) (result []string)
+}
+
+// A function used as a CharFilter.
+type CharFilterFunc func(text string) (result string)
+
+// Implementation of CharFilter.Apply.
+func (f CharFilterFunc) Apply(text string) (result string) {
+	return f(text)
+}
+
+// A function used as a TokenFilter.
+type TokenFilterFunc func(tokens []string) (result []string)
+
+// Implementation of TokenFilter.Apply.
+func (f TokenFilterFunc) Apply(tokens []string) (result []string) {
+	return f(tokens)
+}
+
+// An Analyzer turns a text into the terms to be indexed or searched: the text
+// goes through its char filters, is split in tokens by its tokenizer and then
+// the tokens go through its token filters.
+//
+// An Analyzer is a Tokenizer itself, so that the same one can be given to
+// NewIndexBuilderWithAnalyzer and to NewIndexWithAnalyzer: an index has to be
+// searched with the analyzer it has been built with.
+//
+// Its configuration is stored in the index by IndexBuilder, so that NewIndex
+// can create the same analyzer again if it has been registered (see
+// RegisterAnalyzer).
+//
+// It is safe for concurrent use as long as its components are and as long
+// as it is not modified.
+type Analyzer struct {
+	Config       AnalyzerConfig // Name, version and options, if registered.
+	CharFilters  []CharFilter   // Applied to the text, in order.
+	Tokenizer    Tokenizer      // It splits the text in tokens, not nil.
+	TokenFilters []TokenFilter  // Applied to the tokens, in order.
+}
+
+// The configuration of an Analyzer: enough to create it again, once its
+// factory has been registered with RegisterAnalyzer.
+type AnalyzerConfig struct {
+	Name    string            // Name of the analyzer, empty if unregistered.
+	Version int               // Version, increased at each change of terms.
+	Options map[string]string // Options of the analyzer, if any.
+}
+
+// A function creating the Analyzer with the given configuration.
+//
+// It returns:
+// - the newly created analyzer.
+// - UnknownAnalyzerError if the version or the options are not supported.
+type AnalyzerFactory func(config AnalyzerConfig) (analyzer *Analyzer,
+	err error)
+
+// Name and version of the analyzer returned by DefaultAnalyzer, its version
+// is the one of its normalizer. Indices built with older versions are still
+// searched with the older normalizer.
+const (
+	DefaultAnalyzerName    = "default"
+	DefaultAnalyzerVersion = normalizerVersion
+)
+
+// This error is returned when an index has been built with an analyzer that
+// has not been registered, or with a version or options that its factory
+// does not support.
+type UnknownAnalyzerError struct {
+	Config AnalyzerConfig // Configuration of the analyzer.
+}
+
+// Implementation of error.
+func (e UnknownAnalyzerError) Error() string {
+	return fmt.Sprintf("Unknown analyzer '%v' version %v with options %v",
+		e.Config.Name, e.Config.Version, e.Config.Options)
+}
+
+// This error is returned when an index is loaded with an analyzer that is
+// not the one it has been built with.
+type AnalyzerMismatchError struct {
+	Index    AnalyzerConfig // The analyzer used to build the index.
+	Analyzer AnalyzerConfig // The analyzer given to load it.
+}
+
+// Implementation of error.
+func (e AnalyzerMismatchError) Error() string {
+	return fmt.Sprintf("Index built with analyzer '%v' version %v, not '%v'"+
+		" version %v", e.Index.Name, e.Index.Version, e.Analyzer.Name,
+		e.Analyzer.Version)
+}
+
+// Registered analyzer factories, by name.
+var analyzerFactories = struct {
+	sync.RWMutex
+	byName map[string]AnalyzerFactory
+}{byName: map[string]AnalyzerFactory{
+	DefaultAnalyzerName: newDefaultAnalyzer}}
+
+// It registers the factory of the analyzers with the given name, so that
+// indices built with them can be loaded by NewIndex, NewIndexFromFile and
+// NewIndexFromReaderAt. A factory registered with the same name is replaced.
+//
+// The analyzers created by the factory must have the given name in their
+// configuration.
+func RegisterAnalyzer(name string, factory AnalyzerFactory) {
+	analyzerFactories.Lock()
+	defer analyzerFactories.Unlock()
+	analyzerFactories.byName[name] = factory
+}
+
+// It creates the Analyzer with the given configuration with its registered
+// factory.
+//
+// It returns:
+// - the newly created analyzer.
+// - UnknownAnalyzerError if there is no such analyzer.
+func NewAnalyzerFromConfig(config AnalyzerConfig) (analyzer *Analyzer,
+	err error) {
+
+	analyzerFactories.RLock()
+	factory, ok := analyzerFactories.byName[config.Name]
+	analyzerFactories.RUnlock()
+	if !ok {
+		err = UnknownAnalyzerError{config}
+		return
+	}
+
+	analyzer, err = factory(config)
+	return
+}
+
+// It creates an Analyzer with the given components.
+func NewAnalyzer(charFilters []CharFilter, tokenizer Tokenizer,
+	tokenFilters []TokenFilter) *Analyzer {
+
+	return &Analyzer{
+		CharFilters:  charFilters,
+		Tokenizer:    tokenizer,
+		TokenFilters: tokenFilters}
+}
+
+// It creates the Analyzer used when none is given: no filters and the
+// tokenizer returned by NewTokenizer.
+func DefaultAnalyzer() *Analyzer {
+	return newDefaultAnalyzerWithOptions(normalizationOptions{
+		version: DefaultAnalyzerVersion})
+}
+
+// Option of the default analyzer with the language of the documents (see
+// LanguageAnalyzer).
+const languageOption = "language"
+
+// It creates an Analyzer like DefaultAnalyzer but normalizing the text with
+// the rules of the given language (see NewNormalizerWithLanguage).
+//
+// Its configuration is the one of the default analyzer with the language as
+// option, so that NewIndex creates it again for the indices built with it.
+func LanguageAnalyzer(tag language.Tag) *Analyzer {
+	return newDefaultAnalyzerWithOptions(normalizationOptions{
+		version:      DefaultAnalyzerVersion,
+		language:     tag,
+		withLanguage: true})
+}
+
+// It creates the default analyzer normalizing the text with the given
+// options, its version is the one of the normalization.
+func newDefaultAnalyzerWithOptions(options normalizationOptions) *Analyzer {
+	normalizer := newNormalizer(options)
+	analyzer := NewAnalyzer(nil, NewTokenizerWithNormalizer(normalizer), nil)
+	analyzer.Config = AnalyzerConfig{
+		Name:    DefaultAnalyzerName,
+		Version: options.version}
+	if options.withLanguage {
+		analyzer.Config.Options = map[string]string{
+			languageOption: options.language.String()}
+	}
+	return analyzer
+}
+
+// Factory of the analyzers returned by DefaultAnalyzer and LanguageAnalyzer.
+func newDefaultAnalyzer(config AnalyzerConfig) (analyzer *Analyzer,
+	err error) {
+
+	// Only the first version, used by the indices built before, and the
+	// current one have been released. Languages came after the first one:
+	value, withLanguage := config.Options[languageOption]
+	if (config.Version != 1 && config.Version != DefaultAnalyzerVersion) ||
+		(withLanguage && config.Version == 1) ||
+		(withLanguage && len(config.Options) > 1) ||
+		(!withLanguage && len(config.Options) > 0) {
+		err = UnknownAnalyzerError{config}
+		return
+	}
+
+	options := normalizationOptions{version: config.Version}
+	if withLanguage {
+		var err_ error
+		options.language, err_ = language.Parse(value)
+		if err_ != nil {
+			err = UnknownAnalyzerError{config}
+			return
+		}
+		options.withLanguage = true
+	}
+
+	analyzer = newDefaultAnalyzerWithOptions(options)
+	return
+}
+
+// Implementation of Tokenizer.Apply.
+func (a *Analyzer) Apply(text string) (tokens []string) {
+	tokens = a.Tokenizer.Apply(a.filterText(text))
+	tokens = a.filterTokens(tokens)
+	return
+}
+
+// Implementation of Tokenizer.ForSearch.
+//
+// The token filters are applied to the complete tokens and, apart, to the
+// potentially incomplete one: if they remove it there is no incomplete token,
+// if they expand it in many tokens only the last one is incomplete.
+func (a *Analyzer) ForSearch(query string) (tokens []string,
+	incompleteToken string) {
+
+	var tokens_ []string
+	var incompleteToken_ string
+	tokens_, incompleteToken_ = a.Tokenizer.ForSearch(a.filterText(query))
+	if len(a.TokenFilters) == 0 {
+		tokens, incompleteToken = tokens_, incompleteToken_
+		return
+	}
+
+	tokens_ = a.filterTokens(tokens_)
+	if incompleteToken_ != "" {
+		incompleteTokens := a.filterTokens([]string{incompleteToken_})
+		if n := len(incompleteTokens); n > 0 {
+			tokens_ = append(tokens_, incompleteTokens[:n-1]...)
+			incompleteToken_ = incompleteTokens[n-1]
+		} else {
+			incompleteToken_ = ""
+		}
+	}
+
+	tokens = sortDedupTokens(tokens_)
+	incompleteToken = incompleteToken_
+	return
+}
+
+// It applies the char filters to the given text.
+func (a *Analyzer) filterText(text string) (result string) {
+	result = text
+	for _, filter := range a.CharFilters {
+		result = filter.Apply(result)
+	}
+	return
+}
+
+// It applies the token filters to the given tokens, dropping the empty ones
+// they may leave.
+func (a *Analyzer) filterTokens(tokens []string) (result []string) {
+
+	result = tokens
+	if len(a.TokenFilters) == 0 {
+		return
+	}
+
+	for _, filter := range a.TokenFilters {
+		result = filter.Apply(result)
+	}
+
+	var nonEmpty []string
+	for _, token := range result {
+		if token != "" {
+			nonEmpty = append(nonEmpty, token)
+		}
+	}
+	result = nonEmpty
+	return
+}
+
+// It encodes the configuration of an analyzer, as stored in an index with
+// FeatureAnalyzer.
+//
+// Encoding is composed by the name, the version and the number of options
+// followed by, for each option sorted by key, the key and the value. Name,
+// keys and values are preceded by their length in bytes (all Uvarint).
+//
+// It returns:
+// - the encoded bytes.
+func EncodeAnalyzerConfig(config AnalyzerConfig) []byte {
+
+	buf := new(bytes.Buffer)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(value int) {
+		numBytes := binary.PutUvarint(tmp, uint64(value))
+		buf.Write(tmp[:numBytes])
+	}
+	writeString := func(value string) {
+		writeUvarint(len(value))
+		buf.WriteString(value)
+	}
+
+	writeString(config.Name)
+	writeUvarint(config.Version)
+	writeUvarint(len(config.Options))
+
+	var keys []string
+	for key := range config.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeString(key)
+		writeString(config.Options[key])
+	}
+
+	return buf.Bytes()
+}
+
+// It decodes the configuration of an analyzer previously encoded by
+// EncodeAnalyzerConfig.
+//
+// It returns:
+// - the configuration of the analyzer.
+// - an error in case of failure.
+func DecodeAnalyzerConfig(src []byte) (config AnalyzerConfig, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("DecodeAnalyzerConfig: %v", err)
+		}
+	}()
+
+	reader := bytes.NewReader(src)
+	readString := func() (value string, err error) {
+		var size uint64
+		size, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return
+		} else if size > uint64(reader.Len()) {
+			err = fmt.Errorf("invalid size of string %v", size)
+			return
+		}
+		value_ := make([]byte, int(size))
+		_, err = io.ReadFull(reader, value_)
+		if err == nil && !utf8.Valid(value_) {
+			err = fmt.Errorf("invalid string %q", value_)
+		}
+		value = string(value_)
+		return
+	}
+
+	var config_ AnalyzerConfig
+	config_.Name, err = readString()
+	if err != nil {
+		return
+	}
+
+	var version, count uint64
+	version, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return
+	} else if version > uint64(maxHandleValue) {
+		err = fmt.Errorf("invalid version %v", version)
+		return
+	}
+	config_.Version = int(version)
+
+	count, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return
+	} else if count > uint64(reader.Len()) {
+		err = fmt.Errorf("invalid number of options %v", count)
+		return
+	}
+	for i := 0; i < int(count); i++ {
+		var key, value string
+		key, err = readString()
+		if err == nil {
+			value, err = readString()
+		}
+		if err != nil {
+			return
+		}
+		if config_.Options == nil {
+			config_.Options = make(map[string]string, int(count))
+		}
+		config_.Options[key] = value
+	}
+
+	if reader.Len() > 0 {
+		err = fmt.Errorf("%v trailing bytes", reader.Len())
+		return
+	}
+
+	config = config_
+	return
+}
+
+// It decodes the configuration of the analyzer used to build the index, as
+// stored by IndexBuilder with FeatureAnalyzer.
+//
+// Indices without it have been built before the feature existed, with the
+// first version of the default analyzer (see DefaultAnalyzer).
+//
+// It returns:
+// - the configuration of the analyzer.
+// - an error in case of failure.
+func (t *Trie) ReadAnalyzerConfig() (config AnalyzerConfig, err error) {
+
+	offset, size, ok := t.header.Section(FeatureAnalyzer)
+	if !ok {
+		config = AnalyzerConfig{Name: DefaultAnalyzerName, Version: 1}
+		return
+	}
+
+	var bytes_ []byte
+	bytes_, err = t.source.ReadRange(offset, size)
+	if err == nil {
+		config, err = DecodeAnalyzerConfig(bytes_)
+	}
+	if err != nil {
+		err = fmt.Errorf("Trie.ReadAnalyzerConfig: %w", err)
+	}
+	return
+}
+
+// It returns the analyzer to search the given trie: the given one, if it is
+// the one used to build the index, or the one created from the configuration
+// stored in the index if none is given.
+//
+// It returns:
+// - the analyzer.
+// - AnalyzerMismatchError if the given analyzer is not the one of the index.
+// - UnknownAnalyzerError if the analyzer of the index is not registered.
+// - an error in case of failure.
+func analyzerFor(trie *Trie, analyzer *Analyzer) (result *Analyzer,
+	err error) {
+
+	var config AnalyzerConfig
+	config, err = trie.ReadAnalyzerConfig()
+	if err != nil {
+		return
+	}
+
+	if analyzer == nil {
+		result, err = NewAnalyzerFromConfig(config)
+		return
+	}
+
+	// An index built with an unregistered analyzer can be searched with any
+	// analyzer, there is nothing to compare:
+	if config.Name != "" && !bytes.Equal(EncodeAnalyzerConfig(config),
+		EncodeAnalyzerConfig(analyzer.Config)) {
+		err = AnalyzerMismatchError{config, analyzer.Config}
+		return
+	}
+
+	result = analyzer
+	return
+}
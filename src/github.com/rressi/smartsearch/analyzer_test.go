@@ -0,0 +1,385 @@
+package smartsearch
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/text/language"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// It creates an analyzer that strips the markup '<b>' and removes the stop
+// word "the".
+func newTestAnalyzer() *Analyzer {
+
+	stripMarkup := CharFilterFunc(func(text string) string {
+		return strings.NewReplacer("<b>", " ", "</b>", " ").Replace(text)
+	})
+	removeStopWords := TokenFilterFunc(func(tokens []string) []string {
+		var result []string
+		for _, token := range tokens {
+			if token != "the" {
+				result = append(result, token)
+			}
+		}
+		return result
+	})
+
+	return NewAnalyzer([]CharFilter{stripMarkup}, NewTokenizer(),
+		[]TokenFilter{removeStopWords})
+}
+
+func TestAnalyzer_Apply(t *testing.T) {
+
+	analyzer := newTestAnalyzer()
+
+	tokens := analyzer.Apply("The <b>Golden</b> Gate")
+	expected := []string{"golden", "gate"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Unexpected tokens: %v", tokens)
+	}
+
+	tokens = analyzer.Apply("the")
+	if tokens != nil {
+		t.Errorf("Unexpected tokens: %v", tokens)
+	}
+
+	// The default analyzer is the plain tokenizer:
+	tokens = DefaultAnalyzer().Apply("The <b>Golden</b> Gate")
+	expected = []string{"the", "b", "golden", "b", "gate"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Unexpected tokens: %v", tokens)
+	}
+}
+
+func TestAnalyzer_ForSearch(t *testing.T) {
+
+	analyzer := newTestAnalyzer()
+
+	tests := []struct {
+		query      string
+		tokens     []string
+		incomplete string
+	}{
+		{"the gate golden", []string{"gate"}, "golden"},
+		{"golden the gate the", []string{"gate", "golden"}, ""},
+		{"<b>golden</b>", []string{"golden"}, ""},
+		{"golden the", []string{"golden"}, ""},
+		{"the", nil, ""},
+		{"", nil, ""}}
+	for _, test := range tests {
+		tokens, incomplete := analyzer.ForSearch(test.query)
+		if !reflect.DeepEqual(tokens, test.tokens) ||
+			incomplete != test.incomplete {
+			t.Errorf("Unexpected tokens for '%v': %v '%v'", test.query,
+				tokens, incomplete)
+		}
+	}
+}
+
+func TestAnalyzer_Index(t *testing.T) {
+
+	analyzer := newTestAnalyzer()
+
+	builder := NewIndexBuilderWithAnalyzer(analyzer)
+	builder.AddDocument(1, "The <b>Golden</b> Gate")
+	builder.AddDocument(2, "Another gate")
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot dump index: %v", err)
+	}
+
+	index, _, err := NewIndexWithAnalyzer(buf, analyzer)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"the gate", []int{1, 2}},
+		{"b", nil},
+		{"<b>golden</b> gate", []int{1}},
+		{"\"the golden gate\"", []int{1}}}
+	for _, test := range tests {
+		postings, err := index.Search(test.query, -1)
+		if err != nil {
+			t.Errorf("Search '%v' failed: %v", test.query, err)
+		} else if !reflect.DeepEqual(postings, test.expected) {
+			t.Errorf("Unexpected postings for '%v': %v", test.query,
+				postings)
+		}
+	}
+}
+
+func TestAnalyzer_Config(t *testing.T) {
+
+	configs := []AnalyzerConfig{
+		{Name: DefaultAnalyzerName, Version: DefaultAnalyzerVersion},
+		{Name: "custom", Version: 3, Options: map[string]string{
+			"stopwords": "the a", "language": "en"}},
+		{}}
+	for _, config := range configs {
+		encoded := EncodeAnalyzerConfig(config)
+		decoded, err := DecodeAnalyzerConfig(encoded)
+		if err != nil {
+			t.Errorf("Cannot decode %+v: %v", config, err)
+		} else if !reflect.DeepEqual(decoded, config) {
+			t.Errorf("Unexpected config: %+v", decoded)
+		}
+
+		_, err = DecodeAnalyzerConfig(encoded[:len(encoded)-1])
+		if err == nil {
+			t.Errorf("Truncated config %+v should fail", config)
+		}
+		_, err = DecodeAnalyzerConfig(append(encoded, 0))
+		if err == nil {
+			t.Errorf("Config %+v with trailing bytes should fail", config)
+		}
+	}
+
+	for _, version := range []int{0, 2, 3, DefaultAnalyzerVersion + 1} {
+		_, err := NewAnalyzerFromConfig(AnalyzerConfig{
+			Name: DefaultAnalyzerName, Version: version})
+		if !errors.As(err, new(UnknownAnalyzerError)) {
+			t.Errorf("UnknownAnalyzerError was expected for version %v: %v",
+				version, err)
+		}
+	}
+}
+
+// It builds an index of few documents with the given analyzer.
+func newAnalyzerTestIndex(t *testing.T, analyzer *Analyzer) []byte {
+
+	builder := NewIndexBuilderWithAnalyzer(analyzer)
+	builder.AddDocument(1, "The <b>Golden</b> Gate")
+	builder.AddDocument(2, "Another gate")
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot dump index: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyzer_Registered(t *testing.T) {
+
+	config := AnalyzerConfig{Name: "test-analyzer", Version: 1}
+	RegisterAnalyzer(config.Name, func(config_ AnalyzerConfig) (
+		analyzer *Analyzer, err error) {
+		if config_.Version != config.Version {
+			err = UnknownAnalyzerError{config_}
+			return
+		}
+		analyzer = newTestAnalyzer()
+		analyzer.Config = config
+		return
+	})
+	analyzer, err := NewAnalyzerFromConfig(config)
+	if err != nil {
+		t.Fatalf("Cannot create analyzer: %v", err)
+	}
+	raw := newAnalyzerTestIndex(t, analyzer)
+
+	// The index is searched with its own analyzer, that removes "the":
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	postings, err := index.Search("the gate", -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+		t.Errorf("Unexpected postings: %v %v", postings, err)
+	}
+
+	index, err = NewIndexFromReaderAt(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	postings, err = index.Search("<b>golden</b>", -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{1}) {
+		t.Errorf("Unexpected postings: %v %v", postings, err)
+	}
+
+	// Another analyzer is refused:
+	_, _, err = NewIndexWithAnalyzer(bytes.NewReader(raw), DefaultAnalyzer())
+	if !errors.As(err, new(AnalyzerMismatchError)) {
+		t.Errorf("AnalyzerMismatchError was expected: %v", err)
+	}
+}
+
+func TestAnalyzer_Unregistered(t *testing.T) {
+
+	raw := newAnalyzerTestIndex(t, newTestAnalyzer())
+
+	_, _, err := NewIndex(bytes.NewReader(raw))
+	if !errors.As(err, new(UnknownAnalyzerError)) {
+		t.Errorf("UnknownAnalyzerError was expected: %v", err)
+	}
+
+	// The same index with the analyzer it has been built with:
+	index, _, err := NewIndexWithAnalyzer(bytes.NewReader(raw),
+		newTestAnalyzer())
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	postings, err := index.Search("the gate", -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+		t.Errorf("Unexpected postings: %v %v", postings, err)
+	}
+}
+
+func TestAnalyzer_WithoutConfig(t *testing.T) {
+
+	// An index built before FeatureAnalyzer, with the default analyzer:
+	builder := NewTrieBuilder()
+	builder.Add(1, "golden")
+	trieBytes := new(bytes.Buffer)
+	builder.Dump(trieBytes)
+	buf := new(bytes.Buffer)
+	WriteIndex(buf, builder.Features(), nil, trieBytes.Bytes())
+
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	config, err := trie.ReadAnalyzerConfig()
+	expected := AnalyzerConfig{Name: DefaultAnalyzerName, Version: 1}
+	if err != nil || !reflect.DeepEqual(config, expected) {
+		t.Errorf("Unexpected config: %+v %v", config, err)
+	}
+
+	index, _, err := NewIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	postings, err := index.Search("GOLD", -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{1}) {
+		t.Errorf("Unexpected postings: %v %v", postings, err)
+	}
+}
+
+func TestAnalyzer_Language(t *testing.T) {
+
+	analyzer := LanguageAnalyzer(language.Turkish)
+	builder := NewIndexBuilderWithAnalyzer(analyzer)
+	builder.AddDocument(1, "IŞIK")
+	builder.AddDocument(2, "ışık")
+	builder.AddDocument(3, "isik")
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot dump index: %v", err)
+	}
+
+	// The index is searched with the Turkish analyzer:
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	for _, query := range []string{"IŞIK ", "ışık "} {
+		postings, err := index.Search(query, -1)
+		if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+			t.Errorf("Unexpected postings for %q: %v %v", query, postings,
+				err)
+		}
+	}
+
+	_, err = NewAnalyzerFromConfig(AnalyzerConfig{
+		Name:    DefaultAnalyzerName,
+		Version: DefaultAnalyzerVersion,
+		Options: map[string]string{"language": "not a language"}})
+	if !errors.As(err, new(UnknownAnalyzerError)) {
+		t.Errorf("UnknownAnalyzerError was expected: %v", err)
+	}
+
+	// The first version had no languages:
+	_, err = NewAnalyzerFromConfig(AnalyzerConfig{
+		Name:    DefaultAnalyzerName,
+		Version: 1,
+		Options: map[string]string{"language": "tr"}})
+	if !errors.As(err, new(UnknownAnalyzerError)) {
+		t.Errorf("UnknownAnalyzerError was expected: %v", err)
+	}
+}
+
+func TestAnalyzer_GreekLanguage(t *testing.T) {
+
+	builder := NewIndexBuilderWithAnalyzer(LanguageAnalyzer(language.Greek))
+	builder.AddDocument(1, "Η ΟΔΟΣ ΤΗΣ ΣΟΦΙΑΣ")
+	builder.AddDocument(2, "ΟΔΟΙ")
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot dump index: %v", err)
+	}
+
+	// Lower-case queries, with the final sigma:
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	for _, query := range []string{"οδος ", "σοφιας ", "ΟΔΟΣ ", "οδο"} {
+		postings, err := index.Search(query, -1)
+		expected := []int{1}
+		if query == "οδο" {
+			expected = []int{1, 2}
+		}
+		if err != nil || !reflect.DeepEqual(postings, expected) {
+			t.Errorf("Unexpected postings for %q: %v %v", query, postings,
+				err)
+		}
+	}
+}
+
+func TestAnalyzer_ManyLanguages(t *testing.T) {
+
+	// Documents in many languages, lower-cased with the rules of their
+	// language and indexed with the default analyzer:
+	source := strings.NewReader(
+		"{\"id\":1, \"title\":\"Η ΟΔΟΣ ΤΗΣ ΣΟΦΙΑΣ\", \"lang\":\"el\"}\n" +
+			"{\"id\":2, \"title\":\"IŞIK\", \"lang\":\"tr\"}\n" +
+			"{\"id\":3, \"title\":\"ışık yolu\", \"lang\":\"tr\"}\n" +
+			"{\"id\":4, \"title\":\"İstanbul\", \"lang\":\"tr\"}\n")
+	builder := NewIndexBuilder()
+	defer builder.Abort()
+	builder.SetJsonLanguageField("lang")
+	_, err := builder.IndexJsonStream(source, "id", []string{"title"})
+	if err != nil {
+		t.Fatalf("Cannot index documents: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	err = builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot dump index: %v", err)
+	}
+
+	// Queries are typed in any case, with or without the letters of the
+	// language:
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	tests := []struct {
+		query    string
+		postings []int
+	}{
+		{"οδος ", []int{1}},
+		{"σοφιας ", []int{1}},
+		{"ΟΔΟΣ ", []int{1}},
+		{"IŞIK ", []int{2, 3}},
+		{"ışık ", []int{2, 3}},
+		{"isik", []int{2, 3}},
+		{"ISIK ", []int{2, 3}},
+		{"istanbul ", []int{4}},
+		{"İSTANBUL ", []int{4}}}
+	for _, test := range tests {
+		postings, err := index.Search(test.query, -1)
+		if err != nil || !reflect.DeepEqual(postings, test.postings) {
+			t.Errorf("Unexpected postings for %q: %v %v", test.query,
+				postings, err)
+		}
+	}
+}
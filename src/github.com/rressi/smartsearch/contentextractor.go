@@ -3,6 +3,8 @@ package smartsearch
 import (
 	"encoding/json"
 	"fmt"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
 	"strconv"
 	"strings"
 )
@@ -10,10 +12,63 @@ import (
 // A function to preprocess content in the slave threads
 type ContentExtractor func(raw []byte) (id int, content string, err error)
 
+// A function to preprocess content made of many fields in the slave threads.
+type FieldsExtractor func(raw []byte) (id int, fields []Field, err error)
+
+// It creates a ContentExtractor for JSON documents, the content is made of the
+// values of the given fields joined by a space.
 func MakeJsonExtractor(idField string,
 	contentFields []string) ContentExtractor {
+	return MakeJsonExtractorWithLanguage(idField, contentFields, "")
+}
+
+// Like MakeJsonExtractor but the content of each document is lower-cased with
+// the rules of the language found in the given field, like "tr" or "el", so
+// that for example the Turkish "IŞIK" becomes "ışık" and not "işik".
+//
+// Only the case is changed, the content is still to be analyzed: the default
+// analyzer folds the letters whose lower case depends on the language, so
+// that queries match these documents whatever their language (see
+// normalizerVersion).
+//
+// The content of documents without the field, or with a language that is not
+// valid, is left as it is. The field is ignored if empty.
+func MakeJsonExtractorWithLanguage(idField string, contentFields []string,
+	languageField string) ContentExtractor {
+	fieldsExtractor := MakeJsonFieldsExtractorWithLanguage(idField,
+		contentFields, languageField)
 	return func(jsonDocument []byte) (id int, content string, err error) {
 
+		var fields []Field
+		id, fields, err = fieldsExtractor(jsonDocument)
+		if err != nil {
+			id = 0
+			return
+		}
+
+		parsedContent := make([]string, len(fields))
+		for i, field := range fields {
+			parsedContent[i] = field.Content
+		}
+		content = strings.Join(parsedContent, " ")
+		return
+	}
+}
+
+// It creates a FieldsExtractor for JSON documents, each one of the given
+// fields found in a document becomes one of its fields.
+func MakeJsonFieldsExtractor(idField string,
+	contentFields []string) FieldsExtractor {
+	return MakeJsonFieldsExtractorWithLanguage(idField, contentFields, "")
+}
+
+// Like MakeJsonFieldsExtractor but the content of each field is lower-cased
+// with the rules of the language found in the given field (see
+// MakeJsonExtractorWithLanguage).
+func MakeJsonFieldsExtractorWithLanguage(idField string,
+	contentFields []string, languageField string) FieldsExtractor {
+	return func(jsonDocument []byte) (id int, fields []Field, err error) {
+
 		var datum map[string]interface{}
 		err = json.Unmarshal(jsonDocument, &datum)
 		if err != nil {
@@ -43,21 +98,56 @@ func MakeJsonExtractor(idField string,
 		}
 
 		// Takes all the fields to be indexed:
-		var parsedContent []string
+		var parsedFields []Field
 		for _, field := range contentFields {
 			value_, ok := datum[field]
 			if ok {
 				switch value := value_.(type) {
 				case string:
-					parsedContent = append(parsedContent, value)
+					parsedFields = append(parsedFields, Field{field, value})
 				case int:
-					parsedContent = append(parsedContent, fmt.Sprint(value))
+					parsedFields = append(parsedFields,
+						Field{field, fmt.Sprint(value)})
 				}
 			}
 		}
 
+		// Lower-cases the content with the language of the document:
+		if tag, ok := jsonLanguage(datum, languageField); ok {
+			toLowerCase := cases.Lower(tag)
+			for i := range parsedFields {
+				parsedFields[i].Content = toLowerCase.String(
+					parsedFields[i].Content)
+			}
+		}
+
 		id = parsedId
-		content = strings.Join(parsedContent, " ")
+		fields = parsedFields
 		return
 	}
 }
+
+// It returns the language found in the given field of a JSON document.
+//
+// It returns:
+// - the language.
+// - false if the field is empty, missing or not a valid language.
+func jsonLanguage(datum map[string]interface{}, languageField string) (
+	tag language.Tag, ok bool) {
+
+	if languageField == "" {
+		return
+	}
+	value, isString := datum[languageField].(string)
+	if !isString {
+		return
+	}
+
+	tag_, err := language.Parse(value)
+	if err != nil {
+		return
+	}
+
+	tag, ok = tag_, true
+	return
+}
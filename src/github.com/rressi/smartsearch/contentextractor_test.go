@@ -1,6 +1,7 @@
 package smartsearch
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -22,3 +23,45 @@ func TestContentExtractor_Base(t *testing.T) {
 		t.Errorf("Unexpected content: '%v'", content)
 	}
 }
+
+func TestContentExtractor_Fields(t *testing.T) {
+	source := "{\"id\":\"10\", " +
+		"\"title\":\"some title\", " +
+		"\"content\":\"some content\", " +
+		"\"extra\":[1, 2, 3]}"
+	expected_fields := []Field{
+		{"title", "some title"},
+		{"content", "some content"}}
+
+	jsonExtractor := MakeJsonFieldsExtractor("id", []string{"title",
+		"content", "extra", "missing"})
+	id, fields, err := jsonExtractor([]byte(source))
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	} else if id != 10 {
+		t.Errorf("Invalid id: %v", id)
+	} else if !reflect.DeepEqual(fields, expected_fields) {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+}
+
+func TestContentExtractor_Language(t *testing.T) {
+
+	jsonExtractor := MakeJsonExtractorWithLanguage("id", []string{"title"},
+		"lang")
+
+	sources := []string{
+		"{\"id\":1, \"title\":\"IŞIK\", \"lang\":\"tr\"}",
+		"{\"id\":2, \"title\":\"IŞIK\", \"lang\":\"en\"}",
+		"{\"id\":3, \"title\":\"IŞIK\"}",
+		"{\"id\":4, \"title\":\"IŞIK\", \"lang\":\"not a language\"}"}
+	expected := []string{"ışık", "işik", "IŞIK", "IŞIK"}
+	for i, source := range sources {
+		_, content, err := jsonExtractor([]byte(source))
+		if err != nil {
+			t.Errorf("Failed: %v", err)
+		} else if content != expected[i] {
+			t.Errorf("Unexpected content: '%v'", content)
+		}
+	}
+}
@@ -0,0 +1,1357 @@
+package smartsearch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// It represents a trie edge as it have been decoded by a Cursor.
+//
+// Like a Node it can be stored, marshaled and used later with any cursor of
+// the same trie, as long as its 32-bit identity tells so (see Trie.Identity).
+//
+// With FeatureRadixEdges an edge can be labeled with many runes: Rune is the
+// first one and Suffix contains all the others.
+type Edge struct {
+	Rune       rune   // UNICODE code point associated with this edge
+	Suffix     string // Other runes of the label (FeatureRadixEdges).
+	nodeOffset int     // Byte offset of the target node of this edge
+	trie       trieTag // Trie of the edge.
+}
+
+// It represents a trie node as it have been decoded by a Cursor.
+//
+// The content of this structure can be stored for later usage and given one
+// binary index nodes are universally consistent. They can be marshaled (see
+// MarshalBinary, MarshalJSON) and stored on files or passed between different
+// services without problems: they are tagged with the identity of their trie,
+// so that method JumpNode refuses the nodes of any other trie. The identity is
+// a 32-bit CRC of the trie with its size (see Trie.Identity): it protects from
+// mistakes, not from forged nodes.
+//
+// With FeatureRadixEdges a term can end in the middle of the label of an edge
+// (see Cursor.Match): the node is then a virtual one, without postings and
+// with a single edge labeled with the rest of the label.
+type Node struct {
+	NumPostings    int    // Number of postings contained by the node
+	NumEdges       int    // Number of edges departing from this node
+	Occurrences    int    // Total occurrences of the term (FeatureFrequencies)
+	postingsOffset int    // Byte offset of the list of postings.
+	edgesOffset    int    // Byte offset of the list of edges.
+	label          string  // Rest of the label of a virtual node.
+	trie           trieTag // Trie of the node.
+}
+
+// It returns the virtual node in the middle of the given edge, from which the
+// given rest of its label leads to the target node of the edge.
+func midEdgeNode(edge Edge, label string) Node {
+	return Node{
+		NumEdges:       1,
+		postingsOffset: edge.nodeOffset,
+		edgesOffset:    edge.nodeOffset,
+		label:          label,
+		trie:           edge.trie}
+}
+
+// This error is returned when a passed offset is invalid.
+var OutOfBounds = errors.New("Offset out of bound")
+
+// This error is returned when a passed node or edge comes from another trie.
+var ForeignHandle = errors.New("Node or edge of another trie")
+
+// A cursor traversing one Trie, it contains only the state of the traversal.
+//
+// It can be cloned in order to have two state machines decoding and traversing
+// the trie from the current position. Clones are completely independent.
+//
+// A Cursor is not safe for concurrent use, each goroutine needs its own one
+// (see Trie.Root) or its own clone.
+//
+// Cursors are working as state machines that decode lazily the bytes while
+// traversing the trie. No up-front decoding of postings and edges is
+// performed.
+//
+// They can jump to one state to another to save CPU resources (methods
+// JumpNode, EnterNode).
+type Cursor struct {
+	trie               *Trie
+	reader             trieSource
+	postingsLeft       int
+	edgesLeft          int
+	edgesOffset        int
+	childrenBaseOffset int
+	posting            int
+	frequency          int
+	numPositions       int
+	positionsOffset    int
+	rune_              int
+	numPostings        int    // Postings of the current node.
+	skipsOffset        int    // Offset of the next skip entry (see SkipTo).
+	skipsLeft          int    // Skip entries not read yet.
+	skipPosting        int    // Last posting before the block of skipBlock.
+	skipBlockOffset    int    // Offset of the block of skipBlock.
+	skipBlock          int    // Block of the last read skip entry.
+	container          int    // Container of the postings (postingsDeltas...).
+	containerOffset    int    // Offset of the next byte of the container.
+	containerWord      int    // Bits not read yet, or postings left in the run.
+	containerBase      int    // Posting of the first bit of containerWord.
+	label              string // Label of the edge of a virtual node.
+	numEdges           int    // Edges of the current node.
+
+	// Cache of the nodes of matchTerm, only for the cursors of an Index.
+	nodes *nodeCache
+}
+
+// The name TrieReader is kept for the code written before the split between
+// Trie and Cursor.
+//
+// Deprecated: use Cursor.
+type TrieReader = Cursor
+
+// It creates a new Trie from the given bytes (see NewTrie) and returns a
+// cursor on its root node.
+//
+// Deprecated: use NewTrie and Trie.Root.
+func NewTrieReader(bytes_ []byte) (trieReader *TrieReader, node Node,
+	err error) {
+
+	var trie *Trie
+	trie, err = NewTrie(bytes_)
+	if err == nil {
+		trieReader, node = trie.Root()
+	}
+	return
+}
+
+// It creates a new Trie from the given io.ReaderAt (see NewTrieAt) and returns
+// a cursor on its root node.
+//
+// Deprecated: use NewTrieAt and Trie.Root.
+func NewTrieReaderAt(src io.ReaderAt, size int64) (trieReader *TrieReader,
+	node Node, err error) {
+
+	var trie *Trie
+	trie, err = NewTrieAt(src, size)
+	if err == nil {
+		trieReader, node = trie.Root()
+	}
+	return
+}
+
+// It returns the trie this cursor is traversing.
+func (c *Cursor) Trie() *Trie {
+	return c.trie
+}
+
+// It returns the header of the index this cursor is traversing (see
+// Trie.Header).
+func (c *Cursor) Header() IndexHeader {
+	return c.trie.header
+}
+
+// It resets the state of this cursor so that it restarts from the root node.
+//
+// It is equivalent to get a new cursor with Trie.Root.
+//
+// It returns:
+// - information about the root node.
+// - an error in case of failure.
+func (c *Cursor) Reset() (_ Node, _ error) {
+	c.reader.offset = c.trie.rootOffset
+	return c.readNode()
+}
+
+// It returns the byte offset of the next byte to be decoded.
+func (c *Cursor) tell() (offset int) {
+	offset = c.reader.offset
+	return
+}
+
+// It sets the current Cursor in a dummy and non-recoverable state after a
+// critical failure.
+//
+// This happen only when some inconsistency is found into the input bytes.
+func (c *Cursor) clear() {
+	c.reader.offset = c.reader.size
+	c.postingsLeft = 0
+	c.edgesLeft = 0
+	c.childrenBaseOffset = 0
+	c.edgesOffset = 0
+	c.posting = 0
+	c.frequency = 0
+	c.numPositions = 0
+	c.positionsOffset = 0
+	c.rune_ = 0
+	c.numPostings = 0
+	c.skipsOffset = 0
+	c.skipsLeft = 0
+	c.skipPosting = 0
+	c.skipBlockOffset = 0
+	c.skipBlock = 0
+	c.container = postingsDeltas
+	c.containerOffset = 0
+	c.containerWord = 0
+	c.containerBase = 0
+	c.label = ""
+	c.numEdges = 0
+}
+
+// It sets the offset of the next byte to be decoded.
+//
+// It returns:
+// - an error in case of failure.
+func (c *Cursor) seek(offset int) (err error) {
+
+	if offset <= c.trie.rootOffset || offset > c.reader.size {
+		err = OutOfBounds
+	} else {
+		c.reader.offset = offset
+	}
+
+	return
+}
+
+// It decodes one integer using Uvarint format.
+//
+// It returns:
+// - the decoded value.
+// - an error in case of failure.
+func (c *Cursor) readInt() (value int, err error) {
+	var value_ uint64
+	value_, err = binary.ReadUvarint(&c.reader)
+	value = int(value_)
+	return
+}
+
+// It decodes the header of one node.
+//
+// It returns:
+// - information about the decoded node.
+// - an error in case of failure.
+func (c *Cursor) readNode() (node Node, err error) {
+
+	if c.reader.Len() == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.readNode: %v", err)
+		}
+	}()
+
+	c.postingsLeft, err = c.readInt()
+	if err != nil {
+		return
+	}
+
+	c.edgesLeft, err = c.readInt()
+	if err != nil {
+		return
+	}
+	c.numEdges = c.edgesLeft
+
+	var occurrences int
+	if c.trie.header.Features&FeatureFrequencies != 0 {
+		occurrences, err = c.readInt()
+		if err != nil {
+			return
+		}
+	}
+
+	var sizeOfPosting int
+	if c.postingsLeft > 0 {
+		sizeOfPosting, err = c.readInt()
+		if err != nil {
+			return
+		}
+	}
+
+	postingsOffset := c.tell()
+	c.edgesOffset = postingsOffset + sizeOfPosting
+	c.childrenBaseOffset = 0
+	c.label = ""
+	c.posting = 0
+	c.frequency = 0
+	c.numPositions = 0
+	c.rune_ = 0
+
+	err = c.enterPostings()
+	if err != nil {
+		return
+	}
+
+	// When there are no postings we need to prepare our machine to read nodes:
+	err = c.testEndPostings()
+
+	node = Node{
+		NumPostings:    c.postingsLeft,
+		NumEdges:       c.edgesLeft,
+		Occurrences:    occurrences,
+		postingsOffset: postingsOffset,
+		edgesOffset:    c.edgesOffset,
+		trie:           trieTag{trie: c.trie}}
+	return
+}
+
+// It sets this cursor to the given node.
+//
+// It can be used to go back to a node that have already been processed. The
+// content of a node may come from a cache or some storage. It works only if
+// have been generated by a binary identical trie.
+//
+// It returns:
+// - ForeignHandle if the node comes from another trie.
+// - OutOfBounds if the node cannot fit the trie, as it can happen with a
+//   tampered node.
+// - an error in case of failure.
+func (c *Cursor) JumpNode(node Node) (err error) {
+
+	// Each posting and each edge takes at least one byte, but postings in a
+	// container without frequencies:
+	features := c.trie.header.Features
+	compact := features&FeaturePostingContainers != 0 &&
+		features&FeatureFrequencies == 0
+	var sameTrie bool
+	sameTrie, err = node.trie.belongsTo(c.trie)
+	if err != nil {
+		return
+	} else if !sameTrie {
+		err = ForeignHandle
+	} else if node.NumPostings < 0 || node.NumEdges < 0 ||
+		node.edgesOffset < node.postingsOffset ||
+		(node.NumPostings > node.edgesOffset-node.postingsOffset &&
+			!compact) ||
+		node.NumEdges > c.reader.size-node.edgesOffset {
+		err = OutOfBounds
+	} else if node.label != "" && (node.NumPostings != 0 ||
+		node.NumEdges != 1 || node.edgesOffset != node.postingsOffset) {
+		err = OutOfBounds
+	} else {
+		err = c.seek(node.postingsOffset)
+	}
+	if err != nil {
+		c.clear()
+		return
+	}
+
+	// A virtual node has just the rest of the label of its edge, that
+	// continues from the edges offset:
+	c.label = node.label
+	c.numEdges = node.NumEdges
+	if c.label != "" {
+		c.postingsLeft = 0
+		c.edgesLeft = 1
+		c.edgesOffset = node.edgesOffset
+		c.childrenBaseOffset = node.edgesOffset
+		c.numPostings = 0
+		return
+	}
+
+	c.postingsLeft = node.NumPostings
+	c.edgesLeft = node.NumEdges
+	c.edgesOffset = node.edgesOffset
+	c.childrenBaseOffset = 0
+	c.posting = 0
+	c.frequency = 0
+	c.numPositions = 0
+	c.rune_ = 0
+
+	err = c.enterPostings()
+	if err != nil {
+		c.clear()
+		return
+	}
+
+	// When there are no postings we need to prepare our machine to read nodes:
+	err = c.testEndPostings()
+
+	return
+}
+
+// It prepares the decoding of the postings of the current node, that start at
+// the current offset.
+//
+// With FeaturePostingContainers the postings start with their container, and
+// with FeatureSkipBlocks the postings of a node with many of them are
+// preceded by a table of skip entries: both are skipped, to decode the
+// frequencies and positions that follow.
+//
+// It returns:
+// - an error in case of failure.
+func (c *Cursor) enterPostings() (err error) {
+
+	c.numPostings = c.postingsLeft
+	c.skipsOffset = 0
+	c.skipsLeft = 0
+	c.container = postingsDeltas
+	c.containerWord = 0
+	c.containerBase = 0
+	if c.trie.header.Features&FeaturePostingContainers != 0 &&
+		c.postingsLeft > 0 {
+		err = c.enterContainer()
+		if err != nil {
+			return
+		}
+	}
+
+	if c.trie.header.Features&FeatureSkipBlocks != 0 &&
+		c.postingsLeft > skipBlockSize && c.container == postingsDeltas {
+
+		var sizeOfSkips int
+		sizeOfSkips, err = c.readInt()
+		if err != nil {
+			return
+		}
+
+		c.skipsOffset = c.tell()
+		c.skipsLeft = (c.postingsLeft - 1) / skipBlockSize
+		if sizeOfSkips > c.edgesOffset-c.skipsOffset {
+			err = OutOfBounds
+			return
+		}
+		err = c.seek(c.skipsOffset + sizeOfSkips)
+		if err != nil {
+			return
+		}
+	}
+
+	c.skipPosting = 0
+	c.skipBlockOffset = c.tell()
+	c.skipBlock = 0
+	return
+}
+
+// It decodes the beginning of the container of the postings of the current
+// node (see FeaturePostingContainers), leaving the cursor on the frequencies
+// and positions that follow it.
+//
+// It returns:
+// - an error in case of failure.
+func (c *Cursor) enterContainer() (err error) {
+
+	c.container, err = c.readInt()
+	if err != nil {
+		return
+	}
+
+	switch c.container {
+	case postingsDeltas:
+		return
+	case postingsBitmap:
+		var first int
+		first, err = c.readInt()
+		if err != nil {
+			return
+		}
+		c.containerBase = first - 8
+	case postingsRuns:
+	default:
+		err = fmt.Errorf("unknown container of postings %v", c.container)
+		return
+	}
+
+	var size int
+	size, err = c.readInt()
+	if err != nil {
+		return
+	}
+	c.containerOffset = c.tell()
+	if size > c.edgesOffset-c.containerOffset {
+		err = OutOfBounds
+		return
+	}
+	err = c.seek(c.containerOffset + size)
+	return
+}
+
+// It decodes the next posting from the container of the postings of the
+// current node, into c.posting.
+//
+// It returns:
+// - an error in case of failure.
+func (c *Cursor) readContainerPosting() (err error) {
+
+	// Decodes from a copy of the source, positioned on the container:
+	source := c.reader
+	source.offset = c.containerOffset
+
+	switch c.container {
+	case postingsBitmap:
+		for c.containerWord == 0 {
+			if source.offset >= c.edgesOffset {
+				err = OutOfBounds
+				return
+			}
+			var byte_ byte
+			byte_, err = source.ReadByte()
+			if err != nil {
+				return
+			}
+			c.containerWord = int(byte_)
+			c.containerBase += 8
+		}
+		c.posting = c.containerBase +
+			bits.TrailingZeros(uint(c.containerWord))
+		c.containerWord &= c.containerWord - 1
+
+	case postingsRuns:
+		if c.containerWord == 0 {
+			var increment, length uint64
+			increment, err = binary.ReadUvarint(&source)
+			if err == nil {
+				length, err = binary.ReadUvarint(&source)
+			}
+			if err != nil {
+				return
+			}
+			c.posting += int(increment)
+			c.containerWord = int(length)
+		} else {
+			c.posting++
+			c.containerWord--
+		}
+
+	default:
+		var increment int
+		increment, err = c.readInt()
+		if err != nil {
+			return
+		}
+		c.posting += increment
+		return
+	}
+
+	c.containerOffset = source.offset
+	return
+}
+
+// It tests if there are no more postings to decode.
+//
+// In case it is true, it decodes the micro-header at the beginning of the
+// list of edges.
+//
+// It returns:
+// - an error in case of failure.
+func (c *Cursor) testEndPostings() (err error) {
+
+	// Just after reading the last posting, we need to prepare our state
+	// machine to read edges:
+	if c.postingsLeft == 0 && c.childrenBaseOffset == 0 && c.edgesLeft > 0 {
+
+		// The postings of the sub-trie are not needed to decode edges:
+		if c.trie.header.Features&FeatureSubtreePostings != 0 {
+			var numPostings, sizeOfPostings int
+			numPostings, err = c.readInt()
+			if err == nil && numPostings > 0 {
+				sizeOfPostings, err = c.readInt()
+				if err == nil {
+					err = c.seek(c.tell() + sizeOfPostings)
+				}
+			}
+			if err != nil {
+				err = fmt.Errorf("Cursor.testEndPostings: %v", err)
+				c.clear()
+				return
+			}
+		}
+
+		var sizeOfEdges int
+		sizeOfEdges, err = c.readInt()
+		if err != nil {
+			err = fmt.Errorf("Cursor.testEndPostings: %v", err)
+			c.clear()
+			return
+		}
+
+		c.childrenBaseOffset = c.tell() + sizeOfEdges
+	}
+
+	return
+}
+
+// It decodes next posting.
+//
+// When all postings have already been read it returns (0, io.EOF).
+//
+// Postings are decoded after entering one node and before decoding edges.
+// An early call of method ReadEdge inhibits this method.
+//
+// It returns:
+// - the decoded posting.
+// - an error in case of failure.
+func (c *Cursor) ReadPosting() (posting int, err error) {
+
+	if c.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("ReadPosting: %v", err)
+		}
+	}()
+
+	err = c.readContainerPosting()
+	if err != nil {
+		return
+	}
+	c.postingsLeft--
+
+	c.frequency = 1
+	if c.trie.header.Features&FeatureFrequencies != 0 {
+		c.frequency, err = c.readInt()
+		if err != nil {
+			return
+		}
+	}
+
+	// Positions are skipped, they are decoded only if needed:
+	c.numPositions = 0
+	if c.trie.header.Features&FeaturePositions != 0 {
+		c.numPositions, err = c.readInt()
+		if err != nil {
+			return
+		}
+		c.positionsOffset = c.tell()
+		for i := 0; i < c.numPositions; i++ {
+			_, err = c.readInt()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// When there are no postings we need to prepare our machine to read nodes:
+	err = c.testEndPostings()
+
+	posting = c.posting
+	return
+}
+
+// It skips all the postings lower than target and decodes the next one.
+//
+// When all postings have already been read it returns (0, io.EOF).
+//
+// With FeatureSkipBlocks the blocks of postings that cannot contain target
+// are skipped without decoding them, so that intersecting a rare term with a
+// common one decodes only few postings of the latter.
+//
+// It returns:
+// - the decoded posting.
+// - an error in case of failure.
+func (c *Cursor) SkipTo(target int) (posting int, err error) {
+
+	if c.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil && err != io.EOF {
+			c.clear()
+			err = fmt.Errorf("Cursor.SkipTo: %v", err)
+		}
+	}()
+
+	// Reads the skip entries of all the blocks that start with postings
+	// lower than target, if target is not just the next posting:
+	offset := c.tell()
+	for c.skipsLeft > 0 && target > c.posting+1 {
+		err = c.seek(c.skipsOffset)
+		if err != nil {
+			return
+		}
+		var postingIncrement, offsetIncrement int
+		postingIncrement, err = c.readInt()
+		if err == nil {
+			offsetIncrement, err = c.readInt()
+		}
+		if err != nil {
+			return
+		} else if c.skipPosting+postingIncrement >= target {
+			break
+		}
+
+		c.skipsOffset = c.tell()
+		c.skipsLeft--
+		c.skipPosting += postingIncrement
+		c.skipBlockOffset += offsetIncrement
+		c.skipBlock++
+	}
+
+	// Jumps to the last of those blocks, if ahead:
+	blockStart := c.skipBlock * skipBlockSize
+	if blockStart > c.numPostings-c.postingsLeft {
+		if c.skipBlockOffset >= c.edgesOffset {
+			err = OutOfBounds
+			return
+		}
+		offset = c.skipBlockOffset
+		c.posting = c.skipPosting
+		c.postingsLeft = c.numPostings - blockStart
+	}
+	err = c.seek(offset)
+	if err != nil {
+		return
+	}
+
+	for {
+		posting, err = c.ReadPosting()
+		if err != nil || posting >= target {
+			return
+		}
+	}
+}
+
+// Like ReadPosting but it also returns how many times the term of the current
+// node occurs in the document of the decoded posting.
+//
+// If the trie has not been generated with FeatureFrequencies the returned
+// frequency is always 1.
+func (c *Cursor) ReadPostingWithFrequency() (posting int, frequency int,
+	err error) {
+
+	posting, err = c.ReadPosting()
+	if err == nil {
+		frequency = c.frequency
+	}
+	return
+}
+
+// Like ReadAllPostings but it also returns, for each decoded posting, how many
+// times the term of the current node occurs in the related document.
+//
+// If the trie has not been generated with FeatureFrequencies the returned
+// frequencies are always 1.
+func (c *Cursor) ReadAllPostingsWithFrequencies() (postings []int,
+	frequencies []int, err error) {
+
+	if c.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	num := c.postingsLeft
+	postings_ := make([]int, num)
+	frequencies_ := make([]int, num)
+	for i := 0; err == nil && i < num; i++ {
+		postings_[i], frequencies_[i], err = c.ReadPostingWithFrequency()
+	}
+	if err != nil {
+		err = fmt.Errorf("Cursor.ReadAllPostingsWithFrequencies: %v", err)
+		return
+	}
+
+	postings = postings_
+	frequencies = frequencies_
+	return
+}
+
+// It decodes the positions of the term of the current node in the document of
+// the last posting decoded with ReadPosting, that is how many terms precede
+// each occurrence of the term in the document.
+//
+// If the trie has not been generated with FeaturePositions it returns nil.
+//
+// It returns:
+// - the sorted positions.
+// - an error in case of failure.
+func (c *Cursor) ReadPositions() (positions []int, err error) {
+
+	if c.numPositions == 0 {
+		return
+	}
+
+	// Decodes from a copy of the source to keep the state of the cursor:
+	source := c.reader
+	source.offset = c.positionsOffset
+	positions_ := make([]int, c.numPositions)
+	position := 0
+	for i := range positions_ {
+		var increment uint64
+		increment, err = binary.ReadUvarint(&source)
+		if err != nil {
+			err = fmt.Errorf("Cursor.ReadPositions: %v", err)
+			return
+		}
+		position += int(increment)
+		positions_[i] = position
+	}
+
+	positions = positions_
+	return
+}
+
+// Like ReadAllPostings but it also returns, for each decoded posting, the
+// positions of the term in the related document (see ReadPositions).
+func (c *Cursor) ReadAllPostingsWithPositions() (postings []int,
+	positions [][]int, err error) {
+
+	if c.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	num := c.postingsLeft
+	postings_ := make([]int, num)
+	positions_ := make([][]int, num)
+	for i := 0; err == nil && i < num; i++ {
+		postings_[i], err = c.ReadPosting()
+		if err == nil {
+			positions_[i], err = c.ReadPositions()
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("Cursor.ReadAllPostingsWithPositions: %v", err)
+		return
+	}
+
+	postings = postings_
+	positions = positions_
+	return
+}
+
+// It decodes all remaining postings.
+//
+// If all postings have already been read it returns (nil, io.EOF).
+//
+// Postings are decoded after entering one node and before decoding edges.
+// An early call of method ReadEdge inhibits this method.
+//
+// It returns:
+// - all decoded posting in a sorted deduplicated array.
+// - an error in case of failure.
+func (c *Cursor) ReadAllPostings() (postings []int, err error) {
+
+	if c.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.ReadAllPostings: %v", err)
+		}
+	}()
+
+	num := c.postingsLeft
+	postings_ := make([]int, c.postingsLeft)
+	for i := 0; err == nil && i < num; i++ {
+		postings_[i], err = c.ReadPosting()
+	}
+
+	if err == nil {
+		postings = postings_
+	}
+
+	return
+}
+
+// It returns an iterator on the postings of the sub-trie of the current node
+// precomputed by the builder (see FeatureSubtreePostings), that can replace a
+// visit of the sub-trie only before decoding any posting or edge of the node.
+//
+// It returns:
+// - the iterator, nil if there are no precomputed postings to be used.
+// - an error in case of failure.
+func (c *Cursor) subtreePostings() (iterator *subtreePostingIterator,
+	err error) {
+
+	if c.trie.header.Features&FeatureSubtreePostings == 0 ||
+		c.edgesLeft == 0 || c.edgesLeft != c.numEdges || c.label != "" ||
+		c.postingsLeft != c.numPostings {
+		return
+	}
+
+	// Decodes from a copy of the source to keep the state of the cursor:
+	source := c.reader
+	source.offset = c.edgesOffset
+	var numPostings, size uint64
+	numPostings, err = binary.ReadUvarint(&source)
+	if err != nil || numPostings == 0 {
+		return
+	}
+	size, err = binary.ReadUvarint(&source)
+	if err != nil {
+		return
+	} else if size > uint64(source.Len()) || numPostings > size {
+		err = OutOfBounds
+		return
+	}
+
+	iterator = &subtreePostingIterator{
+		source:       source,
+		postingsLeft: int(numPostings),
+		frequencies:  c.trie.header.Features&FeatureFrequencies != 0}
+	return
+}
+
+// It decodes all remaining postings plus all the postings from all sub-nodes
+// recursively.
+//
+// If all postings and edges have already been read it returns (nil, io.EOF).
+//
+// With FeatureSubtreePostings the postings of the sub-trie of some nodes are
+// precomputed, and they are used instead of visiting the sub-trie.
+//
+// This method effectively consumes all remaining postings and edges of current
+// node, the only things to do after it are:
+// - jumping to another Node (method JumpNode).
+// - entering in one node from one Edge returned previously (method EnterNode).
+// - reset the cursor to the root node (method Reset).
+//
+// It returns:
+// - all decoded posting in a sorted deduplicated array.
+// - an error in case of failure.
+func (c *Cursor) ReadAllPostingsRecursive() (postings []int,
+	err error) {
+
+	if c.postingsLeft == 0 && c.edgesLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil && err != io.EOF {
+			c.clear()
+			err = fmt.Errorf("Cursor.ReadAllPostingsRecursive: %v", err)
+		}
+	}()
+
+	postings_ := make([]int, 0)
+
+	// Breadth-first traversal of the trie with this very cursor, the queue
+	// contains the edges of the nodes still to be visited:
+	var queue []Edge
+	var numLists int // Sorted lists of postings appended to the result.
+	for {
+		// Takes the precomputed postings of the whole sub-trie, if any:
+		var subtree *subtreePostingIterator
+		subtree, err = c.subtreePostings()
+		if err != nil {
+			return
+		} else if subtree != nil {
+			var postings__ []int
+			postings__, _, err = subtree.readAll()
+			if err != nil {
+				return
+			}
+			postings_ = append(postings_, postings__...)
+			c.postingsLeft, c.edgesLeft = 0, 0
+			numLists++
+		} else if c.postingsLeft > 0 {
+			numLists++
+		}
+
+		// Reads all the postings and appends them to the result:
+		for c.postingsLeft > 0 {
+			var posting int
+			posting, err = c.ReadPosting()
+			if err != nil {
+				return
+			}
+			postings_ = append(postings_, posting)
+		}
+
+		// Queues all the edges to visit their nodes later:
+		for c.edgesLeft > 0 {
+			var edge Edge
+			edge, err = c.ReadEdge()
+			if err != nil {
+				return
+			}
+			queue = append(queue, edge)
+		}
+
+		if len(queue) == 0 {
+			break
+		}
+		_, err = c.EnterNode(queue[0])
+		if err != nil {
+			return
+		}
+		queue = queue[1:]
+	}
+
+	// A single list, like the postings of a sub-trie, is already sorted:
+	if numLists > 1 {
+		postings_ = SortDedupPostings(postings_)
+	} else if len(postings_) == 0 {
+		postings_ = nil
+	}
+	postings = postings_
+	return
+}
+
+// Like ReadAllPostingsRecursive but it also returns, for each decoded posting,
+// how many times the terms of the visited nodes occur in the related document
+// all together.
+//
+// It returns:
+// - all decoded postings in a sorted deduplicated array.
+// - the summed frequencies, one per posting.
+// - an error in case of failure.
+func (c *Cursor) ReadAllPostingsRecursiveWithFrequencies() (
+	postings []int, frequencies []int, err error) {
+
+	if c.postingsLeft == 0 && c.edgesLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil && err != io.EOF {
+			c.clear()
+			err = fmt.Errorf(
+				"Cursor.ReadAllPostingsRecursiveWithFrequencies: %v", err)
+		}
+	}()
+
+	// The precomputed postings of the whole sub-trie come with their summed
+	// frequencies already:
+	var subtree *subtreePostingIterator
+	subtree, err = c.subtreePostings()
+	if err != nil {
+		return
+	} else if subtree != nil {
+		postings, frequencies, err = subtree.readAll()
+		c.postingsLeft, c.edgesLeft = 0, 0
+		return
+	}
+
+	counts := make(map[int]int)
+
+	// Breadth-first traversal of the trie with this very cursor, the queue
+	// contains the edges of the nodes still to be visited:
+	var queue []Edge
+	for {
+		// Takes the precomputed postings of the whole sub-trie, if any:
+		subtree, err = c.subtreePostings()
+		if err != nil {
+			return
+		} else if subtree != nil {
+			var postings_, frequencies_ []int
+			postings_, frequencies_, err = subtree.readAll()
+			if err != nil {
+				return
+			}
+			for i, posting := range postings_ {
+				counts[posting] += frequencies_[i]
+			}
+			c.postingsLeft, c.edgesLeft = 0, 0
+		}
+
+		// Reads all the postings and accumulates their frequencies:
+		for c.postingsLeft > 0 {
+			var posting, frequency int
+			posting, frequency, err = c.ReadPostingWithFrequency()
+			if err != nil {
+				return
+			}
+			counts[posting] += frequency
+		}
+
+		// Queues all the edges to visit their nodes later:
+		for c.edgesLeft > 0 {
+			var edge Edge
+			edge, err = c.ReadEdge()
+			if err != nil {
+				return
+			}
+			queue = append(queue, edge)
+		}
+
+		if len(queue) == 0 {
+			break
+		}
+		_, err = c.EnterNode(queue[0])
+		if err != nil {
+			return
+		}
+		queue = queue[1:]
+	}
+
+	postings_ := make([]int, 0, len(counts))
+	for posting := range counts {
+		postings_ = append(postings_, posting)
+	}
+	sort.Ints(postings_)
+	frequencies_ := make([]int, len(postings_))
+	for i, posting := range postings_ {
+		frequencies_[i] = counts[posting]
+	}
+
+	postings = postings_
+	frequencies = frequencies_
+	return
+}
+
+// It skips decoding of all the remaining postings preparing the cursor to
+// decode the edges.
+//
+// It returns:
+// - an error in case of failure.
+func (c *Cursor) skipPostings() (err error) {
+
+	if c.postingsLeft == 0 {
+		return
+	}
+
+	// Any further failure would reset our state machine:
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.skipPostings: %v", err)
+		}
+	}()
+
+	err = c.seek(c.edgesOffset)
+	if err != nil {
+		return
+	}
+
+	c.postingsLeft = 0
+	c.testEndPostings()
+	return
+}
+
+// It decodes one edge.
+//
+// An early call of this method inhibits reading of postings from the current
+// node.
+//
+// Returned value can be used to enter the sub-node targeted by current edge.
+//
+// It returns:
+// - information about the decoded edge.
+// - an error in case of failure.
+func (c *Cursor) ReadEdge() (edge Edge, err error) {
+
+	if c.edgesLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Any further failure will reset our state machine:
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.ReadEdge: %v", err)
+		}
+	}()
+
+	// The single edge of a virtual node:
+	if c.label != "" {
+		r, size := utf8.DecodeRuneInString(c.label)
+		edge = Edge{
+			Rune:       r,
+			Suffix:     c.label[size:],
+			nodeOffset: c.childrenBaseOffset,
+			trie:       trieTag{trie: c.trie}}
+		c.label = ""
+		c.edgesLeft--
+		return
+	}
+
+	if c.postingsLeft > 0 {
+		err = c.skipPostings()
+		if err != nil {
+			return
+		}
+	}
+
+	var runeIncrement int
+	runeIncrement, err = c.readInt()
+	if err != nil {
+		return
+	}
+	c.rune_ += runeIncrement
+
+	var sizeOfChildrenNode int
+	sizeOfChildrenNode, err = c.readInt()
+	if err != nil {
+		return
+	}
+
+	var suffix string
+	if c.trie.header.Features&FeatureRadixEdges != 0 {
+		var sizeOfSuffix int
+		sizeOfSuffix, err = c.readInt()
+		if err != nil {
+			return
+		}
+		if sizeOfSuffix > 0 {
+			var bytes_ []byte
+			bytes_, err = c.reader.ReadRange(c.tell(), sizeOfSuffix)
+			if err == nil {
+				suffix = string(bytes_)
+				err = c.seek(c.tell() + sizeOfSuffix)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	edge = Edge{
+		Rune:       rune(c.rune_),
+		Suffix:     suffix,
+		nodeOffset: c.childrenBaseOffset,
+		trie:       trieTag{trie: c.trie}}
+	c.childrenBaseOffset += sizeOfChildrenNode
+	c.edgesLeft--
+	return
+}
+
+// It decodes all remaining edges.
+//
+// An early call of this method inhibits reading of postings from the current
+// node.
+//
+// Returned values can be used to enter the sub-node targeted by current edge.
+//
+// It returns:
+// - information about the decoded edges in a single array, sorted by relative
+//   UNICODE code point.
+// - an error in case of failure.
+func (c *Cursor) ReadAllEdges() (edges []Edge, err error) {
+
+	if c.edgesLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	edges_ := make([]Edge, c.edgesLeft)
+	var i int
+	for err == nil && c.edgesLeft > 0 {
+		edges_[i], err = c.ReadEdge()
+		i++
+	}
+	if err != nil {
+		err = fmt.Errorf("Cursor.ReadAllEdges: %v", err)
+		return
+	}
+
+	edges = edges_
+	return
+}
+
+// It uses edge information returned by ReadEdge, ReadAllEdges to enter targeted
+// child node.
+//
+// It returns:
+// - information about the entered node.
+// - ForeignHandle if the edge comes from another trie.
+// - an error in case of failure.
+func (c *Cursor) EnterNode(edge Edge) (node Node, err error) {
+
+	// Any further failure will reset our state machine:
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.EnterNode: %w", err)
+		}
+	}()
+
+	var sameTrie bool
+	sameTrie, err = edge.trie.belongsTo(c.trie)
+	if err != nil {
+		return
+	} else if !sameTrie {
+		err = ForeignHandle
+		return
+	}
+
+	err = c.seek(edge.nodeOffset)
+	if err != nil {
+		return
+	}
+
+	node, err = c.readNode()
+	return
+}
+
+// Takes one term and traverses the trie from the current node matching all
+// term's UNICODE code points in order.
+//
+// If during the traversal is not able to find one edge it returns a
+// zeroed-node, this is not considered a failure but simply a negative match.
+//
+// With FeatureRadixEdges the term can end in the middle of the label of an
+// edge: the returned node is then a virtual one, without postings and with a
+// single edge labeled with the rest of the label. The cursor is positioned on
+// it as on any other node.
+//
+// It returns:
+// - information about the final node.
+// - an error in case of failure.
+func (c *Cursor) Match(term string) (node Node, err error) {
+
+	// Handles post-condition:
+	defer func() {
+		if err == io.EOF {
+			err = nil // No match have been found.
+		} else if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.Match('%v'): %v", term, err)
+		}
+	}()
+
+	var node_ Node
+	for len(term) > 0 {
+		targetRune, size := utf8.DecodeRuneInString(term)
+		term = term[size:]
+
+		var edge Edge
+		for err == nil && edge.Rune < targetRune {
+			edge, err = c.ReadEdge()
+		}
+		if err == nil && edge.Rune != targetRune {
+			err = io.EOF // Not found!
+		}
+		if err != nil {
+			return // Edge with the given rune have not found.
+		}
+
+		// The rest of the label must match the term, unless it ends first:
+		if strings.HasPrefix(term, edge.Suffix) {
+			term = term[len(edge.Suffix):]
+		} else if strings.HasPrefix(edge.Suffix, term) {
+			node_ = midEdgeNode(edge, edge.Suffix[len(term):])
+			err = c.JumpNode(node_)
+			if err == nil {
+				node = node_
+			}
+			return
+		} else {
+			err = io.EOF // Not found!
+			return
+		}
+
+		node_, err = c.EnterNode(edge)
+		if err != nil {
+			return // Edge with the given rune have not found.
+		}
+	}
+
+	node = node_
+	return
+}
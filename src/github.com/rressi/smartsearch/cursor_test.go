@@ -1,21 +1,41 @@
 package smartsearch
 
 import (
+	"bytes"
 	"io"
 	"reflect"
 	"testing"
 )
 
-func TestTrieReader_Empty(t *testing.T) {
+// It makes a node decoded from a trie without optional features.
+func makeNode(numPostings, numEdges, postingsOffset, edgesOffset int) Node {
+	return Node{
+		NumPostings:    numPostings,
+		NumEdges:       numEdges,
+		postingsOffset: postingsOffset,
+		edgesOffset:    edgesOffset}
+}
+
+// It returns the tag of the nodes and of the edges decoded by the given
+// cursor, to be set on the expected ones.
+func testTrieTag(reader *Cursor) trieTag {
+	if reader == nil {
+		return trieTag{}
+	}
+	return trieTag{trie: reader.Trie()}
+}
+
+func TestCursor_Empty(t *testing.T) {
 
 	// builder := NewTrieBuilder()
 
 	source_bytes := []byte{0, 0}
-	expected_node := Node{0, 0, 2, 2}
+	expected_node := makeNode(0, 0, 2, 2)
 	expected_posting := 0
-	expected_edge := Edge{0, 0}
+	expected_edge := Edge{}
 
 	reader, node, err := NewTrieReader(source_bytes)
+	expected_node.trie = testTrieTag(reader)
 	if err != nil {
 		t.Errorf("NewTrieReader failed: %v", err)
 	} else if reader == nil {
@@ -39,19 +59,20 @@ func TestTrieReader_Empty(t *testing.T) {
 	}
 }
 
-func TestTrieReader_VoidTerm(t *testing.T) {
+func TestCursor_VoidTerm(t *testing.T) {
 
 	// builder := NewTrieBuilder()
 	// builder.Add(1, "")
 	// builder.Add(2, "")
 
 	source_bytes := []byte{2, 0, 2, 1, 1}
-	expected_node := Node{2, 0, 3, 5}
+	expected_node := makeNode(2, 0, 3, 5)
 	expected_postings := []int{1, 2}
-	expected_edge := Edge{0, 0}
+	expected_edge := Edge{}
 
 	// Creates a reader, it points to the root node:
 	reader, node, err := NewTrieReader(source_bytes)
+	expected_node.trie = testTrieTag(reader)
 	if err != nil {
 		t.Errorf("NewTrieReader failed: %v", err)
 	} else if reader == nil {
@@ -66,7 +87,7 @@ func TestTrieReader_VoidTerm(t *testing.T) {
 		if err != nil {
 			t.Errorf("ReadPosting failed: i=%v, err=%v", i, err)
 		} else if posting != expected_posting {
-			t.Errorf("ReadPosting failed: posting[%i]=%v", i, posting)
+			t.Errorf("ReadPosting failed: posting[%v]=%v", i, posting)
 		}
 	}
 
@@ -103,7 +124,7 @@ func TestTrieReader_VoidTerm(t *testing.T) {
 	}
 }
 
-func TestTrieReader_Base(t *testing.T) {
+func TestCursor_Base(t *testing.T) {
 
 	// builder := NewTrieBuilder()
 	// builder.Add(1, "A")
@@ -112,14 +133,23 @@ func TestTrieReader_Base(t *testing.T) {
 	// builder.Add(2, "B")
 
 	source_bytes := []byte{0, 2, 4, 65, 5, 1, 5, 2, 0, 2, 1, 1, 2, 0, 2, 1, 1}
-	expected_nodes := []Node{{0, 2, 2, 2}, {2, 0, 10, 12}, {2, 0, 15, 17}}
-	expected_edges := []Edge{{rune('A'), 7}, {rune('B'), 12}}
-	expected_edge_eof := Edge{0, 0}
+	expected_nodes := []Node{makeNode(0, 2, 2, 2), makeNode(2, 0, 10, 12),
+		makeNode(2, 0, 15, 17)}
+	expected_edges := []Edge{{Rune: 'A', nodeOffset: 7},
+		{Rune: 'B', nodeOffset: 12}}
+	expected_edge_eof := Edge{}
 	expected_postings := []int{1, 2, 1, 2}
 	expected_posting_eof := 0
 
 	// Creates a reader, it points to the root node:
 	reader, node, err := NewTrieReader(source_bytes)
+	tag := testTrieTag(reader)
+	for i := range expected_nodes {
+		expected_nodes[i].trie = tag
+	}
+	for i := range expected_edges {
+		expected_edges[i].trie = tag
+	}
 	if err != nil {
 		t.Errorf("NewTrieReader failed: %v", err)
 	} else if reader == nil {
@@ -207,7 +237,7 @@ func TestTrieReader_Base(t *testing.T) {
 
 }
 
-func TestTrieReader_Match(t *testing.T) {
+func TestCursor_Match(t *testing.T) {
 
 	var err error
 	var source_bytes []byte
@@ -219,10 +249,10 @@ func TestTrieReader_Match(t *testing.T) {
 	source_bytes = []byte{0, 0}
 	terms = []string{"", "A", "B", "ABC"}
 	expected_matches = []Node{
-		{0, 0, 0, 0},
-		{0, 0, 0, 0},
-		{0, 0, 0, 0},
-		{0, 0, 0, 0}}
+		makeNode(0, 0, 0, 0),
+		makeNode(0, 0, 0, 0),
+		makeNode(0, 0, 0, 0),
+		makeNode(0, 0, 0, 0)}
 	reader, _, err = NewTrieReader(source_bytes)
 	if err != nil {
 		t.Errorf("Cannot create trie reader from bytes: %v", source_bytes)
@@ -244,14 +274,19 @@ func TestTrieReader_Match(t *testing.T) {
 	source_bytes = []byte{0, 2, 4, 65, 5, 1, 5, 2, 0, 2, 1, 1, 2, 0, 2, 1, 1}
 	terms = []string{"", "A", "B", "ABC"}
 	expected_matches = []Node{
-		{0, 0, 0, 0},
-		{2, 0, 10, 12},
-		{2, 0, 15, 17},
-		{0, 0, 0, 0}}
+		makeNode(0, 0, 0, 0),
+		makeNode(2, 0, 10, 12),
+		makeNode(2, 0, 15, 17),
+		makeNode(0, 0, 0, 0)}
 	reader, _, err = NewTrieReader(source_bytes)
 	if err != nil {
 		t.Errorf("Cannot create trie reader from bytes: %v", source_bytes)
 	}
+	for i := range expected_matches {
+		if expected_matches[i] != (Node{}) {
+			expected_matches[i].trie = testTrieTag(reader)
+		}
+	}
 	for i, term := range terms {
 		reader.Reset()
 		node, err := reader.Match(term)
@@ -271,16 +306,21 @@ func TestTrieReader_Match(t *testing.T) {
 		1, 2, 65, 9, 0, 1, 2, 66, 4, 1, 0, 1, 3}
 	terms = []string{"", "A", "BC", "CAB", "AA", "CBA"}
 	expected_matches = []Node{
-		{0, 0, 0, 0},
-		{0, 1, 11, 11},
-		{0, 1, 30, 30},
-		{1, 0, 50, 51},
-		{0, 0, 0, 0},
-		{0, 0, 0, 0}}
+		makeNode(0, 0, 0, 0),
+		makeNode(0, 1, 11, 11),
+		makeNode(0, 1, 30, 30),
+		makeNode(1, 0, 50, 51),
+		makeNode(0, 0, 0, 0),
+		makeNode(0, 0, 0, 0)}
 	reader, _, err = NewTrieReader(source_bytes)
 	if err != nil {
 		t.Errorf("Cannot create trie reader from bytes: %v", source_bytes)
 	}
+	for i := range expected_matches {
+		if expected_matches[i] != (Node{}) {
+			expected_matches[i].trie = testTrieTag(reader)
+		}
+	}
 	for i, term := range terms {
 		reader.Reset()
 		node, err := reader.Match(term)
@@ -291,3 +331,164 @@ func TestTrieReader_Match(t *testing.T) {
 		}
 	}
 }
+
+func TestCursor_ReaderAt(t *testing.T) {
+
+	// builder := NewTrieBuilder()
+	// builder.Add(1, "ABC")
+	// builder.Add(2, "BCA")
+	// builder.Add(3, "CAB")
+	source_bytes := []byte{0, 3, 6, 65, 14, 1, 14, 1, 14, 0, 1, 2, 66, 9, 0,
+		1, 2, 67, 4, 1, 0, 1, 1, 0, 1, 2, 67, 9, 0, 1, 2, 65, 4, 1, 0, 1, 2, 0,
+		1, 2, 65, 9, 0, 1, 2, 66, 4, 1, 0, 1, 3}
+	terms := []string{"", "A", "BC", "CAB", "AA", "CBA"}
+
+	memReader, _, err := NewTrieReader(source_bytes)
+	if err != nil {
+		t.Fatalf("Cannot create trie reader: %v", err)
+	}
+	src := bytes.NewReader(source_bytes)
+	reader, _, err := NewTrieReaderAt(src, src.Size())
+	if err != nil {
+		t.Fatalf("Cannot create trie reader at: %v", err)
+	}
+
+	for _, term := range terms {
+		memReader.Reset()
+		expected_node, _ := memReader.Match(term)
+		expected_postings, _ := memReader.ReadAllPostingsRecursive()
+
+		if expected_node != (Node{}) {
+			expected_node.trie = testTrieTag(reader)
+		}
+
+		reader.Reset()
+		node, err := reader.Match(term)
+		if err != nil {
+			t.Errorf("Cannot match term '%v': %v", term, err)
+		} else if node != expected_node {
+			t.Errorf("Unexpected match: term='%v' node=%v", term, node)
+		}
+
+		postings, _ := reader.ReadAllPostingsRecursive()
+		if !reflect.DeepEqual(postings, expected_postings) {
+			t.Errorf("Unexpected postings: term='%v' postings=%v", term,
+				postings)
+		}
+	}
+
+	if err = reader.Trie().Verify(); err != nil {
+		t.Errorf("Unexpected failure: %v", err)
+	}
+}
+
+func TestCursor_RadixEdges(t *testing.T) {
+
+	documents := map[int][]string{
+		1: {"street", "strength"},
+		2: {"street", "stop"},
+		3: {"strand", "s"},
+		4: {"àèìòù"}}
+	terms := []string{"", "s", "st", "str", "stre", "stree", "street",
+		"streets", "strength", "stra", "sto", "stx", "àè", "àèìòù", "x"}
+
+	tries := make([]*Trie, 2)
+	sizes := make([]int, 2)
+	for i, features := range []IndexFeatures{0, FeatureRadixEdges} {
+		builder := NewTrieBuilderWithFeatures(features)
+		for posting, terms := range documents {
+			for _, term := range terms {
+				builder.Add(posting, term)
+			}
+		}
+		buf := new(bytes.Buffer)
+		builder.Dump(buf)
+		sizes[i] = buf.Len()
+
+		var err error
+		tries[i], err = NewTrie(buf.Bytes())
+		if err != nil {
+			t.Fatalf("Cannot create trie: %v", err)
+		} else if err = tries[i].Verify(); err != nil {
+			t.Errorf("Invalid trie with features %v: %v", features, err)
+		}
+	}
+	if sizes[1] >= sizes[0] {
+		t.Errorf("Radix edges do not save space: %v", sizes)
+	}
+
+	// Same postings for exact and prefix matches:
+	postingsOf := func(trie *Trie, term string) (exact []int, prefix []int) {
+		cursor, _ := trie.Root()
+		node, err := cursor.Match(term)
+		if err != nil {
+			t.Errorf("Match('%v') failed: %v", term, err)
+		}
+		if node.NumPostings > 0 {
+			exact, _ = cursor.ReadAllPostings()
+		}
+		cursor.JumpNode(node)
+		prefix, _ = cursor.ReadAllPostingsRecursive()
+		return
+	}
+	for _, term := range terms {
+		exact, prefix := postingsOf(tries[0], term)
+		radixExact, radixPrefix := postingsOf(tries[1], term)
+		if !reflect.DeepEqual(radixExact, exact) ||
+			!reflect.DeepEqual(radixPrefix, prefix) {
+			t.Errorf("Unexpected postings for '%v': %v %v", term, radixExact,
+				radixPrefix)
+		}
+	}
+
+	// Edges are labeled with many runes:
+	cursor, _ := tries[1].Root()
+	cursor.Match("st")
+	edges, err := cursor.ReadAllEdges()
+	if err != nil || len(edges) != 2 || edges[0].Rune != 'o' ||
+		edges[0].Suffix != "p" || edges[1].Rune != 'r' ||
+		edges[1].Suffix != "" {
+		t.Errorf("Unexpected edges: %v, err=%v", edges, err)
+	}
+
+	// Virtual nodes in the middle of an edge can be marshaled, unmarshaled
+	// ones keep only the identity of their trie:
+	cursor.Reset()
+	node, err := cursor.Match("stree")
+	if err != nil || node.NumPostings != 0 || node.NumEdges != 1 ||
+		node.label != "t" {
+		t.Fatalf("Unexpected node: %v, err=%v", node, err)
+	}
+	identity, _ := tries[1].Identity()
+	expected := node
+	expected.trie = trieTag{identity: identity}
+	data, _ := node.MarshalBinary()
+	var decoded Node
+	err = decoded.UnmarshalBinary(data)
+	if err != nil || decoded != expected {
+		t.Errorf("Unexpected node: %v, err=%v", decoded, err)
+	}
+	data, _ = node.MarshalJSON()
+	decoded = Node{}
+	err = decoded.UnmarshalJSON(data)
+	if err != nil || decoded != expected {
+		t.Errorf("Unexpected node: %v, err=%v", decoded, err)
+	}
+	cursor.Reset()
+	cursor.JumpNode(decoded)
+	postings, err := cursor.ReadAllPostingsRecursive()
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+	cursor.JumpNode(decoded)
+	other, err := cursor.Match("t")
+	if err != nil || other.NumPostings != 2 {
+		t.Errorf("Unexpected node: %v, err=%v", other, err)
+	}
+
+	// Tampered virtual nodes are refused:
+	node.NumEdges = 2
+	if err = cursor.JumpNode(node); err != OutOfBounds {
+		t.Errorf("OutOfBounds was expected: %v", err)
+	}
+}
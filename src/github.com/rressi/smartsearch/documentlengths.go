@@ -0,0 +1,111 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// A map document id -> number of terms contained by the document.
+//
+// It is stored in the indices with FeatureDocumentLengths and it is used to
+// rank the search results (see Index.SearchRanked).
+type DocumentLengths map[int]int
+
+// It returns the average length of the documents, 0 if there are none.
+func (l DocumentLengths) Average() float64 {
+
+	if len(l) == 0 {
+		return 0
+	}
+
+	total := 0
+	for _, length := range l {
+		total += length
+	}
+	return float64(total) / float64(len(l))
+}
+
+// It encodes the given document lengths in a compact way.
+//
+// Encoding is composed by the number of documents followed by, for each
+// document sorted by id, the delta between its id and the one of the previous
+// document and then its length. All the values are in Uvarint format.
+//
+// It returns:
+// - the encoded bytes.
+func EncodeDocumentLengths(lengths DocumentLengths) []byte {
+
+	ids := make([]int, 0, len(lengths))
+	for id := range lengths {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	buf := new(bytes.Buffer)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	numBytes := binary.PutUvarint(tmp, uint64(len(ids)))
+	buf.Write(tmp[:numBytes])
+
+	previousId := 0
+	for _, id := range ids {
+		numBytes = binary.PutUvarint(tmp, uint64(id-previousId))
+		buf.Write(tmp[:numBytes])
+		numBytes = binary.PutUvarint(tmp, uint64(lengths[id]))
+		buf.Write(tmp[:numBytes])
+		previousId = id
+	}
+
+	return buf.Bytes()
+}
+
+// It decodes document lengths previously encoded by EncodeDocumentLengths.
+//
+// It returns:
+// - the decoded lengths.
+// - an error in case of failure.
+func DecodeDocumentLengths(src []byte) (lengths DocumentLengths, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("DecodeDocumentLengths: %v", err)
+		}
+	}()
+
+	reader := bytes.NewReader(src)
+	var count uint64
+	count, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return
+	} else if count > uint64(len(src)) {
+		err = fmt.Errorf("invalid number of documents %v", count)
+		return
+	}
+
+	lengths_ := make(DocumentLengths, int(count))
+	id := 0
+	for i := 0; i < int(count); i++ {
+		var delta, length uint64
+		delta, err = binary.ReadUvarint(reader)
+		if err == nil {
+			length, err = binary.ReadUvarint(reader)
+		}
+		if err != nil {
+			return
+		} else if i > 0 && delta == 0 {
+			err = fmt.Errorf("duplicated document id %v", id)
+			return
+		}
+		id += int(delta)
+		lengths_[id] = int(length)
+	}
+
+	if reader.Len() > 0 {
+		err = fmt.Errorf("%v trailing bytes", reader.Len())
+		return
+	}
+
+	lengths = lengths_
+	return
+}
@@ -0,0 +1,46 @@
+package smartsearch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDocumentLengths_Base(t *testing.T) {
+
+	lengths := DocumentLengths{3: 10, 1: 5, 200: 3}
+	encoded := EncodeDocumentLengths(lengths)
+
+	expected := []byte{3, 1, 5, 2, 10, 197, 1, 3}
+	if !reflect.DeepEqual(encoded, expected) {
+		t.Errorf("Unexpected encoding: %v", encoded)
+	}
+
+	decoded, err := DecodeDocumentLengths(encoded)
+	if err != nil {
+		t.Errorf("Cannot decode: %v", err)
+	} else if !reflect.DeepEqual(decoded, lengths) {
+		t.Errorf("Unexpected lengths: %v", decoded)
+	}
+
+	if average := lengths.Average(); average != 6 {
+		t.Errorf("Unexpected average: %v", average)
+	}
+	if average := (DocumentLengths{}).Average(); average != 0 {
+		t.Errorf("Unexpected average: %v", average)
+	}
+}
+
+func TestDocumentLengths_Errors(t *testing.T) {
+
+	invalid := [][]byte{
+		{},
+		{2, 1, 5},       // Truncated.
+		{2, 1, 5, 0, 3}, // Duplicated id.
+		{1, 1, 5, 0},    // Trailing bytes.
+		{100, 1, 5}}     // Invalid count.
+	for _, src := range invalid {
+		if _, err := DecodeDocumentLengths(src); err == nil {
+			t.Errorf("Decoding should fail: %v", src)
+		}
+	}
+}
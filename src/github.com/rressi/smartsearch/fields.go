@@ -0,0 +1,295 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// It represents the content of one field of a document.
+type Field struct {
+	Name    string // Name of the field, like "Title".
+	Content string // Free text to be indexed.
+}
+
+// The terms of each field are stored in the same trie of all the other terms,
+// but below a root edge with a reserved rune: the rune fieldRuneBase+i is used
+// for the field with id i.
+//
+// Reserved runes are from a private use area of UNICODE, the normalizer
+// considers them separators so they can never be part of an indexed term.
+const fieldRuneBase = 0xF0000
+
+// Maximum number of fields an index can have.
+const maxFields = 0xFFFE
+
+// It tells if the given rune is the one of a field (see fieldRuneBase).
+func isFieldRune(r rune) bool {
+	return r >= fieldRuneBase && r < fieldRuneBase+maxFields
+}
+
+// It returns the prefix of all the terms of the field with the given id.
+func fieldPrefix(id int) string {
+	return string(rune(fieldRuneBase + id))
+}
+
+// It returns the key used to match a field name in a query, so that field
+// "Fun Facts" is matched by "funfacts", "fun_facts" or "Fun-Facts".
+func fieldKey(name string, tokenizer Tokenizer) string {
+	return strings.Join(tokenizer.Apply(name), "")
+}
+
+// This error is returned when a query refers to a field that the index does
+// not know.
+type UnknownFieldError struct {
+	Field string // The field as found in the query.
+}
+
+// Implementation of error.
+func (e UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field '%v'", e.Field)
+}
+
+// Boosts of the fields for ranking, by field name.
+//
+// When ranking, the occurrences of a term in a field count as many times as
+// the boost of the field: 1 by default, 2 to count them twice.
+type FieldBoosts map[string]float64
+
+// It encodes the names of the fields of an index, field ids are the positions
+// in the given slice.
+//
+// Encoding is composed by the number of fields followed by, for each field,
+// the length of its name in bytes (Uvarint) and the name itself.
+//
+// It returns:
+// - the encoded bytes.
+func EncodeFieldNames(names []string) []byte {
+
+	buf := new(bytes.Buffer)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	numBytes := binary.PutUvarint(tmp, uint64(len(names)))
+	buf.Write(tmp[:numBytes])
+
+	for _, name := range names {
+		numBytes = binary.PutUvarint(tmp, uint64(len(name)))
+		buf.Write(tmp[:numBytes])
+		buf.WriteString(name)
+	}
+
+	return buf.Bytes()
+}
+
+// It decodes the names of the fields previously encoded by EncodeFieldNames.
+//
+// It returns:
+// - the names of the fields, by id.
+// - an error in case of failure.
+func DecodeFieldNames(src []byte) (names []string, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("DecodeFieldNames: %v", err)
+		}
+	}()
+
+	reader := bytes.NewReader(src)
+	var count uint64
+	count, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return
+	} else if count > maxFields || count > uint64(len(src)) {
+		err = fmt.Errorf("invalid number of fields %v", count)
+		return
+	}
+
+	names_ := make([]string, int(count))
+	for i := range names_ {
+		var size uint64
+		size, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return
+		} else if size > uint64(reader.Len()) {
+			err = fmt.Errorf("invalid size of field name %v", size)
+			return
+		}
+
+		name := make([]byte, int(size))
+		_, err = io.ReadFull(reader, name)
+		if err != nil {
+			return
+		} else if !utf8.Valid(name) {
+			err = fmt.Errorf("invalid field name %q", name)
+			return
+		}
+		names_[i] = string(name)
+	}
+
+	if reader.Len() > 0 {
+		err = fmt.Errorf("%v trailing bytes", reader.Len())
+		return
+	}
+
+	names = names_
+	return
+}
+
+// It decodes the names of the fields of the documents, as stored by
+// IndexBuilder with FeatureFields.
+//
+// It returns:
+// - the names of the fields by id, nil if the index has no fields.
+// - an error in case of failure.
+func (t *Trie) ReadFieldNames() (names []string, err error) {
+
+	offset, size, ok := t.header.Section(FeatureFields)
+	if !ok {
+		return
+	}
+
+	var bytes_ []byte
+	bytes_, err = t.source.ReadRange(offset, size)
+	if err == nil {
+		names, err = DecodeFieldNames(bytes_)
+	}
+	if err != nil {
+		err = fmt.Errorf("Trie.ReadFieldNames: %w", err)
+	}
+	return
+}
+
+// Terms of a query scoped to one field, like "title:vertigo".
+type fieldTerm struct {
+	id         int      // Id of the field.
+	prefix     string   // Prefix of the terms of the field (see fieldPrefix).
+	field      string   // The field as found in the query.
+	terms      []string // Normalized terms.
+	incomplete bool     // If the last term is potentially incomplete.
+}
+
+// It extracts from the query all the words in the form "field:terms" where
+// field is one of the given ones, a map from field key (see fieldKey) to field
+// id. Words referring to unknown fields are left in the query as they are.
+//
+// It returns:
+// - the terms scoped to a field, the last one is potentially incomplete if it
+//   ends the query.
+// - the remaining query, where each extracted word is replaced by a space.
+func extractFieldTerms(query string, tokenizer Tokenizer,
+	fields map[string]int) (fieldTerms []fieldTerm, remaining string) {
+
+	if len(fields) == 0 || strings.IndexByte(query, ':') < 0 {
+		remaining = query
+		return
+	}
+
+	var rest strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := query[start:end]
+		colon := strings.IndexByte(word, ':')
+		id, ok := -1, false
+		if colon > 0 {
+			id, ok = fields[fieldKey(word[:colon], tokenizer)]
+		}
+		if !ok {
+			rest.WriteString(word)
+		} else {
+			rest.WriteByte(' ')
+			terms := tokenizer.Apply(word[colon+1:])
+			if len(terms) > 0 {
+				fieldTerms = append(fieldTerms, fieldTerm{
+					id:         id,
+					prefix:     fieldPrefix(id),
+					field:      word[:colon],
+					terms:      terms,
+					incomplete: end == len(query)})
+			}
+		}
+		start = -1
+	}
+
+	for i, r := range query {
+		if unicode.IsSpace(r) {
+			flush(i)
+			rest.WriteRune(r)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	flush(len(query))
+
+	remaining = rest.String()
+	return
+}
+
+// It returns the postings of the documents containing the given term, or any
+// term having it as a prefix.
+func termPostings(cursor *Cursor, term string, isPrefix bool) (
+	postings []int, err error) {
+
+	var node Node
+	node, err = cursor.matchTerm(term)
+	if err != nil || (node.NumPostings == 0 && node.NumEdges == 0) {
+		return
+	}
+
+	if isPrefix {
+		postings, err = cursor.ReadAllPostingsRecursive()
+	} else if node.NumPostings > 0 {
+		postings, err = cursor.ReadAllPostings()
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// Like termPostings but the postings are decoded lazily.
+//
+// It returns:
+// - an iterator on the postings, nil if the term is not found.
+// - an error in case of failure.
+func termPostingIterator(cursor *Cursor, term string, isPrefix bool) (
+	iterator PostingIterator, err error) {
+
+	var node Node
+	node, err = cursor.matchTerm(term)
+	if err != nil || (node.NumPostings == 0 && node.NumEdges == 0) {
+		return
+	}
+
+	if isPrefix {
+		iterator, err = cursor.PrefixPostingIterator(node)
+	} else if node.NumPostings > 0 {
+		iterator, err = cursor.PostingIterator(node)
+	}
+	return
+}
+
+// It returns the fields of the index, a map from field key (see fieldKey) to
+// field id, loading them at the first call.
+func (idx *indexImpl) fieldIds() (fields map[string]int, err error) {
+
+	idx.fieldsOnce.Do(func() {
+		var names []string
+		names, idx.fieldsErr = idx.trie.ReadFieldNames()
+		if idx.fieldsErr != nil {
+			return
+		}
+		idx.fields = make(map[string]int, len(names))
+		for id, name := range names {
+			idx.fields[fieldKey(name, idx.tokenizer)] = id
+		}
+	})
+
+	fields, err = idx.fields, idx.fieldsErr
+	return
+}
@@ -0,0 +1,250 @@
+package smartsearch
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFieldNames_EncodeDecode(t *testing.T) {
+
+	names := []string{"title", "director", "", "Fun Facts"}
+	decoded, err := DecodeFieldNames(EncodeFieldNames(names))
+	if err != nil {
+		t.Errorf("DecodeFieldNames failed: %v", err)
+	} else if !reflect.DeepEqual(decoded, names) {
+		t.Errorf("Unexpected names: %v", decoded)
+	}
+
+	// Corrupted data:
+	encoded := EncodeFieldNames(names)
+	for _, corrupted := range [][]byte{encoded[:len(encoded)-1],
+		append(encoded, 0), {5, 1, 'a'}, {1, 1, 0xFF}} {
+		_, err = DecodeFieldNames(corrupted)
+		if err == nil {
+			t.Errorf("An error was expected decoding %v", corrupted)
+		}
+	}
+}
+
+func TestExtractFieldTerms(t *testing.T) {
+
+	tokenizer := NewTokenizer()
+	fields := map[string]int{"title": 0, "funfacts": 1}
+	fieldTerms, remaining := extractFieldTerms(
+		"Title:Vertigo psycho year:1958 fun_facts:rear-win", tokenizer,
+		fields)
+
+	expected := []fieldTerm{
+		{0, fieldPrefix(0), "Title", []string{"vertigo"}, false},
+		{1, fieldPrefix(1), "fun_facts", []string{"rear", "win"}, true}}
+	if !reflect.DeepEqual(fieldTerms, expected) {
+		t.Errorf("Unexpected field terms: %v", fieldTerms)
+	}
+	if remaining != "  psycho year:1958  " {
+		t.Errorf("Unexpected remaining query: [%v]", remaining)
+	}
+}
+
+func TestIndex_SearchFields(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.SetScopedFields(true)
+	builder.AddDocumentFields(1, []Field{
+		{"title", "Vertigo"},
+		{"director", "Alfred Hitchcock"}})
+	builder.AddDocumentFields(2, []Field{
+		{"title", "Hitchcock"},
+		{"director", "Sacha Gervasi"}})
+	builder.AddDocumentFields(3, []Field{
+		{"title", "Rear Window"},
+		{"director", "Alfred Hitchcock"}})
+	builder.AddDocument(4, "vertigo hitchcock")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	queries := []string{"title:vertigo director:hitchcock", "hitchcock ",
+		"title:hitchcock", "director:alf", "title:rear director:",
+		"vertigo unknown:x", "title:rear window", "title:"}
+	all_expected_postings := [][]int{{1}, {1, 2, 3, 4}, {2}, {1, 3}, {3},
+		nil, {3}, {1, 2, 3, 4}}
+	for i, query := range queries {
+		postings, err := index.Search(query, -1)
+		if err != nil {
+			t.Errorf("Search failed with query %v: %v", query, err)
+		} else if !reflect.DeepEqual(postings, all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query [%v]: postings=%v", query,
+				postings)
+		}
+	}
+
+	// Boolean query language:
+	postings, err := index.SearchQuery("title:vertigo OR title:rear", -1)
+	if err != nil {
+		t.Errorf("SearchQuery failed: %v", err)
+	} else if !reflect.DeepEqual(postings, []int{1, 3}) {
+		t.Errorf("Unexpected result: postings=%v", postings)
+	}
+	_, err = index.SearchQuery("year:1958", -1)
+	var fieldErr UnknownFieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "year" {
+		t.Errorf("UnknownFieldError was expected: %v", err)
+	}
+
+	// Field terms are not suggested:
+	suggestions, err := index.Suggest("", -1)
+	if err != nil {
+		t.Errorf("Suggest failed: %v", err)
+	}
+	for _, suggestion := range suggestions {
+		for _, r := range suggestion.Term {
+			if isFieldRune(r) {
+				t.Errorf("Unexpected suggestion: %q", suggestion.Term)
+			}
+		}
+	}
+}
+
+func TestIndex_SearchRankedWithBoosts(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.SetScopedFields(true)
+	builder.AddDocumentFields(1, []Field{
+		{"title", "The Birds"},
+		{"plot", "A woman moves to a town attacked by birds and birds"}})
+	builder.AddDocumentFields(2, []Field{
+		{"title", "Birds"},
+		{"plot", "A documentary"}})
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	results, err := index.SearchRankedWithBoosts("birds", nil, -1)
+	if err != nil {
+		t.Errorf("SearchRankedWithBoosts failed: %v", err)
+	} else if !reflect.DeepEqual(results.Postings(), []int{1, 2}) {
+		t.Errorf("Unexpected result: results=%v", results)
+	}
+
+	// A match in the title counts more:
+	boosts := FieldBoosts{"Title": 10}
+	results, err = index.SearchRankedWithBoosts("birds", boosts, -1)
+	if err != nil {
+		t.Errorf("SearchRankedWithBoosts failed: %v", err)
+	} else if !reflect.DeepEqual(results.Postings(), []int{2, 1}) {
+		t.Errorf("Unexpected result: results=%v", results)
+	}
+
+	// Field scoped terms:
+	results, err = index.SearchRankedWithBoosts("plot:doc", boosts, -1)
+	if err != nil {
+		t.Errorf("SearchRankedWithBoosts failed: %v", err)
+	} else if !reflect.DeepEqual(results.Postings(), []int{2}) {
+		t.Errorf("Unexpected result: results=%v", results)
+	}
+
+	// Invalid boosts:
+	_, err = index.SearchRankedWithBoosts("birds", FieldBoosts{"year": 2}, -1)
+	var fieldErr UnknownFieldError
+	if !errors.As(err, &fieldErr) {
+		t.Errorf("UnknownFieldError was expected: %v", err)
+	}
+	_, err = index.SearchRankedWithBoosts("birds", FieldBoosts{"plot": -1},
+		-1)
+	if err == nil {
+		t.Error("An error was expected with a negative boost")
+	}
+}
+
+func TestIndex_SearchPhraseAcrossFields(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocumentFields(1, []Field{
+		{"title", "Golden"},
+		{"description", "Gate park"}})
+	builder.AddDocument(2, "Golden Gate")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	raw := buf.Bytes()
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	// Phrases do not match across fields, whatever the slop:
+	queries := []string{`"golden gate"`, `"golden gate"~100`,
+		`"golden gate"~1000`, `"gate park"`, `"golden park"~10`}
+	all_expected_postings := [][]int{{2}, {2}, {2}, {1}, nil}
+	for i, query := range queries {
+		postings, err := index.Search(query, -1)
+		if err != nil {
+			t.Errorf("Search failed with query %v: %v", query, err)
+		} else if !reflect.DeepEqual(postings, all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query [%v]: postings=%v", query,
+				postings)
+		}
+	}
+
+	// Lengths count only the terms, without the gaps between fields:
+	trie, err := NewTrie(raw)
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	lengths, err := trie.ReadDocumentLengths()
+	if err != nil || lengths[1] != 3 || lengths[2] != 2 {
+		t.Errorf("Unexpected lengths: %v, err=%v", lengths, err)
+	}
+}
+
+func TestIndex_SearchFieldsNotScoped(t *testing.T) {
+
+	// Fields are indexed for their own only on demand, as they take space:
+	var sizes []int
+	var indices []Index
+	for _, scoped := range []bool{false, true} {
+		builder := NewIndexBuilder()
+		builder.SetScopedFields(scoped)
+		builder.AddDocumentFields(1, []Field{
+			{"title", "Vertigo"},
+			{"director", "Alfred Hitchcock"}})
+		builder.AddDocument(2, "vertigo hitchcock")
+
+		buf := new(bytes.Buffer)
+		builder.Dump(buf)
+		sizes = append(sizes, buf.Len())
+		index, _, err := NewIndex(buf)
+		if err != nil {
+			t.Fatalf("Cannot create index: %v", err)
+		}
+		indices = append(indices, index)
+	}
+	if sizes[0] >= sizes[1] {
+		t.Errorf("Scoped fields take no space: %v", sizes)
+	}
+
+	// The index has no fields, field names are left in the query:
+	postings, err := indices[0].Search("hitchcock ", -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+	postings, err = indices[0].Search("title:vertigo", -1)
+	if err != nil || len(postings) != 0 {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+	_, err = indices[0].SearchRankedWithBoosts("vertigo",
+		FieldBoosts{"title": 2}, -1)
+	if !errors.As(err, new(UnknownFieldError)) {
+		t.Errorf("UnknownFieldError was expected: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package smartsearch
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Options for a fuzzy (typo-tolerant) match over the trie.
+type FuzzyOptions struct {
+	// Maximum edit distance between the searched term and a matching term.
+	MaxDistance int
+
+	// If true swapping 2 adjacent runes costs 1 edit instead of 2.
+	Transpositions bool
+
+	// If true the searched term is considered a prefix: a node matches when
+	// the path leading to it is within MaxDistance from the searched term,
+	// and all the terms of its sub-trie match with it.
+	Prefix bool
+}
+
+// It represents one term found with a fuzzy match.
+type FuzzyMatch struct {
+	Term     string // The matching term as found in the trie.
+	Distance int    // Edit distance between the searched term and Term.
+	Node     Node   // The trie node reached by Term.
+}
+
+// It returns the maximum edit distance that makes sense for the given term,
+// never above maxDistance.
+//
+// Short terms get fewer edits, otherwise a typo on a term of 1 or 2 runes would
+// match almost everything:
+// - 0 edits for terms up to 2 runes.
+// - 1 edit for terms up to 5 runes.
+// - 2 edits for longer terms.
+func FuzzyDistanceFor(term string, maxDistance int) (distance int) {
+
+	numRunes := len([]rune(term))
+	if numRunes > 5 {
+		distance = 2
+	} else if numRunes > 2 {
+		distance = 1
+	}
+
+	if distance > maxDistance {
+		distance = maxDistance
+	}
+	return
+}
+
+// It traverses the trie from the root node and collects all the terms that are
+// within options.MaxDistance edits (Levenshtein distance) from the given term.
+//
+// Edits are insertions, deletions, substitutions of runes and, optionally,
+// transpositions of adjacent runes. Sub-tries that cannot lead to any match
+// within the allowed distance are not visited at all.
+//
+// At the end of the traversal the cursor is left in an undefined position,
+// methods Reset or JumpNode can be used to continue using it.
+//
+// It returns:
+// - all the matches, sorted by term.
+// - an error in case of failure.
+func (c *Cursor) MatchFuzzy(term string, options FuzzyOptions) (
+	matches []FuzzyMatch, err error) {
+
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.MatchFuzzy('%v'): %v", term, err)
+		}
+	}()
+
+	var root Node
+	root, err = c.Reset()
+	if err != nil {
+		return
+	}
+
+	m := fuzzyMatcher{
+		cursor:  c,
+		term:    []rune(term),
+		options: options}
+
+	// Distances of the term's prefixes from the empty string:
+	row := make([]int, len(m.term)+1)
+	for i := range row {
+		row[i] = i
+	}
+
+	if m.accept(root, row) {
+		return m.matches, nil
+	}
+
+	err = m.visit(nil, row)
+	if err == nil {
+		matches = m.matches
+	}
+	return
+}
+
+// Used to implement Cursor.MatchFuzzy.
+type fuzzyMatcher struct {
+	cursor  *Cursor
+	term    []rune
+	options FuzzyOptions
+	path    []rune
+	matches []FuzzyMatch
+}
+
+// It tells if the current node is a match and, in such case, it appends it to
+// the result.
+//
+// It returns true if the sub-trie of the node must not be visited because it
+// is already part of the match.
+func (m *fuzzyMatcher) accept(node Node, row []int) (done bool) {
+
+	distance := row[len(m.term)]
+	if distance > m.options.MaxDistance {
+		return
+	}
+
+	if m.options.Prefix || node.NumPostings > 0 {
+		m.matches = append(m.matches,
+			FuzzyMatch{string(m.path), distance, node})
+	}
+
+	done = m.options.Prefix
+	return
+}
+
+// It visits recursively the sub-nodes of the current node, given the rows of
+// edit distances for the current node (row) and for its parent (parentRow).
+func (m *fuzzyMatcher) visit(parentRow []int, row []int) (err error) {
+
+	var edges []Edge
+	edges, err = m.cursor.ReadAllEdges()
+	if err == io.EOF {
+		return nil // No sub-nodes.
+	} else if err != nil {
+		return
+	}
+
+	for _, edge := range edges {
+
+		if isFieldRune(edge.Rune) {
+			continue // Terms of one field, they are never matched.
+		}
+
+		depth := len(m.path)
+		err = m.visitEdge(edge, parentRow, row)
+		m.path = m.path[:depth]
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// It visits the node targeted by the given edge, given the rows of edit
+// distances for the current node (row) and for its parent (parentRow).
+//
+// With FeatureRadixEdges the runes of the label are matched one by one, each
+// one leading to a virtual node that can be a match with options.Prefix.
+func (m *fuzzyMatcher) visitEdge(edge Edge, parentRow []int, row []int) (
+	err error) {
+
+	label := edge.Suffix
+	r := edge.Rune
+	for {
+		childRow := m.nextRow(parentRow, row, r)
+		if minInts(childRow) > m.options.MaxDistance {
+			return // Nothing can match from here.
+		}
+		m.path = append(m.path, r)
+
+		if label == "" {
+			var node Node
+			node, err = m.cursor.EnterNode(edge)
+			if err == nil && !m.accept(node, childRow) {
+				err = m.visit(row, childRow)
+			}
+			return
+		} else if m.accept(midEdgeNode(edge, label), childRow) {
+			return
+		}
+
+		var size int
+		r, size = utf8.DecodeRuneInString(label)
+		label = label[size:]
+		parentRow, row = row, childRow
+	}
+}
+
+// It computes the row of edit distances after appending the given rune to the
+// current path.
+func (m *fuzzyMatcher) nextRow(parentRow []int, row []int, r rune) []int {
+
+	depth := len(m.path) + 1
+	nextRow := make([]int, len(row))
+	nextRow[0] = depth
+	for i := 1; i < len(row); i++ {
+		cost := 1
+		if m.term[i-1] == r {
+			cost = 0
+		}
+
+		value := row[i] + 1 // Insertion
+		if nextRow[i-1]+1 < value {
+			value = nextRow[i-1] + 1 // Deletion
+		}
+		if row[i-1]+cost < value {
+			value = row[i-1] + cost // Substitution
+		}
+
+		// Transposition of the 2 last runes:
+		if m.options.Transpositions && i > 1 && parentRow != nil &&
+			m.term[i-1] == m.path[depth-2] && m.term[i-2] == r &&
+			parentRow[i-2]+1 < value {
+			value = parentRow[i-2] + 1
+		}
+
+		nextRow[i] = value
+	}
+
+	return nextRow
+}
+
+// It returns the minimum value from a non empty slice.
+func minInts(values []int) (min int) {
+	min = values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return
+}
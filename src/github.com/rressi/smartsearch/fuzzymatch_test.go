@@ -0,0 +1,126 @@
+package smartsearch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func makeFuzzyTestTrie(t *testing.T, features IndexFeatures) *Cursor {
+
+	builder := NewTrieBuilderWithFeatures(features)
+	builder.Add(1, "jayendra")
+	builder.Add(2, "jayanth")
+	builder.Add(3, "java")
+	builder.Add(4, "nithya")
+	builder.Add(5, "vertigo")
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Error while dumping: %v", err)
+	}
+
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	cursor, _ := trie.Root()
+	return cursor
+}
+
+func matchedTerms(matches []FuzzyMatch) (terms []string, distances []int) {
+	for _, match := range matches {
+		terms = append(terms, match.Term)
+		distances = append(distances, match.Distance)
+	}
+	return
+}
+
+func TestCursor_MatchFuzzy(t *testing.T) {
+	testCursor_MatchFuzzy(t, 0)
+	testCursor_MatchFuzzy(t, FeatureRadixEdges)
+}
+
+func testCursor_MatchFuzzy(t *testing.T, features IndexFeatures) {
+
+	reader := makeFuzzyTestTrie(t, features)
+
+	cases := []struct {
+		term              string
+		options           FuzzyOptions
+		expectedTerms     []string
+		expectedDistances []int
+	}{
+		{"jayandra", FuzzyOptions{MaxDistance: 0}, nil, nil},
+		{"jayendra", FuzzyOptions{MaxDistance: 0},
+			[]string{"jayendra"}, []int{0}},
+		{"jayandra", FuzzyOptions{MaxDistance: 1},
+			[]string{"jayendra"}, []int{1}},
+		{"jaeyndra", FuzzyOptions{MaxDistance: 1}, nil, nil},
+		{"jaeyndra", FuzzyOptions{MaxDistance: 1, Transpositions: true},
+			[]string{"jayendra"}, []int{1}},
+		{"jaeyndra", FuzzyOptions{MaxDistance: 2},
+			[]string{"jayendra"}, []int{2}},
+		{"nitya", FuzzyOptions{MaxDistance: 1},
+			[]string{"nithya"}, []int{1}},
+		{"vertiog", FuzzyOptions{MaxDistance: 1, Transpositions: true},
+			[]string{"vertigo"}, []int{1}},
+		{"jaya", FuzzyOptions{MaxDistance: 1, Prefix: true},
+			[]string{"java", "jay"}, []int{1, 1}},
+		{"jaya", FuzzyOptions{MaxDistance: 0, Prefix: true},
+			[]string{"jaya"}, []int{0}},
+		{"x", FuzzyOptions{MaxDistance: 1, Prefix: true},
+			[]string{""}, []int{1}},
+	}
+
+	for _, c := range cases {
+		matches, err := reader.MatchFuzzy(c.term, c.options)
+		terms, distances := matchedTerms(matches)
+		if err != nil {
+			t.Errorf("MatchFuzzy('%v') failed: %v", c.term, err)
+		} else if !reflect.DeepEqual(terms, c.expectedTerms) ||
+			!reflect.DeepEqual(distances, c.expectedDistances) {
+			t.Errorf("Unexpected matches for '%v' %+v (features %v): %v %v",
+				c.term, c.options, features, terms, distances)
+		}
+	}
+
+	// Matched nodes can be used to fetch the postings:
+	matches, _ := reader.MatchFuzzy("jayandra", FuzzyOptions{MaxDistance: 1})
+	if len(matches) != 1 {
+		t.Fatalf("Unexpected matches: %v", matches)
+	}
+	reader.JumpNode(matches[0].Node)
+	postings, err := reader.ReadAllPostings()
+	if err != nil || !reflect.DeepEqual(postings, []int{1}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+
+	// Also the ones in the middle of an edge with FeatureRadixEdges:
+	matches, _ = reader.MatchFuzzy("jajen", FuzzyOptions{MaxDistance: 1,
+		Prefix: true})
+	if len(matches) != 1 || matches[0].Term != "jayen" {
+		t.Fatalf("Unexpected matches: %v", matches)
+	}
+	reader.JumpNode(matches[0].Node)
+	postings, err = reader.ReadAllPostingsRecursive()
+	if err != nil || !reflect.DeepEqual(postings, []int{1}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+}
+
+func TestFuzzyDistanceFor(t *testing.T) {
+
+	terms := []string{"", "ab", "abc", "abcde", "abcdef", "àèìòùé"}
+	expected := []int{0, 0, 1, 1, 2, 2}
+	for i, term := range terms {
+		if distance := FuzzyDistanceFor(term, 3); distance != expected[i] {
+			t.Errorf("Unexpected distance for '%v': %v", term, distance)
+		}
+	}
+
+	if distance := FuzzyDistanceFor("abcdef", 1); distance != 1 {
+		t.Errorf("Unexpected distance: %v", distance)
+	}
+}
@@ -0,0 +1,347 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Nodes and edges are marshaled in binary form as:
+//
+//   [kind: 1 byte] [trie: 8 bytes little endian] [values: UVarint...]
+//   [size of label: UVarint] [label: UTF-8]
+//
+// where kind tells a node ('N') from an edge ('E'), trie is the identity of
+// their trie (size and 32-bit CRC, see Trie.Identity) and values are, for a
+// node, the number of postings, the number of edges, the occurrences and the
+// offsets of the postings and of the edges; for an edge, the rune and the
+// offset of its node. The label, only with FeatureRadixEdges and when not
+// empty, is the rest of the label of a virtual node or the suffix of an edge.
+const (
+	nodeHandleKind = 'N'
+	edgeHandleKind = 'E'
+)
+
+// The trie of a node or of an edge: the Trie that decoded it or, once
+// unmarshaled, the identity of that trie.
+//
+// This way the identity of a trie is computed only when needed, that can
+// take reading all its bytes (see Trie.Identity).
+type trieTag struct {
+	trie     *Trie  // The Trie that decoded the handle, nil if unmarshaled.
+	identity uint64 // Identity of the trie of an unmarshaled handle.
+}
+
+// It resolves the identity of the trie of a handle.
+//
+// It returns:
+// - the identity.
+// - an error in case of failure.
+func (tag trieTag) resolve() (identity uint64, err error) {
+	if tag.trie == nil {
+		identity = tag.identity
+		return
+	}
+	return tag.trie.Identity()
+}
+
+// It tells if a handle with this tag can be used with the given trie, that is
+// if it comes from a binary identical trie.
+//
+// It returns:
+// - true if it can.
+// - an error in case of failure.
+func (tag trieTag) belongsTo(trie *Trie) (ok bool, err error) {
+
+	if tag.trie == trie {
+		ok = true
+		return
+	}
+
+	var identity, trieIdentity uint64
+	identity, err = tag.resolve()
+	if err == nil {
+		trieIdentity, err = trie.Identity()
+	}
+	ok = err == nil && identity == trieIdentity
+	return
+}
+
+// It encodes a handle of the given kind with the given label and values.
+func marshalHandle(kind byte, trie uint64, label string,
+	values ...int) []byte {
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(kind)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	binary.LittleEndian.PutUint64(tmp, trie)
+	buf.Write(tmp[:8])
+	for _, value := range values {
+		numBytes := binary.PutUvarint(tmp, uint64(value))
+		buf.Write(tmp[:numBytes])
+	}
+	if label != "" {
+		numBytes := binary.PutUvarint(tmp, uint64(len(label)))
+		buf.Write(tmp[:numBytes])
+		buf.WriteString(label)
+	}
+
+	return buf.Bytes()
+}
+
+// It decodes a handle of the given kind previously encoded by marshalHandle.
+//
+// It returns:
+// - the identity of the trie, the label and the decoded values.
+// - an error in case of failure.
+func unmarshalHandle(kind byte, data []byte, values ...*int) (trie uint64,
+	label string, err error) {
+
+	if len(data) < 9 || data[0] != kind {
+		err = fmt.Errorf("invalid handle of kind '%c'", kind)
+		return
+	}
+	trie_ := binary.LittleEndian.Uint64(data[1:9])
+
+	reader := bytes.NewReader(data[9:])
+	for _, value := range values {
+		var value_ uint64
+		value_, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return
+		} else if value_ > uint64(maxHandleValue) {
+			err = fmt.Errorf("invalid value %v", value_)
+			return
+		}
+		*value = int(value_)
+	}
+	if reader.Len() > 0 {
+		var size uint64
+		size, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return
+		}
+		label_ := data[len(data)-reader.Len():]
+		if size == 0 || size != uint64(len(label_)) || !utf8.Valid(label_) {
+			err = fmt.Errorf("invalid label %q", label_)
+			return
+		}
+		label = string(label_)
+	}
+
+	trie = trie_
+	return
+}
+
+// Maximum value of a field of a handle, offsets of a trie fit an int.
+const maxHandleValue = int(^uint(0) >> 1)
+
+// Implementation of encoding.BinaryMarshaler.
+func (n Node) MarshalBinary() (data []byte, err error) {
+
+	var trie uint64
+	trie, err = n.trie.resolve()
+	if err != nil {
+		err = fmt.Errorf("Node.MarshalBinary: %v", err)
+		return
+	}
+
+	data = marshalHandle(nodeHandleKind, trie, n.label, n.NumPostings,
+		n.NumEdges, n.Occurrences, n.postingsOffset, n.edgesOffset)
+	return
+}
+
+// Implementation of encoding.BinaryUnmarshaler.
+func (n *Node) UnmarshalBinary(data []byte) (err error) {
+
+	var node Node
+	node.trie.identity, node.label, err = unmarshalHandle(nodeHandleKind, data,
+		&node.NumPostings, &node.NumEdges, &node.Occurrences,
+		&node.postingsOffset, &node.edgesOffset)
+	if err != nil {
+		err = fmt.Errorf("Node.UnmarshalBinary: %v", err)
+		return
+	}
+
+	*n = node
+	return
+}
+
+// Implementation of encoding.BinaryMarshaler.
+func (e Edge) MarshalBinary() (data []byte, err error) {
+
+	var trie uint64
+	trie, err = e.trie.resolve()
+	if err != nil {
+		err = fmt.Errorf("Edge.MarshalBinary: %v", err)
+		return
+	}
+
+	data = marshalHandle(edgeHandleKind, trie, e.Suffix, int(e.Rune),
+		e.nodeOffset)
+	return
+}
+
+// Implementation of encoding.BinaryUnmarshaler.
+func (e *Edge) UnmarshalBinary(data []byte) (err error) {
+
+	var edge Edge
+	var r int
+	edge.trie.identity, edge.Suffix, err = unmarshalHandle(edgeHandleKind,
+		data, &r,
+		&edge.nodeOffset)
+	if err == nil && r > 0x10FFFF {
+		err = fmt.Errorf("invalid rune %v", r)
+	}
+	if err != nil {
+		err = fmt.Errorf("Edge.UnmarshalBinary: %v", err)
+		return
+	}
+	edge.Rune = rune(r)
+
+	*e = edge
+	return
+}
+
+// JSON representation of a Node, the identity of the trie is a string of 16
+// hexadecimal digits as it does not fit the integers of JavaScript.
+type nodeJson struct {
+	Trie           string `json:"trie"`
+	NumPostings    int    `json:"postings"`
+	NumEdges       int    `json:"edges"`
+	Occurrences    int    `json:"occurrences"`
+	PostingsOffset int    `json:"postingsOffset"`
+	EdgesOffset    int    `json:"edgesOffset"`
+	Label          string `json:"label,omitempty"`
+}
+
+// JSON representation of an Edge (see nodeJson).
+type edgeJson struct {
+	Trie       string `json:"trie"`
+	Rune       rune   `json:"rune"`
+	Suffix     string `json:"suffix,omitempty"`
+	NodeOffset int    `json:"nodeOffset"`
+}
+
+// It formats the identity of a trie for JSON.
+func formatTrieIdentity(trie uint64) string {
+	return fmt.Sprintf("%016x", trie)
+}
+
+// It parses the identity of a trie formatted by formatTrieIdentity.
+func parseTrieIdentity(trie string) (identity uint64, err error) {
+	identity, err = strconv.ParseUint(trie, 16, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid trie identity '%v'", trie)
+	}
+	return
+}
+
+// Implementation of json.Marshaler.
+func (n Node) MarshalJSON() (data []byte, err error) {
+
+	var trie uint64
+	trie, err = n.trie.resolve()
+	if err != nil {
+		err = fmt.Errorf("Node.MarshalJSON: %v", err)
+		return
+	}
+
+	return json.Marshal(nodeJson{
+		Trie:           formatTrieIdentity(trie),
+		NumPostings:    n.NumPostings,
+		NumEdges:       n.NumEdges,
+		Occurrences:    n.Occurrences,
+		PostingsOffset: n.postingsOffset,
+		EdgesOffset:    n.edgesOffset,
+		Label:          n.label})
+}
+
+// Implementation of json.Unmarshaler.
+func (n *Node) UnmarshalJSON(data []byte) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Node.UnmarshalJSON: %v", err)
+		}
+	}()
+
+	var node nodeJson
+	err = json.Unmarshal(data, &node)
+	if err != nil {
+		return
+	} else if node.NumPostings < 0 || node.NumEdges < 0 ||
+		node.Occurrences < 0 || node.PostingsOffset < 0 ||
+		node.EdgesOffset < 0 {
+		err = fmt.Errorf("negative values in %s", data)
+		return
+	}
+
+	var trie uint64
+	trie, err = parseTrieIdentity(node.Trie)
+	if err != nil {
+		return
+	}
+
+	*n = Node{
+		NumPostings:    node.NumPostings,
+		NumEdges:       node.NumEdges,
+		Occurrences:    node.Occurrences,
+		postingsOffset: node.PostingsOffset,
+		edgesOffset:    node.EdgesOffset,
+		label:          node.Label,
+		trie:           trieTag{identity: trie}}
+	return
+}
+
+// Implementation of json.Marshaler.
+func (e Edge) MarshalJSON() (data []byte, err error) {
+
+	var trie uint64
+	trie, err = e.trie.resolve()
+	if err != nil {
+		err = fmt.Errorf("Edge.MarshalJSON: %v", err)
+		return
+	}
+
+	return json.Marshal(edgeJson{
+		Trie:       formatTrieIdentity(trie),
+		Rune:       e.Rune,
+		Suffix:     e.Suffix,
+		NodeOffset: e.nodeOffset})
+}
+
+// Implementation of json.Unmarshaler.
+func (e *Edge) UnmarshalJSON(data []byte) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Edge.UnmarshalJSON: %v", err)
+		}
+	}()
+
+	var edge edgeJson
+	err = json.Unmarshal(data, &edge)
+	if err != nil {
+		return
+	} else if edge.Rune < 0 || edge.Rune > 0x10FFFF || edge.NodeOffset < 0 {
+		err = fmt.Errorf("invalid values in %s", data)
+		return
+	}
+
+	var trie uint64
+	trie, err = parseTrieIdentity(edge.Trie)
+	if err != nil {
+		return
+	}
+
+	*e = Edge{
+		Rune:       edge.Rune,
+		Suffix:     edge.Suffix,
+		nodeOffset: edge.NodeOffset,
+		trie:       trieTag{identity: trie}}
+	return
+}
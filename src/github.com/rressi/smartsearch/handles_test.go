@@ -0,0 +1,251 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestHandles_Binary(t *testing.T) {
+
+	trie := makeTestTrie(t)
+	cursor, _ := trie.Root()
+	node, err := cursor.Match("AB")
+	if err != nil {
+		t.Fatalf("Match failed: %v", err)
+	}
+	edge, err := cursor.ReadEdge()
+	if err != nil {
+		t.Fatalf("ReadEdge failed: %v", err)
+	}
+
+	data, err := node.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Node.MarshalBinary failed: %v", err)
+	}
+	// Unmarshaled handles keep just the identity of their trie:
+	identity, _ := trie.Identity()
+	tag := trieTag{identity: identity}
+	var decodedNode Node
+	err = decodedNode.UnmarshalBinary(data)
+	if err != nil {
+		t.Errorf("Node.UnmarshalBinary failed: %v", err)
+	} else if decodedNode.trie != tag {
+		t.Errorf("Unexpected trie: %v", decodedNode.trie)
+	}
+	decodedNode.trie = node.trie
+	if decodedNode != node {
+		t.Errorf("Unexpected node: %v", decodedNode)
+	}
+
+	data, err = edge.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Edge.MarshalBinary failed: %v", err)
+	}
+	var decodedEdge Edge
+	err = decodedEdge.UnmarshalBinary(data)
+	if err != nil {
+		t.Errorf("Edge.UnmarshalBinary failed: %v", err)
+	} else if decodedEdge.trie != tag {
+		t.Errorf("Unexpected trie: %v", decodedEdge.trie)
+	}
+	decodedEdge.trie = edge.trie
+	if decodedEdge != edge {
+		t.Errorf("Unexpected edge: %v", decodedEdge)
+	}
+
+	// Corrupted data:
+	nodeData, _ := node.MarshalBinary()
+	for _, corrupted := range [][]byte{nil, nodeData[:9],
+		nodeData[:len(nodeData)-1], append(nodeData, 0), data} {
+		decodedNode = Node{}
+		if decodedNode.UnmarshalBinary(corrupted) == nil {
+			t.Errorf("An error was expected decoding %v", corrupted)
+		} else if decodedNode != (Node{}) {
+			t.Errorf("Unexpected node: %v", decodedNode)
+		}
+	}
+	if decodedEdge.UnmarshalBinary(nodeData) == nil {
+		t.Errorf("An error was expected decoding %v", nodeData)
+	}
+}
+
+func TestHandles_JSON(t *testing.T) {
+
+	trie := makeTestTrie(t)
+	cursor, _ := trie.Root()
+	node, _ := cursor.Match("A")
+	edge, _ := cursor.ReadEdge()
+
+	data, err := json.Marshal(struct {
+		Node Node
+		Edge Edge
+	}{node, edge})
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+
+	var decoded struct {
+		Node Node
+		Edge Edge
+	}
+	err = json.Unmarshal(data, &decoded)
+	identity, _ := trie.Identity()
+	tag := trieTag{identity: identity}
+	if err != nil {
+		t.Errorf("json.Unmarshal failed: %v", err)
+	} else if decoded.Node.trie != tag || decoded.Edge.trie != tag {
+		t.Errorf("Unexpected tries from %s: %v", data, decoded)
+	}
+	decoded.Node.trie, decoded.Edge.trie = node.trie, edge.trie
+	if decoded.Node != node || decoded.Edge != edge {
+		t.Errorf("Unexpected handles from %s: %v", data, decoded)
+	}
+
+	// Invalid data:
+	for _, corrupted := range []string{`{"trie":"x"}`, `{"postings":-1}`,
+		`[]`} {
+		var node Node
+		if json.Unmarshal([]byte(corrupted), &node) == nil {
+			t.Errorf("An error was expected decoding %v", corrupted)
+		}
+	}
+	for _, corrupted := range []string{`{"trie":"x"}`,
+		`{"trie":"0","rune":-1}`} {
+		var edge Edge
+		if json.Unmarshal([]byte(corrupted), &edge) == nil {
+			t.Errorf("An error was expected decoding %v", corrupted)
+		}
+	}
+}
+
+func TestHandles_JumpNode(t *testing.T) {
+
+	trie := makeTestTrie(t)
+	cursor, _ := trie.Root()
+	node, _ := cursor.Match("AB")
+	data, _ := node.MarshalBinary()
+
+	// Another trie decoded from the same bytes, like another service would do:
+	buf := new(bytes.Buffer)
+	builder := NewTrieBuilder()
+	builder.Add(1, "ABC")
+	builder.Add(2, "ABD")
+	builder.Add(3, "AC")
+	builder.Add(4, "B")
+	builder.Dump(buf)
+	src := bytes.NewReader(buf.Bytes())
+	sameTrie, err := NewTrieAt(src, src.Size())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	identity, err := trie.Identity()
+	if err != nil {
+		t.Fatalf("Identity failed: %v", err)
+	}
+	if sameIdentity, err := sameTrie.Identity(); sameIdentity != identity {
+		t.Errorf("Unexpected identity: %x, err=%v", sameIdentity, err)
+	}
+
+	var decoded Node
+	decoded.UnmarshalBinary(data)
+	other, _ := sameTrie.Root()
+	err = other.JumpNode(decoded)
+	if err != nil {
+		t.Errorf("JumpNode failed: %v", err)
+	}
+	postings, err := other.ReadAllPostingsRecursive()
+	if err != nil || len(postings) != 2 {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+
+	// Handles of a different trie are refused:
+	foreignTrie, err := NewTrie([]byte{2, 0, 2, 1, 1})
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	foreignIdentity, _ := foreignTrie.Identity()
+	if foreignIdentity == identity {
+		t.Errorf("Unexpected identity: %x", foreignIdentity)
+	}
+	foreign, _ := foreignTrie.Root()
+	err = foreign.JumpNode(decoded)
+	if !errors.Is(err, ForeignHandle) {
+		t.Errorf("ForeignHandle was expected: %v", err)
+	}
+
+	cursor.Reset()
+	edge, _ := cursor.ReadEdge()
+	_, err = foreign.EnterNode(edge)
+	if !errors.Is(err, ForeignHandle) {
+		t.Errorf("ForeignHandle was expected: %v", err)
+	}
+}
+
+// An io.ReaderAt counting the bytes read from it.
+type countingReaderAt struct {
+	src       io.ReaderAt
+	readBytes int
+}
+
+// Implementation of io.ReaderAt.
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	n, err = r.src.ReadAt(p, off)
+	r.readBytes += n
+	return
+}
+
+func TestHandles_LazyIdentity(t *testing.T) {
+
+	builder := NewTrieBuilder()
+	for i := 1; i <= 1000; i++ {
+		builder.Add(i, fmt.Sprintf("term%d", i))
+	}
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+
+	// A trie without header is not read to compute its identity until a
+	// handle is used with another trie or marshaled:
+	src := &countingReaderAt{src: bytes.NewReader(buf.Bytes())}
+	trie, err := NewTrieAt(src, int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	cursor, _ := trie.Root()
+	node, err := cursor.Match("term42")
+	if err == nil {
+		err = cursor.JumpNode(node)
+	}
+	if err != nil {
+		t.Fatalf("Cannot match term: %v", err)
+	} else if src.readBytes >= buf.Len() {
+		t.Errorf("Unexpected read bytes: %v of %v", src.readBytes, buf.Len())
+	}
+
+	data, err := node.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Node.MarshalBinary failed: %v", err)
+	} else if src.readBytes < buf.Len() {
+		t.Errorf("Unexpected read bytes: %v of %v", src.readBytes, buf.Len())
+	}
+
+	// The identity is the one of the same bytes in memory:
+	sameTrie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	var decoded Node
+	decoded.UnmarshalBinary(data)
+	other, _ := sameTrie.Root()
+	err = other.JumpNode(decoded)
+	if err != nil {
+		t.Errorf("JumpNode failed: %v", err)
+	}
+	err = other.JumpNode(node)
+	if err != nil {
+		t.Errorf("JumpNode failed: %v", err)
+	}
+}
@@ -145,6 +145,29 @@ func ServeDocuments(docs JsonDocuments) http.Handler {
 // -----------------------------------------------------------------------------
 
 // Creates an http.Handler to search using the given index.
+//
+// The web API exposed by this handler accept the following arguments:
+// - q: the query.
+// - l: a positive integer to limit the number of returned postings.
+// - fuzzy: a positive integer to tolerate typos, it is the maximum edit
+//   distance allowed between each term of the query and an indexed term (see
+//   Index.SearchFuzzy). Whatever its value terms up to 2 characters tolerate
+//   no typo, terms up to 5 characters 1 typo and longer terms at most 2.
+// - sort: either "id" (default) to sort the postings by document id or
+//   "relevance" to sort them from the most relevant (see Index.SearchRanked).
+//   Only the postings are returned, in order of relevance, without their
+//   scores. Sorting by relevance cannot be combined with argument fuzzy.
+// - boost: the boosts of the fields when sorting by relevance, as a comma
+//   separated list of field:boost, like "title:3,director:2" (see
+//   Index.SearchRankedWithBoosts).
+// - syntax: either "simple" (default) or "boolean" to write the query with the
+//   boolean query language (see Index.SearchQuery). The boolean syntax cannot
+//   be combined with other arguments but l.
+// - session: the token of a search session, empty to start a new one, to
+//   search as the user types reusing the work done for the previous query
+//   (see SearchSession). The token to be passed with the next query is
+//   returned with header X-Session-Token. Search sessions cannot be combined
+//   with arguments fuzzy, sort and syntax.
 func ServeSearch(index Index) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -185,8 +208,130 @@ func ServeSearch(index Index) http.HandlerFunc {
 			return
 		}
 
+		var fuzzy int
+		fuzzy, err = parseNumericalArgument("fuzzy", values)
+		if err != nil {
+			httpError = http.StatusBadRequest
+			return
+		}
+
+		var sortBy string
+		sortValues, sortOk := values["sort"]
+		if !sortOk {
+			sortBy = "id"
+		} else if len(sortValues) != 1 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'sort' passed more than once")
+			return
+		} else {
+			sortBy = sortValues[0]
+		}
+		if sortBy != "id" && sortBy != "relevance" {
+			httpError = http.StatusBadRequest
+			err = fmt.Errorf("Invalid value for parameter 'sort': '%v'", sortBy)
+			return
+		} else if sortBy == "relevance" && fuzzy > 0 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'sort=relevance' cannot be combined " +
+				"with 'fuzzy'")
+			return
+		}
+
+		var boosts FieldBoosts
+		boostValues, boostOk := values["boost"]
+		if !boostOk {
+			// pass
+		} else if len(boostValues) != 1 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'boost' passed more than once")
+			return
+		} else if sortBy != "relevance" {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'boost' requires 'sort=relevance'")
+			return
+		} else {
+			boosts, err = parseFieldBoosts(boostValues[0])
+			if err != nil {
+				httpError = http.StatusBadRequest
+				return
+			}
+		}
+
+		var syntax string
+		syntaxValues, syntaxOk := values["syntax"]
+		if !syntaxOk {
+			syntax = "simple"
+		} else if len(syntaxValues) != 1 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'syntax' passed more than once")
+			return
+		} else {
+			syntax = syntaxValues[0]
+		}
+		if syntax != "simple" && syntax != "boolean" {
+			httpError = http.StatusBadRequest
+			err = fmt.Errorf("Invalid value for parameter 'syntax': '%v'",
+				syntax)
+			return
+		} else if syntax == "boolean" && (sortBy != "id" || fuzzy > 0) {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'syntax=boolean' cannot be combined " +
+				"with 'sort' or 'fuzzy'")
+			return
+		}
+
+		var session *SearchSession
+		sessionValues, sessionOk := values["session"]
+		if !sessionOk {
+			// pass
+		} else if len(sessionValues) != 1 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'session' passed more than once")
+			return
+		} else if syntax != "simple" || sortBy != "id" || fuzzy > 0 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'session' cannot be combined with " +
+				"'syntax', 'sort' or 'fuzzy'")
+			return
+		} else {
+			session, err = index.NewSearchSession(sessionValues[0])
+			if errors.Is(err, InvalidSessionToken) {
+				httpError = http.StatusBadRequest
+				return
+			} else if err != nil {
+				return
+			}
+		}
+
 		var postings []int
-		postings, err = index.Search(query, limit)
+		if session != nil {
+			postings, err = session.Search(query, limit)
+			if err == nil {
+				w.Header().Set("X-Session-Token", session.Token())
+			}
+		} else if syntax == "boolean" {
+			postings, err = index.SearchQuery(query, limit)
+			var syntaxErr QuerySyntaxError
+			var fieldErr UnknownFieldError
+			if errors.As(err, &syntaxErr) || errors.As(err, &fieldErr) {
+				httpError = http.StatusBadRequest
+				return
+			}
+		} else if sortBy == "relevance" {
+			var results ScoredPostings
+			results, err = index.SearchRankedWithBoosts(query, boosts, limit)
+			var fieldErr UnknownFieldError
+			if errors.As(err, &fieldErr) {
+				httpError = http.StatusBadRequest
+				return
+			}
+			postings = results.Postings()
+		} else if fuzzy > 0 {
+			options := FuzzyOptions{MaxDistance: fuzzy, Transpositions: true}
+			postings, err = index.SearchFuzzy(query, options, limit)
+		} else {
+			postings, err = index.Search(query, limit)
+		}
 		if err != nil {
 			httpError = http.StatusNotFound
 			return
@@ -212,6 +357,122 @@ func ServeSearch(index Index) http.HandlerFunc {
 
 // -----------------------------------------------------------------------------
 
+// Default number of suggestions returned by ServeSuggest.
+const defaultNumSuggestions = 10
+
+// Creates an http.Handler to suggest completions using the given index.
+//
+// The web API exposed by this handler accept the following arguments:
+// - q: the text typed so far, its last term is completed.
+// - l: a positive integer to limit the number of returned suggestions (10 by
+//   default).
+//
+// This handler returns a JSON list of objects with the completed term and the
+// number of documents containing it, from the most frequent one (see
+// Index.Suggest).
+func ServeSuggest(index Index) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var httpError = http.StatusInternalServerError
+		var err error
+		defer func() {
+			if err != nil {
+				err = fmt.Errorf("ServeSuggest: %v", err)
+				if httpError != 0 {
+					w.WriteHeader(httpError)
+				}
+			}
+		}()
+
+		var values map[string][]string
+		values, err = url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			httpError = http.StatusBadRequest
+			return
+		}
+
+		var query string
+		queryValues, queryOk := values["q"]
+		if !queryOk {
+			// pass
+		} else if len(queryValues) != 1 {
+			httpError = http.StatusBadRequest
+			err = errors.New("Parameter 'q' passed more than once")
+			return
+		} else {
+			query = queryValues[0]
+		}
+
+		var limit int
+		limit, err = parseNumericalArgument("l", values)
+		if err != nil {
+			httpError = http.StatusBadRequest
+			return
+		} else if limit < 0 {
+			limit = defaultNumSuggestions
+		}
+
+		var suggestions Suggestions
+		suggestions, err = index.Suggest(query, limit)
+		if err != nil {
+			httpError = http.StatusNotFound
+			return
+		} else if suggestions == nil {
+			suggestions = make(Suggestions, 0)
+		}
+
+		var buf []byte
+		buf, err = json.Marshal(suggestions)
+		if err != nil {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(buf)
+		if err != nil {
+			return
+		}
+
+		httpError = 0 // Done!
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// Creates an http.Handler returning the statistics of the cache of nodes of
+// the given index as a JSON object (see Index.NodeCacheStats).
+func ServeNodeCacheStats(index Index) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var httpError = http.StatusInternalServerError
+		var err error
+		defer func() {
+			if err != nil {
+				err = fmt.Errorf("ServeNodeCacheStats: %v", err)
+				if httpError != 0 {
+					w.WriteHeader(httpError)
+				}
+			}
+		}()
+
+		var buf []byte
+		buf, err = json.Marshal(index.NodeCacheStats())
+		if err != nil {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(buf)
+		if err != nil {
+			return
+		}
+
+		httpError = 0 // Done!
+	}
+}
+
+// -----------------------------------------------------------------------------
+
 // Just servers passed bytes via http.
 func ServeRawBytes(raw []byte) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -246,12 +507,12 @@ func parseNumericalArgument(name string, values map[string][]string) (
 	if !limitOk {
 		limit_ = -1
 	} else if len(limitValues) != 1 {
-		err = errors.New("Parameter 'limit' passed more than once")
+		err = fmt.Errorf("Parameter '%v' passed more than once", name)
 		return
 	} else {
 		limit_, err = strconv.Atoi(limitValues[0])
 		if err != nil {
-			err = fmt.Errorf("invalid value for parameter 'limit': %v",
+			err = fmt.Errorf("invalid value for parameter '%v': %v", name,
 				limitValues[0])
 			return
 		}
@@ -261,3 +522,31 @@ func parseNumericalArgument(name string, values map[string][]string) (
 	limit = limit_
 	return
 }
+
+// Parses the boosts of the fields from a comma separated list of field:boost,
+// like "title:3,director:2".
+func parseFieldBoosts(value string) (boosts FieldBoosts, err error) {
+
+	boosts_ := make(FieldBoosts)
+	for _, item := range strings.Split(value, ",") {
+		colon := strings.LastIndexByte(item, ':')
+		if colon <= 0 {
+			err = fmt.Errorf("invalid value for parameter 'boost': '%v'",
+				item)
+			return
+		}
+
+		var boost float64
+		boost, err = strconv.ParseFloat(item[colon+1:], 64)
+		if err != nil || boost < 0 {
+			err = fmt.Errorf("invalid boost for field '%v': '%v'",
+				item[:colon], item[colon+1:])
+			return
+		}
+		boosts_[item[:colon]] = boost
+	}
+
+	// Success!
+	boosts = boosts_
+	return
+}
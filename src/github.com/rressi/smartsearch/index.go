@@ -4,23 +4,147 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"sync"
 )
 
 // An interface to search using pre-build indices.
+//
+// An Index is safe for concurrent use by multiple goroutines, like the ones
+// of an HTTP server: each call traverses the trie with its own reader. Only
+// Close must not be called while other calls are in progress.
 type Index interface {
 
 	// Given the passed query, it searches it inside the index and returns all the
 	// postings of matching documents.
 	//
+	// Terms between double quotes are matched as a phrase: they must be found
+	// one after the other, optionally with few extra terms between them if
+	// the quotes are followed by '~' and the number of allowed extra terms (as
+	// in "golden gate"~2). A phrase never matches across the fields of a
+	// document. See ExtractPhrases and Cursor.MatchPhrase.
+	//
+	// Terms preceded by the name of a field and ':' are matched only within
+	// that field (as in "title:vertigo"). Field names are matched ignoring
+	// case and any non alphanumeric character.
+	//
+	// Postings are decoded lazily while intersecting them (see
+	// PostingIterator), so with a limit only the first ones are decoded even
+	// for short prefixes matching most of the index.
+	//
 	// It returns:
 	// - postings of matching documents, sorted and deduplicated.
 	// - an error in case of failure
 	Search(query string, limit int) (postings []int, err error)
+
+	// Like Search but tolerating typos: each term of the query matches all the
+	// indexed terms within an edit distance from it.
+	//
+	// The edit distance used for each term is given by FuzzyDistanceFor, so
+	// that options.MaxDistance is just an upper bound: whatever its value,
+	// terms up to 2 runes need an exact match, terms up to 5 runes tolerate
+	// 1 edit and longer terms at most 2 edits. Option Prefix is ignored, the
+	// potentially incomplete term of the query is always matched as a prefix.
+	//
+	// It returns:
+	// - postings of matching documents, sorted and deduplicated.
+	// - an error in case of failure
+	SearchFuzzy(query string, options FuzzyOptions, limit int) (
+		postings []int, err error)
+
+	// Like Search but the query is written with the boolean query language
+	// (see ParseQuery): terms can be combined with OR, excluded with NOT or
+	// '-' and grouped with parentheses. Only the terms ending with '*' are
+	// matched as prefixes.
+	//
+	// It returns:
+	// - postings of matching documents, sorted and deduplicated.
+	// - a QuerySyntaxError if the query is not well formed.
+	// - an UnknownFieldError if the query refers to an unknown field.
+	// - an error in case of failure
+	SearchQuery(query string, limit int) (postings []int, err error)
+
+	// Like Search but it ranks the matching documents by relevance with the
+	// BM25 function, using how many times each term occurs in each document
+	// and the length of the documents as stored by IndexBuilder.
+	//
+	// The potentially incomplete term of the query counts as all the terms
+	// having it as a prefix. Phrases select the same documents as with
+	// Search, their terms are scored like the other ones.
+	//
+	// It returns:
+	// - matching documents with their score, from the most relevant.
+	// - an error in case of failure
+	SearchRanked(query string, limit int) (results ScoredPostings, err error)
+
+	// Like SearchRanked but the occurrences of the terms in the given fields
+	// count as many times as the boost of their field (see FieldBoosts), so
+	// that for example a match in the title can count more than a match in
+	// the description.
+	//
+	// It returns:
+	// - matching documents with their score, from the most relevant.
+	// - an UnknownFieldError if a boost refers to an unknown field.
+	// - an error in case of failure
+	SearchRankedWithBoosts(query string, boosts FieldBoosts, limit int) (
+		results ScoredPostings, err error)
+
+	// It completes the last term of the passed text with the indexed terms
+	// that have it as a prefix, as needed by a search-as-you-type drop-down.
+	//
+	// Nothing is suggested if the text ends with a separator.
+	//
+	// It returns:
+	// - at most n suggestions (all of them if n is negative), from the ones
+	//   found on more documents.
+	// - an error in case of failure.
+	Suggest(prefix string, n int) (suggestions Suggestions, err error)
+
+	// It creates a session to search as the user types, where each query
+	// reuses the work done for the previous one (see SearchSession).
+	//
+	// The session continues from the given token, as returned by
+	// SearchSession.Token, or starts from scratch if it is empty. A token of
+	// another index is accepted but it is useless.
+	//
+	// It returns:
+	// - the newly created session.
+	// - InvalidSessionToken if the token is not valid.
+	NewSearchSession(token string) (session *SearchSession, err error)
+
+	// It enables a cache of the nodes matched by the terms of the queries,
+	// so that frequent terms and prefixes, like the first letters typed in a
+	// search-as-you-type box, are not matched from the root of the trie at
+	// each query.
+	//
+	// The cache keeps at most the given number of nodes, discarding the least
+	// recently used ones; with 0 the cache is disabled. Like Close, it must
+	// not be called concurrently with any other call.
+	SetNodeCache(size int)
+
+	// It returns the statistics of the cache enabled with SetNodeCache, all
+	// zero if there is none.
+	NodeCacheStats() (stats NodeCacheStats)
+
+	// It releases the resources held by the index, like memory mappings.
+	//
+	// The index and the raw bytes returned together with it cannot be used
+	// after this call, that must not be concurrent with any other.
+	Close() error
 }
 
 // Given the passed io.Reader, loads an index previously generated with
 // IndexBuilder.
 //
+// The index header is validated, an index generated with an unknown version
+// of the binary format is refused with an UnsupportedVersionError while
+// anything that is not an index is refused with NotAnIndex.
+//
+// Queries are split in terms by the analyzer used to build the index, created
+// again from its configuration stored in the index: an index built with an
+// analyzer that has not been registered is refused with an
+// UnknownAnalyzerError (see RegisterAnalyzer).
+//
 // It returns:
 // - the newly created index.
 // - the bytes containing the read index.
@@ -29,31 +153,256 @@ func NewIndex(reader io.Reader) (index Index, rawIdex []byte, err error) {
 
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("NewIndex:: %v", err)
+			err = fmt.Errorf("NewIndex:: %w", err)
+		}
+	}()
+
+	index, rawIdex, err = newIndex(reader, nil)
+	return
+}
+
+// Like NewIndex but queries are split in terms by the given analyzer, that
+// has to be the one used to build the index (see
+// NewIndexBuilderWithAnalyzer).
+//
+// It returns:
+// - the newly created index.
+// - the bytes containing the read index.
+// - an AnalyzerMismatchError if the index has been built with a registered
+//   analyzer with another configuration.
+// - an error on failure.
+func NewIndexWithAnalyzer(reader io.Reader, analyzer *Analyzer) (
+	index Index, rawIdex []byte, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewIndexWithAnalyzer: %w", err)
 		}
 	}()
 
+	index, rawIdex, err = newIndex(reader, analyzer)
+	return
+}
+
+// Common implementation of NewIndex and NewIndexWithAnalyzer, the analyzer of
+// the index is created from its configuration if none is given.
+func newIndex(reader io.Reader, analyzer *Analyzer) (index Index,
+	rawIdex []byte, err error) {
+
 	var buf bytes.Buffer
 	_, err = buf.ReadFrom(reader)
 	if err != nil {
 		return
 	}
 
-	index_ := new(indexImpl)
-	index_.trie, _, err = NewTrieReader(buf.Bytes())
+	_, err = ReadIndexHeader(buf.Bytes())
+	if err != nil {
+		return
+	}
+
+	var trie *Trie
+	trie, err = NewTrie(buf.Bytes())
 	if err != nil {
 		return
 	}
+	analyzer, err = analyzerFor(trie, analyzer)
+	if err != nil {
+		return
+	}
+	index_ := newIndexImpl(trie, analyzer)
 
 	index = index_
 	rawIdex = buf.Bytes()
 	return
 }
 
+// It loads an index previously generated with IndexBuilder and saved on the
+// file at the given path.
+//
+// The file is mapped in memory instead of being read: the index is usable
+// immediately even when huge, its pages are loaded lazily by the operating
+// system and shared between all the processes using the same file.
+//
+// Only the size of the index is checked against its header at load time,
+// method Trie.Verify can be used for a full check. Like with NewIndex,
+// queries are split in terms by the analyzer used to build the index.
+//
+// Method Index.Close must be called to release the mapping.
+//
+// It returns:
+// - the newly created index.
+// - the bytes containing the index (mapped from the file).
+// - an error on failure.
+func NewIndexFromFile(path string) (index Index, rawIndex []byte, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewIndexFromFile: %w", err)
+		}
+	}()
+
+	var file *os.File
+	file, err = os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var info os.FileInfo
+	info, err = file.Stat()
+	if err != nil {
+		return
+	} else if info.Size() < int64(len(IndexMagic)) {
+		err = NotAnIndex
+		return
+	}
+
+	var bytes_ []byte
+	bytes_, err = mmapFile(file, int(info.Size()))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			munmapFile(bytes_)
+		}
+	}()
+
+	if !HasIndexHeader(bytes_) {
+		err = NotAnIndex
+		return
+	}
+
+	var trie *Trie
+	trie, err = newTrie(newTrieSourceFromBytes(bytes_), false)
+	if err != nil {
+		return
+	}
+	var analyzer *Analyzer
+	analyzer, err = analyzerFor(trie, nil)
+	if err != nil {
+		return
+	}
+	index_ := newIndexImpl(trie, analyzer)
+	index_.closer = func() error { return munmapFile(bytes_) }
+
+	index = index_
+	rawIndex = bytes_
+	return
+}
+
+// It loads an index previously generated with IndexBuilder that is decoded
+// lazily from the given io.ReaderAt.
+//
+// Only the bytes touched by each search are read from the source. Like with
+// NewIndexFromFile only the size of the index is checked at load time.
+//
+// It returns:
+// - the newly created index.
+// - an error on failure.
+func NewIndexFromReaderAt(src io.ReaderAt, size int64) (index Index,
+	err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("NewIndexFromReaderAt: %w", err)
+		}
+	}()
+
+	prefix := make([]byte, len(IndexMagic))
+	_, err = src.ReadAt(prefix, 0)
+	if err != nil || !HasIndexHeader(prefix) {
+		err = NotAnIndex
+		return
+	}
+
+	var trie *Trie
+	trie, err = NewTrieAt(src, size)
+	if err != nil {
+		return
+	}
+	var analyzer *Analyzer
+	analyzer, err = analyzerFor(trie, nil)
+	if err != nil {
+		return
+	}
+	index_ := newIndexImpl(trie, analyzer)
+
+	index = index_
+	return
+}
+
 // Local storage for the private implementation of an Index.
+//
+// It is safe for concurrent use: the trie is immutable and each call traverses
+// it with its own cursor (see cursor), all the other state is lazily loaded
+// once.
 type indexImpl struct {
-	trie      *TrieReader
-	tokenizer Tokenizer
+	trie       *Trie
+	cursors    sync.Pool // Idle cursors of cursor.
+	tokenizer  Tokenizer
+	closer     func() error
+	statsOnce  sync.Once
+	stats      rankingStats
+	statsErr   error
+	fieldsOnce sync.Once
+	fields     map[string]int // Field ids by field key (see fieldKey).
+	fieldsErr  error
+	nodes      *nodeCache // Optional, see SetNodeCache.
+}
+
+// It creates the private implementation of an Index reading from the given
+// trie, that splits queries in terms with the given analyzer.
+func newIndexImpl(trie *Trie, analyzer *Analyzer) (idx *indexImpl) {
+	idx = &indexImpl{trie: trie, tokenizer: analyzer}
+	idx.cursors.New = func() interface{} {
+		cursor, _ := idx.trie.Root()
+		return cursor
+	}
+	return
+}
+
+// It returns a cursor on the root node of the trie for the exclusive use of
+// the caller, that can move it freely. Once done it has to be given back with
+// release.
+func (idx *indexImpl) cursor() (cursor *Cursor) {
+	cursor = idx.cursors.Get().(*Cursor)
+	cursor.nodes = idx.nodes
+	return
+}
+
+// It gives back a cursor previously obtained with cursor, to be reused by
+// later calls.
+func (idx *indexImpl) release(cursor *Cursor) {
+	*cursor = idx.trie.root
+	idx.cursors.Put(cursor)
+}
+
+// Private implementation of Index.SetNodeCache.
+func (idx *indexImpl) SetNodeCache(size int) {
+	if size > 0 {
+		idx.nodes = newNodeCache(size)
+	} else {
+		idx.nodes = nil
+	}
+}
+
+// Private implementation of Index.NodeCacheStats.
+func (idx *indexImpl) NodeCacheStats() (stats NodeCacheStats) {
+	if idx.nodes != nil {
+		stats = idx.nodes.stats()
+	}
+	return
+}
+
+// Private implementation of Index.Close.
+func (idx *indexImpl) Close() (err error) {
+	if idx.closer != nil {
+		err = idx.closer()
+		idx.closer = nil
+	}
+	idx.trie = nil
+	return
 }
 
 // Private implementation of Index.Search.
@@ -74,78 +423,142 @@ func (idx *indexImpl) Search(query string, limit int) (
 		return // Nothing to do.
 	}
 
-	if idx.tokenizer == nil {
-		idx.tokenizer = NewTokenizer()
-	}
+	cursor := idx.cursor()
+	defer idx.release(cursor)
 
-	// Extracts all the terms:
-	terms, incomplete_term := idx.tokenizer.ForSearch(query)
+	var fields map[string]int
+	fields, err = idx.fieldIds()
 	if err != nil {
 		return
 	}
 
+	// Extracts all the quoted phrases, the terms scoped to a field and then
+	// all the other terms:
+	phrases, rest := ExtractPhrases(query, idx.tokenizer)
+	fieldTerms, rest := extractFieldTerms(rest, idx.tokenizer, fields)
+	terms, incomplete_term := idx.tokenizer.ForSearch(rest)
+
 	// Special case: we need to extract all the postings:
-	if len(terms) == 0 && len(incomplete_term) == 0 {
-		idx.trie.Reset()
-		var _postings []int
-		_postings, err = idx.trie.ReadAllPostingsRecursive()
+	if len(terms) == 0 && len(incomplete_term) == 0 && len(phrases) == 0 &&
+		len(fieldTerms) == 0 {
+		var node Node
+		node, err = cursor.Reset()
 		if err != nil {
 			return
 		}
 
-		postings = _postings
+		var iterator PostingIterator
+		iterator, err = cursor.PrefixPostingIterator(node)
+		if err != nil {
+			return
+		}
+
+		postings, err = ReadPostingIterator(iterator, limit)
 		return
 	}
 
-	// Performs exact match with all complete terms while intersecting all
-	// the fetched postings:
-	var mergedPostings []int
-	for i, term := range terms {
-		var node Node
-		idx.trie.Reset()
-		node, err = idx.trie.Match(term)
-		if err != nil || node.NumPostings == 0 {
-			return
-		}
+	// The postings of all the parts of the query are decoded lazily while
+	// intersecting them, so that only the ones needed to reach the limit
+	// are decoded.
+	var iterators []PostingIterator
 
-		var nodePostings []int
-		nodePostings, err = idx.trie.ReadAllPostings()
-		if err != nil {
-			return
+	// Performs exact match with all complete terms:
+	for _, term := range terms {
+		var iterator PostingIterator
+		iterator, err = termPostingIterator(cursor, term, false)
+		if err != nil || iterator == nil {
+			return // No result!
 		}
+		iterators = append(iterators, iterator)
+	}
 
-		if i == 0 {
-			mergedPostings = nodePostings
-		} else {
-			mergedPostings = IntersectPostings(mergedPostings, nodePostings)
-			if len(mergedPostings) == 0 {
+	// Matches all the terms scoped to a field:
+	for _, fieldTerm := range fieldTerms {
+		for i, term := range fieldTerm.terms {
+			isPrefix := fieldTerm.incomplete && i == len(fieldTerm.terms)-1
+			var iterator PostingIterator
+			iterator, err = termPostingIterator(cursor, fieldTerm.prefix+term,
+				isPrefix)
+			if err != nil || iterator == nil {
 				return // No result!
 			}
+			iterators = append(iterators, iterator)
 		}
 	}
 
-	// If there was a potentially incomplete term, it performs prefix match with
-	// it and intersects all resulting postings with ones previously obtained:
-	if len(incomplete_term) > 0 {
-
-		var node Node
-		idx.trie.Reset()
-		node, err = idx.trie.Match(incomplete_term)
-		if err != nil ||
-			(node.NumPostings == 0 && node.NumEdges == 0) {
+	// Matches all the phrases:
+	for _, phrase := range phrases {
+		var phrasePostings []int
+		phrasePostings, err = cursor.MatchPhrase(phrase)
+		if err != nil || len(phrasePostings) == 0 {
 			return
 		}
+		iterators = append(iterators, NewSlicePostingIterator(phrasePostings))
+	}
 
-		var nodePostings []int
-		nodePostings, err = idx.trie.ReadAllPostingsRecursive()
+	// If there was a potentially incomplete term, it performs prefix match
+	// with it:
+	if len(incomplete_term) > 0 {
+		var iterator PostingIterator
+		iterator, err = termPostingIterator(cursor, incomplete_term, true)
+		if err != nil || iterator == nil {
+			return // No result!
+		}
+		iterators = append(iterators, iterator)
+	}
+
+	// Intersects all the postings up to the limit:
+	postings, err = ReadPostingIterator(
+		IntersectPostingIterators(iterators...), limit)
+	return
+}
+
+// Private implementation of Index.SearchFuzzy.
+func (idx *indexImpl) SearchFuzzy(query string, options FuzzyOptions,
+	limit int) (postings []int, err error) {
+
+	defer func() {
 		if err != nil {
+			err = fmt.Errorf("Index.SearchFuzzy '%v': %v", query, err)
+		}
+	}()
+
+	if limit == 0 {
+		return // Nothing to do.
+	}
+
+	cursor := idx.cursor()
+	defer idx.release(cursor)
+
+	// Extracts all the terms:
+	terms, incomplete_term := idx.tokenizer.ForSearch(query)
+
+	// Special case: we need to extract all the postings:
+	if len(terms) == 0 && len(incomplete_term) == 0 {
+		return idx.Search(query, limit)
+	}
+
+	// Matches each term, the incomplete one as a prefix, while intersecting
+	// all the fetched postings:
+	if len(incomplete_term) > 0 {
+		terms = append(terms, incomplete_term)
+	}
+	var mergedPostings []int
+	for i, term := range terms {
+		termOptions := options
+		termOptions.MaxDistance = FuzzyDistanceFor(term, options.MaxDistance)
+		termOptions.Prefix = len(incomplete_term) > 0 && i == len(terms)-1
+
+		var termPostings []int
+		termPostings, err = fuzzyPostings(cursor, term, termOptions)
+		if err != nil || len(termPostings) == 0 {
 			return
 		}
 
-		if mergedPostings == nil {
-			mergedPostings = nodePostings
+		if i == 0 {
+			mergedPostings = termPostings
 		} else {
-			mergedPostings = IntersectPostings(mergedPostings, nodePostings)
+			mergedPostings = IntersectPostings(mergedPostings, termPostings)
 			if len(mergedPostings) == 0 {
 				return // No result!
 			}
@@ -161,3 +574,60 @@ func (idx *indexImpl) Search(query string, limit int) (
 
 	return
 }
+
+// It returns the union of the postings of all the terms matching the given one
+// with a fuzzy match.
+func fuzzyPostings(cursor *Cursor, term string, options FuzzyOptions) (
+	postings []int, err error) {
+
+	var matches []FuzzyMatch
+	matches, err = cursor.MatchFuzzy(term, options)
+	if err != nil {
+		return
+	}
+
+	for _, match := range matches {
+		err = cursor.JumpNode(match.Node)
+		if err != nil {
+			return
+		}
+
+		var matchPostings []int
+		if options.Prefix {
+			matchPostings, err = cursor.ReadAllPostingsRecursive()
+		} else {
+			matchPostings, err = cursor.ReadAllPostings()
+		}
+		if err == io.EOF {
+			err = nil
+			continue
+		} else if err != nil {
+			return
+		}
+
+		postings = UnitePostings(postings, matchPostings)
+	}
+
+	return
+}
+
+// Private implementation of Index.Suggest.
+func (idx *indexImpl) Suggest(prefix string, n int) (
+	suggestions Suggestions, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Index.Suggest '%v': %v", prefix, err)
+		}
+	}()
+
+	_, incomplete_term := idx.tokenizer.ForSearch(prefix)
+	if len(incomplete_term) == 0 {
+		return // Nothing to complete.
+	}
+
+	cursor := idx.cursor()
+	defer idx.release(cursor)
+	suggestions, err = cursor.Suggest(incomplete_term, n)
+	return
+}
@@ -0,0 +1,157 @@
+package smartsearch
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// It calls all the search methods of the given index with some queries from
+// many goroutines at the same time, checking that each call returns the very
+// same result of a call done alone.
+//
+// Meant to be run also with the race detector (go test -race).
+func testIndexConcurrency(t *testing.T, index Index) {
+
+	queries := []string{"title:alpha", "beta ", "gam", "\"delta epsilon\"",
+		"alpha OR -beta", "zeta", ""}
+	search := func(query string) (result string) {
+		postings, err := index.Search(query, -1)
+		result += fmt.Sprint(postings, err)
+		postings, err = index.SearchFuzzy(query,
+			FuzzyOptions{MaxDistance: 1}, -1)
+		result += fmt.Sprint(postings, err)
+		postings, err = index.SearchQuery(query, -1)
+		result += fmt.Sprint(postings, err)
+		scored, err := index.SearchRankedWithBoosts(query,
+			FieldBoosts{"title": 2}, -1)
+		result += fmt.Sprint(scored, err)
+		suggestions, err := index.Suggest(query, 5)
+		result += fmt.Sprint(suggestions, err)
+		return
+	}
+
+	// Results of the calls done alone, the first call of each method also
+	// loads the lazy state of the index so it is done concurrently too:
+	expected := make([]string, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			expected[i] = search(query)
+		}(i, query)
+	}
+	wg.Wait()
+	for i, query := range queries {
+		if result := search(query); result != expected[i] {
+			t.Fatalf("Unexpected result with query [%v]: %v", query, result)
+		}
+	}
+
+	const numWorkers = 16
+	const numIterations = 20
+	errs := make(chan error, numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for j := 0; j < numIterations; j++ {
+				k := (w + j) % len(queries)
+				if result := search(queries[k]); result != expected[k] {
+					errs <- fmt.Errorf("unexpected result with query [%v]: "+
+						"%v", queries[k], result)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func newConcurrencyTestIndex(t *testing.T) []byte {
+
+	builder := NewIndexBuilder()
+	builder.SetScopedFields(true)
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta"}
+	for id := 0; id < 500; id++ {
+		title := words[id%len(words)]
+		body := ""
+		for j := 0; j < 1+id%7; j++ {
+			body += words[(id*j+j)%len(words)] + " "
+		}
+		builder.AddDocumentFields(id, []Field{
+			{"title", title},
+			{"body", body}})
+	}
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot build index: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestIndex_Concurrency(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	defer index.Close()
+
+	testIndexConcurrency(t, index)
+}
+
+func TestIndex_ConcurrencyWithNodeCache(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	defer index.Close()
+
+	// Small enough to discard nodes while searching:
+	index.SetNodeCache(4)
+	testIndexConcurrency(t, index)
+	if stats := index.NodeCacheStats(); stats.Hits == 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestIndex_ConcurrencyFromReaderAt(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	src := bytes.NewReader(raw)
+	index, err := NewIndexFromReaderAt(src, src.Size())
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	defer index.Close()
+
+	testIndexConcurrency(t, index)
+
+	// The same results of an index loaded in memory:
+	other, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	defer other.Close()
+	for _, query := range []string{"beta ", "title:alpha"} {
+		postings, _ := index.Search(query, -1)
+		otherPostings, _ := other.Search(query, -1)
+		if !reflect.DeepEqual(postings, otherPostings) {
+			t.Errorf("Unexpected result with query [%v]: %v", query,
+				postings)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package smartsearch
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -87,4 +90,164 @@ func TestIndex_Base(t *testing.T) {
 		t.Errorf("Unexpected result with query [%v]: postings=%v", query,
 			postings)
 	}
+
+	query = ""
+	expected_postings = []int{1, 2}
+	postings, err = index.Search(query, 2)
+	if !reflect.DeepEqual(postings, expected_postings) {
+		t.Errorf("Unexpected result with query [%v]: postings=%v", query,
+			postings)
+	}
+}
+
+func TestIndex_FromFile(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "This is a text to test something")
+	builder.AddDocument(2, "This is another text to test something else")
+	builder.AddDocument(3, "Now we would like to add another document")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+
+	path := filepath.Join(t.TempDir(), "index.raw")
+	err := os.WriteFile(path, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("Cannot write index: %v", err)
+	}
+
+	index, indexRaw, err := NewIndexFromFile(path)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	} else if !bytes.Equal(indexRaw, buf.Bytes()) {
+		t.Error("Unexpected raw index returned")
+	}
+
+	query := "another te"
+	expected_postings := []int{2}
+	postings, err := index.Search(query, -1)
+	if err != nil || !reflect.DeepEqual(postings, expected_postings) {
+		t.Errorf("Unexpected result with query %v: postings=%v, err=%v",
+			query, postings, err)
+	}
+
+	err = index.Close()
+	if err != nil {
+		t.Errorf("Cannot close index: %v", err)
+	}
+
+	// Something that is not an index:
+	err = os.WriteFile(path, []byte("Hello world!"), 0644)
+	if err != nil {
+		t.Fatalf("Cannot write file: %v", err)
+	}
+	_, _, err = NewIndexFromFile(path)
+	if !errors.Is(err, NotAnIndex) {
+		t.Errorf("NotAnIndex was expected: %v", err)
+	}
+
+	// A truncated index:
+	err = os.WriteFile(path, buf.Bytes()[:buf.Len()-1], 0644)
+	if err != nil {
+		t.Fatalf("Cannot write file: %v", err)
+	}
+	_, _, err = NewIndexFromFile(path)
+	if !errors.Is(err, ChecksumMismatch) {
+		t.Errorf("ChecksumMismatch was expected: %v", err)
+	}
+}
+
+func TestIndex_FromReaderAt(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "This is a text to test something")
+	builder.AddDocument(2, "This is another text to test something else")
+	builder.AddDocument(3, "Now we would like to add another document")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+
+	src := bytes.NewReader(buf.Bytes())
+	index, err := NewIndexFromReaderAt(src, src.Size())
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	defer index.Close()
+
+	queries := []string{"test", "another ", "a", ""}
+	all_expected_postings := [][]int{{1, 2}, {2, 3}, {1, 2, 3}, {1, 2, 3}}
+	for i, query := range queries {
+		postings, err := index.Search(query, -1)
+		if err != nil ||
+			!reflect.DeepEqual(postings, all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query %v: postings=%v, err=%v",
+				query, postings, err)
+		}
+	}
+}
+
+func TestIndex_SearchFuzzy(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "Jayendra Menon")
+	builder.AddDocument(2, "Siddarth Jayanth")
+	builder.AddDocument(3, "Nithya Menon")
+	builder.AddDocument(4, "Vertigo")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	options := FuzzyOptions{MaxDistance: 2, Transpositions: true}
+	queries := []string{"jayandra", "jayandra menon ", "nitya menon",
+		"vertiog", "sidarth jaya", "menn", "xyz ", ""}
+	all_expected_postings := [][]int{{1}, {1}, {3}, {4}, {2}, {1, 3}, nil,
+		{1, 2, 3, 4}}
+	for i, query := range queries {
+		postings, err := index.SearchFuzzy(query, options, -1)
+		if err != nil {
+			t.Errorf("SearchFuzzy failed with query %v: %v", query, err)
+		} else if !reflect.DeepEqual(postings, all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query [%v]: postings=%v", query,
+				postings)
+		}
+	}
+
+	// Exact search does not tolerate typos:
+	postings, _ := index.Search("jayandra", -1)
+	if len(postings) != 0 {
+		t.Errorf("Unexpected result: postings=%v", postings)
+	}
+}
+
+func TestIndex_FancyText(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "𝐕𝐞𝐫𝐭𝐢𝐠𝐨 (1958)")
+	builder.AddDocument(2, "Ｒｅａｒ Ｗｉｎｄｏｗ")
+	builder.AddDocument(3, "Die Straße")
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	for query, expected := range map[string][]int{
+		"vertigo":  {1},
+		"𝓥𝓮𝓻𝓽𝓲𝓰𝓸":  {1},
+		"window":   {2},
+		"rear win": {2},
+		"strasse":  {3},
+		"STRAẞE":   {3},
+		"straß":    {3}} {
+		postings, err := index.Search(query, -1)
+		if err != nil || !reflect.DeepEqual(postings, expected) {
+			t.Errorf("Unexpected result with query %v: %v %v", query,
+				postings, err)
+		}
+	}
 }
@@ -2,9 +2,11 @@ package smartsearch
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"runtime"
+	"sort"
 )
 
 // IndexBuilder is a component that collects documents to generate one index
@@ -18,6 +20,32 @@ type IndexBuilder interface {
 	// of the same document.
 	AddDocument(id int, content string)
 
+	// It indexes a document made of many fields, given an unique id and the
+	// content of each field.
+	//
+	// Terms are indexed for the whole document and, with SetScopedFields, for
+	// their field too.
+	//
+	// If the same id is used many times it consider the passed content as part
+	// of the same document.
+	AddDocumentFields(id int, fields []Field)
+
+	// It tells if the terms of each field have to be indexed also for their
+	// field, so that they can be searched within one field (like
+	// "title:vertigo") and boosted when ranking.
+	//
+	// It is disabled by default: the terms of the fields are stored twice,
+	// for the document and for the field, that roughly doubles the size of
+	// the index (see doc/trie.md). It must be called before Dump.
+	SetScopedFields(enabled bool)
+
+	// It sets the JSON attribute with the language of each JSON document,
+	// like "tr" or "el": the content of the documents is lower-cased with
+	// the rules of their language (see MakeJsonExtractorWithLanguage).
+	//
+	// It must be called before adding any JSON document.
+	SetJsonLanguageField(languageField string)
+
 	// It indexes a JSON document.
 	//
 	// Parameters:
@@ -32,6 +60,8 @@ type IndexBuilder interface {
 	// Notes:
 	// - the root object must be a dictionary
 	// - it can access only to values of the root object.
+	// - each one of the content fields is indexed as a field of the document
+	//   (see AddDocumentFields and SetScopedFields).
 	// - the unique id must be a positive integer, it is OK if it have been
 	//   encoded as a string.
 	// - if the same id is used many times it consider the passed content as
@@ -69,6 +99,11 @@ type IndexBuilder interface {
 
 	// Generates a blob from all indexed documents and writes it to the passed
 	// io.Writer.
+	//
+	// The blob starts with a header (see WriteIndex) that identifies it,
+	// tells the version of the binary format and protects the content with a
+	// checksum. The length of each document is stored as well, to rank the
+	// search results.
 	Dump(writer io.Writer) error
 
 	// Aborts all pending co-routines, their job will be lost.
@@ -82,13 +117,28 @@ type IndexBuilder interface {
 // IndexBuilder.Abort or IndexBuilder.Dump are called. To avoid leakages please
 // use a deferred call to one of the 2 just after creating the builder.
 func NewIndexBuilder() IndexBuilder {
+	return NewIndexBuilderWithAnalyzer(DefaultAnalyzer())
+}
+
+// Like NewIndexBuilder but the documents are split in terms by the given
+// analyzer instead of the default one (see DefaultAnalyzer).
+//
+// The configuration of the analyzer is stored in the index: NewIndex creates
+// the same analyzer again if it has been registered (see RegisterAnalyzer),
+// otherwise the index has to be loaded with NewIndexWithAnalyzer.
+func NewIndexBuilderWithAnalyzer(analyzer *Analyzer) IndexBuilder {
+	return newIndexBuilder(analyzer, runtime.NumCPU())
+}
+
+// It creates an IndexBuilder with the given analyzer and number of indexers.
+func newIndexBuilder(analyzer *Analyzer, numIndexers int) *indexBuilderImpl {
 
 	b := new(indexBuilderImpl)
+	b.analyzer = analyzer
 
-	// Starts all the indexers:
-	n := runtime.NumCPU()
-	for i := 0; i < n; i++ {
-		b.indexers = append(b.indexers, NewIndexer())
+	// Starts all the indexers, sharing the same analyzer:
+	for i := 0; i < numIndexers; i++ {
+		b.indexers = append(b.indexers, NewIndexerWithAnalyzer(analyzer))
 	}
 
 	return b
@@ -96,26 +146,64 @@ func NewIndexBuilder() IndexBuilder {
 
 // Used to implement an IndexBuilder.
 type indexBuilderImpl struct {
+	analyzer      *Analyzer
+	scopedFields  bool   // See IndexBuilder.SetScopedFields.
+	languageField string // JSON attribute with the language, if any.
 	indexers      []Indexer
-	documentCount int
-	trieBuilder   TrieBuilder
+	trieBuilder   *trieNode
+	lengths       DocumentLengths
+	fieldTerms    map[string][]IndexedTerms // Terms of each field.
+}
+
+// It returns the indexer of the document with the given id.
+//
+// All the content of one document goes to the same indexer, so that the
+// positions of its terms follow each other also when it is added many times.
+func (b *indexBuilderImpl) indexerFor(id int) Indexer {
+	k := id % len(b.indexers)
+	if k < 0 {
+		k += len(b.indexers)
+	}
+	return b.indexers[k]
 }
 
 // Implementation of IndexBuilder.AddDocument
 func (b *indexBuilderImpl) AddDocument(id int, content string) {
-	k := b.documentCount % len(b.indexers)
-	b.indexers[k].AddContent(id, []byte(content))
-	b.documentCount++
+	b.indexerFor(id).AddContent(id, []byte(content))
+}
+
+// Implementation of IndexBuilder.AddDocumentFields
+func (b *indexBuilderImpl) AddDocumentFields(id int, fields []Field) {
+	b.indexerFor(id).AddFields(id, fields)
+}
+
+// Implementation of IndexBuilder.SetScopedFields
+func (b *indexBuilderImpl) SetScopedFields(enabled bool) {
+	b.scopedFields = enabled
+}
+
+// Implementation of IndexBuilder.SetJsonLanguageField
+func (b *indexBuilderImpl) SetJsonLanguageField(languageField string) {
+	b.languageField = languageField
 }
 
 // Implementation of IndexBuilder.AddJsonDocument
 func (b *indexBuilderImpl) AddJsonDocument(jsonDocument []byte, idField string,
 	contentFields []string) {
-	k := b.documentCount % len(b.indexers)
-	b.indexers[k].AddRawContent(jsonDocument,
-		MakeJsonExtractor(idField, contentFields))
-	b.documentCount++
-	return
+
+	// The id is needed to choose the indexer:
+	extractor := MakeJsonFieldsExtractorWithLanguage(idField, contentFields,
+		b.languageField)
+	id, fields, err := extractor(jsonDocument)
+	if err != nil || id < 0 {
+		// The indexer fails the same way, and Dump returns the error. Bytes
+		// are copied as the caller may reuse them (see IndexJsonStream):
+		raw := append([]byte(nil), jsonDocument...)
+		b.indexers[0].AddRawFields(raw, extractor)
+		return
+	}
+
+	b.indexerFor(id).AddFields(id, fields)
 }
 
 // Implementation of IndexBuilder.IndexJsonStream
@@ -166,7 +254,8 @@ func (b *indexBuilderImpl) LoadAndIndexJsonStream(
 		}
 	}()
 
-	extractor := MakeJsonExtractor(idField, contentFields)
+	extractor := MakeJsonFieldsExtractorWithLanguage(idField, contentFields,
+		b.languageField)
 	documents_ := make(map[int][]byte, 0)
 	scanner := bufio.NewScanner(reader)
 
@@ -177,8 +266,8 @@ func (b *indexBuilderImpl) LoadAndIndexJsonStream(
 		numLines += 1
 
 		var id int
-		var content string
-		id, content, err = extractor(scanner.Bytes())
+		var fields []Field
+		id, fields, err = extractor(scanner.Bytes())
 		if err != nil {
 			return
 		}
@@ -193,7 +282,7 @@ func (b *indexBuilderImpl) LoadAndIndexJsonStream(
 		copy(blob, scanner.Bytes())
 		documents_[id] = blob
 
-		b.AddDocument(id, content)
+		b.AddDocumentFields(id, fields)
 	}
 
 	documents = documents_
@@ -211,7 +300,11 @@ func (b *indexBuilderImpl) Dump(writer io.Writer) (err error) {
 
 	// We need a trie builder if not already built:
 	if b.trieBuilder == nil {
-		b.trieBuilder = NewTrieBuilder()
+		b.trieBuilder = newTrieBuilderWithFeatures(FeatureFrequencies |
+			FeaturePositions | FeatureSkipBlocks | FeaturePostingContainers |
+			FeatureRadixEdges | FeatureSubtreePostings)
+		b.lengths = make(DocumentLengths)
+		b.fieldTerms = make(map[string][]IndexedTerms)
 	}
 
 	// If there is pending content takes it from the indexers:
@@ -230,13 +323,80 @@ func (b *indexBuilderImpl) Dump(writer io.Writer) (err error) {
 				return
 			}
 			b.trieBuilder.AddBulk(indexedTerms)
+
+			// Each document has been indexed by one indexer (see indexerFor):
+			for id, length := range b.indexers[i].DocumentLengths() {
+				b.lengths[id] += length
+			}
+			if !b.scopedFields {
+				continue
+			}
+			for name, terms := range b.indexers[i].FieldResults() {
+				b.fieldTerms[name] = append(b.fieldTerms[name], terms)
+			}
+		}
+
+		// Terms of each field are added below the reserved rune of the field:
+		var fieldNames []string
+		fieldNames, err = b.fieldNames()
+		if err != nil {
+			return
+		}
+		for id, name := range fieldNames {
+			prefix := fieldPrefix(id)
+			for _, terms := range b.fieldTerms[name] {
+				prefixedTerms := make(IndexedTerms, len(terms))
+				for k, term := range terms {
+					prefixedTerms[k] = term
+					prefixedTerms[k].term = prefix + term.term
+				}
+				b.trieBuilder.AddBulk(prefixedTerms)
+			}
 		}
 
 		b.indexers = nil // They are useless now.
 	}
 
-	// Generates our blob:
-	err = b.trieBuilder.Dump(writer)
+	// Generates our trie, its header is the one of the index:
+	trieBytes := new(bytes.Buffer)
+	err = b.trieBuilder.dumpTrie(trieBytes)
+	if err != nil {
+		return
+	}
+
+	// Generates our blob, a header followed by the document lengths, the
+	// names of the fields, the configuration of the analyzer and by the trie:
+	features := FeatureChecksum | FeatureDocumentLengths | FeatureAnalyzer |
+		b.trieBuilder.Features()
+	sections := IndexSections{
+		FeatureDocumentLengths: EncodeDocumentLengths(b.lengths),
+		FeatureAnalyzer:        EncodeAnalyzerConfig(b.analyzer.Config)}
+	if len(b.fieldTerms) > 0 {
+		var fieldNames []string
+		fieldNames, err = b.fieldNames()
+		if err != nil {
+			return
+		}
+		features |= FeatureFields
+		sections[FeatureFields] = EncodeFieldNames(fieldNames)
+	}
+	_, err = WriteIndex(writer, features, sections, trieBytes.Bytes())
+	return
+}
+
+// It returns the names of all the fields found in the documents, sorted, the
+// id of each field is its position.
+func (b *indexBuilderImpl) fieldNames() (names []string, err error) {
+
+	for name := range b.fieldTerms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > maxFields {
+		err = fmt.Errorf("too many fields: %v", len(names))
+		names = nil
+	}
 	return
 }
 
@@ -139,3 +139,50 @@ func TestIndexBuilder_ScanJsonStream(t *testing.T) {
 		}
 	}
 }
+
+func TestIndexBuilder_SameDocument(t *testing.T) {
+
+	// Many indexers, as the content of each document is spread between them
+	// only with many CPUs:
+	builder := newIndexBuilder(DefaultAnalyzer(), 4)
+	builder.AddDocument(1, "a b")
+	builder.AddDocument(2, "b c")
+	builder.AddDocument(1, "c d")
+	builder.AddJsonDocument([]byte(`{"id":1, "text":"e f"}`), "id",
+		[]string{"text"})
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Cannot dump index: %v", err)
+	}
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	// Contents of the same document follow each other:
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"\"a d\"", nil},
+		{"\"a c\"", nil},
+		{"\"b c\"", []int{1, 2}},
+		{"\"a b c d e f\"", []int{1}}}
+	for _, test := range tests {
+		postings, err := index.Search(test.query, -1)
+		if err != nil || !reflect.DeepEqual(postings, test.expected) {
+			t.Errorf("Unexpected postings for '%v': %v, err=%v", test.query,
+				postings, err)
+		}
+	}
+
+	// Invalid JSON documents make Dump fail:
+	builder = newIndexBuilder(DefaultAnalyzer(), 4)
+	builder.AddJsonDocument([]byte(`{"id":`), "id", []string{"text"})
+	err = builder.Dump(new(bytes.Buffer))
+	if err == nil {
+		t.Error("An error was expected")
+	}
+}
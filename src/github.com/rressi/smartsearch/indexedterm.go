@@ -3,6 +3,8 @@ package smartsearch
 type IndexedTerm struct {
 	term        string
 	postings    []int
+	frequencies []int   // Occurrences of the term for each posting.
+	positions   [][]int // Positions of the term for each posting.
 	occurrences int
 }
 
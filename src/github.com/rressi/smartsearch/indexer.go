@@ -15,33 +15,61 @@ type Indexer interface {
 	// Posts raw bytes with content to be extracted and indexed.
 	AddRawContent(raw []byte, extractor ContentExtractor)
 
+	// Posts new content made of many fields to be indexed.
+	//
+	// Terms are indexed both for the whole document and for their field.
+	AddFields(id int, fields []Field)
+
+	// Posts raw bytes with content made of many fields to be extracted and
+	// indexed.
+	AddRawFields(raw []byte, extractor FieldsExtractor)
+
 	// Terminates the slave go-routine.
 	Finish()
 
 	// Wait for termination and fetches the final result.
 	Result() (result IndexedTerms, err error)
+
+	// Fetches the number of terms of each indexed document, it must be called
+	// after Result.
+	DocumentLengths() DocumentLengths
+
+	// Fetches the terms of each field, by field name, it must be called after
+	// Result.
+	FieldResults() map[string]IndexedTerms
 }
 
 // Used by implementation of Indexer to receive new input.
 type indexerInput struct {
-	id        int
-	content   []byte
-	extractor ContentExtractor
+	id              int
+	content         []byte
+	fields          []Field
+	extractor       ContentExtractor
+	fieldsExtractor FieldsExtractor
 }
 
-func (i *indexerInput) extract() (id int, content string, err error) {
+// It extracts the content to be indexed, either as a whole or field by field.
+func (i *indexerInput) extract() (id int, content string, fields []Field,
+	err error) {
 
-	if i.extractor == nil {
+	if i.extractor == nil && i.fieldsExtractor == nil {
 		if i.id < 0 {
 			err = io.EOF
 		} else {
 			id = i.id
 			content = string(i.content)
+			fields = i.fields
 		}
 		return
 	}
 
-	id_, content_, err_ := i.extractor(i.content)
+	var id_ int
+	var err_ error
+	if i.extractor != nil {
+		id_, content, err_ = i.extractor(i.content)
+	} else {
+		id_, fields, err_ = i.fieldsExtractor(i.content)
+	}
 	if err_ != nil {
 		err = fmt.Errorf("indexerInput.Extract: %v", err_)
 		return
@@ -51,17 +79,21 @@ func (i *indexerInput) extract() (id int, content string, err error) {
 	}
 
 	id = id_
-	content = content_
 	return
 }
 
 // Main struct used by implementation of Indexer.
 type indexerImpl struct {
-	terms     map[string][]int
-	tokenizer Tokenizer
-	inChan    chan<- indexerInput
-	outChan   <-chan IndexedTerms
-	err       error
+	terms      map[string][]int
+	positions  map[string][]int // Position of each entry of terms.
+	fields     map[string]*indexerField
+	lengths    DocumentLengths
+	next       map[int]int // Position of the next term of each document.
+	fieldTerms map[string]IndexedTerms
+	tokenizer  Tokenizer
+	inChan     chan<- indexerInput
+	outChan    <-chan IndexedTerms
+	err        error
 }
 
 // Implementation of IndexTokenizer.AddDocument
@@ -76,6 +108,18 @@ func (i *indexerImpl) AddRawContent(raw []byte, extractor ContentExtractor) {
 	i.inChan <- command
 }
 
+// Implementation of IndexTokenizer.AddFields
+func (i *indexerImpl) AddFields(id int, fields []Field) {
+	command := indexerInput{id: id, fields: fields}
+	i.inChan <- command
+}
+
+// Implementation of IndexTokenizer.AddRawFields
+func (i *indexerImpl) AddRawFields(raw []byte, extractor FieldsExtractor) {
+	command := indexerInput{content: raw, fieldsExtractor: extractor}
+	i.inChan <- command
+}
+
 // Implementation of IndexTokenizer.Done
 func (i *indexerImpl) Finish() {
 	i.inChan <- indexerInput{id: -1}
@@ -83,43 +127,78 @@ func (i *indexerImpl) Finish() {
 
 // Implementation of IndexTokenizer.Result
 func (i *indexerImpl) Result() (result IndexedTerms, err error) {
-	if i.err != io.EOF && i.err != nil {
+	result = <-i.outChan
+	if i.err != nil {
+		result = nil
 		err = i.err
 	}
-	result = <-i.outChan
 	return
 }
 
+// Implementation of IndexTokenizer.DocumentLengths
+func (i *indexerImpl) DocumentLengths() DocumentLengths {
+	return i.lengths
+}
+
+// Implementation of IndexTokenizer.FieldResults
+func (i *indexerImpl) FieldResults() map[string]IndexedTerms {
+	return i.fieldTerms
+}
+
+// Terms collected by an Indexer for one field.
+type indexerField struct {
+	terms     map[string][]int
+	positions map[string][]int // Position of each entry of terms.
+}
+
 // Creates an IndexTokenizer
 func NewIndexer() Indexer {
+	return NewIndexerWithAnalyzer(DefaultAnalyzer())
+}
+
+// Like NewIndexer but the content is split in terms by the given analyzer,
+// that can be shared by many indexers.
+func NewIndexerWithAnalyzer(analyzer *Analyzer) Indexer {
 	i := new(indexerImpl)
-	i.tokenizer = NewTokenizer()
+	i.tokenizer = analyzer
 	inChan := make(chan indexerInput, 1000)
 	outChan := make(chan IndexedTerms, 1)
 	go func() {
 		i.terms = make(map[string][]int)
+		i.positions = make(map[string][]int)
+		i.fields = make(map[string]*indexerField)
+		i.lengths = make(DocumentLengths)
+		i.next = make(map[int]int)
 		for command := range inChan {
-			id, content, err := command.extract()
-			if err != nil {
-				var results IndexedTerms
-				if err == io.EOF {
-					// Generates the final result:
-					for term, postings := range i.terms {
-						result := IndexedTerm{
-							term:        term,
-							postings:    SortDedupPostings(postings),
-							occurrences: len(postings)}
-						results = append(results, result)
-					}
-					sort.Sort(results)
+			id, content, fields, err := command.extract()
+			if err == io.EOF {
+				// Generates the final result:
+				results := makeIndexedTerms(i.terms, i.positions)
+				i.fieldTerms = make(map[string]IndexedTerms)
+				for name, field := range i.fields {
+					i.fieldTerms[name] = makeIndexedTerms(field.terms,
+						field.positions)
 				}
 				outChan <- results
 				return // End of story.
+			} else if err != nil || i.err != nil {
+				// Keeps the first error for Result, and consumes the
+				// following input so that senders are not blocked:
+				if i.err == nil {
+					i.err = err
+				}
+			} else if fields == nil {
+				i.index(id, content, nil)
 			} else {
-				// Indexes the content:
-				terms := i.tokenizer.Apply(content)
-				for _, term := range terms {
-					i.terms[term] = append(i.terms[term], id)
+				for _, field := range fields {
+					indexerField_, ok := i.fields[field.Name]
+					if !ok {
+						indexerField_ = &indexerField{
+							terms:     make(map[string][]int),
+							positions: make(map[string][]int)}
+						i.fields[field.Name] = indexerField_
+					}
+					i.index(id, field.Content, indexerField_)
 				}
 			}
 		}
@@ -128,3 +207,71 @@ func NewIndexer() Indexer {
 	i.outChan = outChan
 	return i
 }
+
+// Gap between the positions of the terms of two fields of the same document,
+// larger than any slop so that phrases never match across fields.
+const fieldPositionGap = maxPhraseSlop + 1
+
+// It indexes the given content, also for the given field if not nil.
+//
+// Contents added with the same id follow each other, fields are separated by
+// fieldPositionGap positions. The length of the document counts only its
+// terms.
+func (i *indexerImpl) index(id int, content string, field *indexerField) {
+	terms := i.tokenizer.Apply(content)
+	for k, term := range terms {
+		position := i.next[id] + k
+		i.terms[term] = append(i.terms[term], id)
+		i.positions[term] = append(i.positions[term], position)
+		if field != nil {
+			field.terms[term] = append(field.terms[term], id)
+			field.positions[term] = append(field.positions[term], position)
+		}
+	}
+	i.lengths[id] += len(terms)
+	i.next[id] += len(terms)
+	if field != nil {
+		i.next[id] += fieldPositionGap
+	}
+}
+
+// It generates the sorted indexed terms from the postings collected for each
+// term, one for each occurrence, and from the related positions.
+func makeIndexedTerms(terms map[string][]int,
+	positions map[string][]int) (results IndexedTerms) {
+
+	for term, postings := range terms {
+		postings_, frequencies := CountPostings(postings)
+		result := IndexedTerm{
+			term:        term,
+			postings:    postings_,
+			frequencies: frequencies,
+			positions: groupPositions(postings_, postings,
+				positions[term]),
+			occurrences: len(postings)}
+		results = append(results, result)
+	}
+	sort.Sort(results)
+	return
+}
+
+// Given the postings of one term as they have been collected, one for each
+// occurrence, and the related positions, it groups the positions by posting.
+//
+// It returns:
+// - for each of the passed sorted and deduplicated postings, the sorted
+//   positions of the term.
+func groupPositions(postings []int, occurrences []int,
+	positions []int) (grouped [][]int) {
+
+	byPosting := make(map[int][]int, len(postings))
+	for k, posting := range occurrences {
+		byPosting[posting] = append(byPosting[posting], positions[k])
+	}
+
+	grouped = make([][]int, len(postings))
+	for k, posting := range postings {
+		grouped[k] = SortDedupPostings(byPosting[posting])
+	}
+	return
+}
@@ -10,13 +10,13 @@ func TestIndexer_Base(t *testing.T) {
 	contentA := "YES!-This ìs ä fÄncy, is a string"
 	contentB := "This ìs à book"
 	expected_terms := IndexedTerms{
-		{"a", []int{10, 12}, 3},
-		{"book", []int{12}, 1},
-		{"fancy", []int{10}, 1},
-		{"is", []int{10, 12}, 3},
-		{"string", []int{10}, 1},
-		{"this", []int{10, 12}, 2},
-		{"yes", []int{10}, 1}}
+		{"a", []int{10, 12}, []int{2, 1}, [][]int{{3, 6}, {2}}, 3},
+		{"book", []int{12}, []int{1}, [][]int{{3}}, 1},
+		{"fancy", []int{10}, []int{1}, [][]int{{4}}, 1},
+		{"is", []int{10, 12}, []int{2, 1}, [][]int{{2, 5}, {1}}, 3},
+		{"string", []int{10}, []int{1}, [][]int{{7}}, 1},
+		{"this", []int{10, 12}, []int{1, 1}, [][]int{{1}, {0}}, 2},
+		{"yes", []int{10}, []int{1}, [][]int{{0}}, 1}}
 
 	indexer := NewIndexer()
 	indexer.AddContent(10, []byte(contentA))
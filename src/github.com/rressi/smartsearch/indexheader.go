@@ -0,0 +1,370 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Magic bytes found at the very beginning of every index generated by
+// IndexBuilder.
+//
+// The first byte is not printable and it is also an invalid way to start a
+// plain trie generated by TrieBuilder, this way we can tell them apart.
+const IndexMagic = "\x89SSX"
+
+// Current version of the binary format, it is increased every time the
+// encoding changes in a way that older readers cannot handle.
+const IndexFormatVersion = 1
+
+// A set of bits describing optional features used by one index.
+//
+// Features are stored in the index header so that readers can decode it
+// properly or refuse it if they do not know how.
+type IndexFeatures uint
+
+// Optional features of the binary format.
+const (
+	// The header contains size and CRC-32 (Castagnoli) of all the bytes
+	// following it.
+	FeatureChecksum IndexFeatures = 1 << iota
+
+	// Each node stores the total occurrences of its term, each posting the
+	// occurrences of the term in the related document.
+	FeatureFrequencies
+
+	// A section before the trie stores the length (number of terms) of each
+	// document (see EncodeDocumentLengths).
+	FeatureDocumentLengths
+
+	// Each posting stores the positions of the term in the related document,
+	// used to match phrases.
+	FeaturePositions
+
+	// A section before the trie stores the names of the fields of the
+	// documents, and the trie contains the terms of each field apart (see
+	// EncodeFieldNames).
+	FeatureFields
+
+	// The postings of the nodes with many of them are preceded by a table to
+	// skip whole blocks of postings without decoding them (see
+	// Cursor.SkipTo).
+	FeatureSkipBlocks
+
+	// The postings of each node are encoded with the most compact of several
+	// containers: increments, a bitmap or runs of consecutive postings.
+	FeaturePostingContainers
+
+	// Chains of nodes without postings and with a single edge are collapsed
+	// in one edge labeled with all their runes (see Edge.Suffix).
+	FeatureRadixEdges
+
+	// The nodes close to the root, or with a big sub-trie, store the postings
+	// of their whole sub-trie, so that short prefixes do not need to visit it
+	// (see Cursor.ReadAllPostingsRecursive).
+	FeatureSubtreePostings
+
+	// A section before the trie stores the configuration of the analyzer
+	// used to build the index, to search it with the same one (see
+	// EncodeAnalyzerConfig).
+	FeatureAnalyzer
+)
+
+// All the features known by this implementation.
+const knownIndexFeatures = FeatureChecksum | FeatureFrequencies |
+	FeatureDocumentLengths | FeaturePositions | FeatureFields |
+	FeatureSkipBlocks | FeaturePostingContainers | FeatureRadixEdges |
+	FeatureSubtreePostings | FeatureAnalyzer
+
+// Features that come with a section of bytes placed between the header and
+// the trie. Sections are placed in the order of their feature's bit.
+const sectionFeatures = FeatureDocumentLengths | FeatureFields |
+	FeatureAnalyzer
+
+// Maximum number of sections an index can have.
+const maxIndexSections = 8
+
+// Maximum number of bytes used by an index header.
+const maxIndexHeaderSize = len(IndexMagic) +
+	(3+maxIndexSections)*binary.MaxVarintLen64 + 4
+
+// Content of the optional sections of one index, by feature.
+type IndexSections map[IndexFeatures][]byte
+
+// Table used to compute checksums.
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// This error is returned when the passed bytes do not start with IndexMagic.
+var NotAnIndex = errors.New("Not a smartsearch index")
+
+// This error is returned when the index has been generated with a version of
+// the binary format that this implementation does not support.
+type UnsupportedVersionError struct {
+	Version int // Version found on the index header.
+}
+
+// Implementation of error.
+func (e UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("Unsupported index format version %d (supported: %d)",
+		e.Version, IndexFormatVersion)
+}
+
+// This error is returned when the index uses features that this
+// implementation does not know how to decode.
+type UnsupportedFeaturesError struct {
+	Features IndexFeatures // The unknown features found on the index header.
+}
+
+// Implementation of error.
+func (e UnsupportedFeaturesError) Error() string {
+	return fmt.Sprintf("Unsupported index features 0x%x", uint(e.Features))
+}
+
+// This error is returned when the content of an index does not match the
+// size or the checksum stored in its header.
+var ChecksumMismatch = errors.New("Index checksum mismatch")
+
+// It represents the decoded header of one index.
+type IndexHeader struct {
+	Version     int           // Version of the binary format.
+	Features    IndexFeatures // Optional features used by the index.
+	Size        int           // Number of bytes used by the header.
+	PayloadSize int           // Bytes following the header (FeatureChecksum).
+	Checksum    uint32        // CRC-32 of the payload (FeatureChecksum).
+	TrieOffset  int           // Byte offset of the root node of the trie.
+	sections    map[IndexFeatures]indexSection
+}
+
+// Position of one section of the index.
+type indexSection struct {
+	offset int
+	size   int
+}
+
+// It returns the position of the section of the given feature.
+//
+// It returns:
+// - the byte offset and the size of the section.
+// - false if the index has no such section.
+func (h IndexHeader) Section(feature IndexFeatures) (offset int, size int,
+	ok bool) {
+	var section indexSection
+	section, ok = h.sections[feature]
+	offset, size = section.offset, section.size
+	return
+}
+
+// It encodes one whole index and writes it to the passed io.Writer.
+//
+// The index is composed by a header, the optional sections and the trie. The
+// header contains the given features, the size of each section and, with
+// FeatureChecksum, size and checksum of everything following the header.
+//
+// Passed sections must match the features: one section for each one of the
+// features that requires it.
+//
+// It returns:
+// - the number of written bytes.
+// - an error in case of failure.
+func WriteIndex(dst io.Writer, features IndexFeatures,
+	sections IndexSections, trie []byte) (sz int, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("WriteIndex: %v", err)
+		}
+	}()
+
+	// Sections and trie make the payload:
+	payload := new(bytes.Buffer)
+	var sectionSizes []int
+	for feature := IndexFeatures(1); feature <= sectionFeatures; feature <<= 1 {
+		section, ok := sections[feature]
+		if feature&sectionFeatures&features == 0 {
+			continue
+		} else if !ok {
+			err = fmt.Errorf("missing section for feature 0x%x", uint(feature))
+			return
+		}
+		payload.Write(section)
+		sectionSizes = append(sectionSizes, len(section))
+	}
+	if len(sections) != len(sectionSizes) {
+		err = errors.New("unexpected sections")
+		return
+	}
+	payload.Write(trie)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(IndexMagic)
+
+	tmp := make([]byte, binary.MaxVarintLen64)
+	numBytes := binary.PutUvarint(tmp, IndexFormatVersion)
+	buf.Write(tmp[:numBytes])
+	numBytes = binary.PutUvarint(tmp, uint64(features))
+	buf.Write(tmp[:numBytes])
+
+	if features&FeatureChecksum != 0 {
+		numBytes = binary.PutUvarint(tmp, uint64(payload.Len()))
+		buf.Write(tmp[:numBytes])
+		checksum := crc32.Checksum(payload.Bytes(), crc32Table)
+		binary.LittleEndian.PutUint32(tmp, checksum)
+		buf.Write(tmp[:4])
+	}
+
+	for _, sectionSize := range sectionSizes {
+		numBytes = binary.PutUvarint(tmp, uint64(sectionSize))
+		buf.Write(tmp[:numBytes])
+	}
+
+	sz, err = dst.Write(buf.Bytes())
+	if err != nil {
+		return
+	}
+
+	var sz_ int
+	sz_, err = dst.Write(payload.Bytes())
+	sz += sz_
+	return
+}
+
+// It tells if the passed bytes start with an index header.
+func HasIndexHeader(src []byte) bool {
+	return bytes.HasPrefix(src, []byte(IndexMagic))
+}
+
+// It decodes and validates the header at the beginning of the passed bytes.
+//
+// It returns:
+// - the decoded header.
+// - an error in case of failure: NotAnIndex, UnsupportedVersionError,
+//   UnsupportedFeaturesError or a decoding error.
+func ReadIndexHeader(src []byte) (header IndexHeader, err error) {
+
+	if !HasIndexHeader(src) {
+		err = NotAnIndex
+		return
+	}
+
+	reader := bytes.NewReader(src[len(IndexMagic):])
+
+	var version, features uint64
+	version, err = binary.ReadUvarint(reader)
+	if err != nil {
+		err = fmt.Errorf("ReadIndexHeader: cannot decode version: %v", err)
+		return
+	}
+	if version != IndexFormatVersion {
+		err = UnsupportedVersionError{int(version)}
+		return
+	}
+
+	features, err = binary.ReadUvarint(reader)
+	if err != nil {
+		err = fmt.Errorf("ReadIndexHeader: cannot decode features: %v", err)
+		return
+	}
+	unknown := IndexFeatures(features) &^ knownIndexFeatures
+	if unknown != 0 {
+		err = UnsupportedFeaturesError{unknown}
+		return
+	}
+
+	if IndexFeatures(features)&FeatureChecksum != 0 {
+		var payloadSize uint64
+		payloadSize, err = binary.ReadUvarint(reader)
+		if err != nil {
+			err = fmt.Errorf("ReadIndexHeader: cannot decode payload size: %v",
+				err)
+			return
+		}
+		var checksum [4]byte
+		_, err = io.ReadFull(reader, checksum[:])
+		if err != nil {
+			err = fmt.Errorf("ReadIndexHeader: cannot decode checksum: %v",
+				err)
+			return
+		}
+		header.PayloadSize = int(payloadSize)
+		header.Checksum = binary.LittleEndian.Uint32(checksum[:])
+	}
+
+	// Sizes of the sections, they are placed one after the other just after
+	// the header:
+	var sizes []int
+	for feature := IndexFeatures(1); feature <= sectionFeatures; feature <<= 1 {
+		if feature&sectionFeatures&IndexFeatures(features) == 0 {
+			continue
+		}
+		var sectionSize uint64
+		sectionSize, err = binary.ReadUvarint(reader)
+		if err != nil {
+			err = fmt.Errorf("ReadIndexHeader: cannot decode section size: %v",
+				err)
+			return
+		}
+		sizes = append(sizes, int(sectionSize))
+	}
+
+	header.Version = int(version)
+	header.Features = IndexFeatures(features)
+	header.Size = len(src) - reader.Len()
+	header.TrieOffset = header.Size
+
+	i := 0
+	for feature := IndexFeatures(1); feature <= sectionFeatures; feature <<= 1 {
+		if feature&sectionFeatures&header.Features == 0 {
+			continue
+		}
+		if header.sections == nil {
+			header.sections = make(map[IndexFeatures]indexSection)
+		}
+		header.sections[feature] = indexSection{header.TrieOffset, sizes[i]}
+		header.TrieOffset += sizes[i]
+		i++
+	}
+
+	return
+}
+
+// It checks the size and the checksum of the payload following the header.
+//
+// It does nothing if the header has no FeatureChecksum.
+//
+// It returns:
+// - ChecksumMismatch if the payload is truncated or corrupted.
+func (h IndexHeader) VerifyChecksum(src []byte) (err error) {
+	return h.VerifyChecksumAt(bytes.NewReader(src), int64(len(src)))
+}
+
+// Like VerifyChecksum but it streams the payload from the passed
+// io.ReaderAt, whose total size is also given.
+func (h IndexHeader) VerifyChecksumAt(src io.ReaderAt, size int64) (
+	err error) {
+
+	if h.Features&FeatureChecksum == 0 {
+		return
+	}
+
+	if size-int64(h.Size) != int64(h.PayloadSize) {
+		err = ChecksumMismatch
+		return
+	}
+
+	hash := crc32.New(crc32Table)
+	payload := io.NewSectionReader(src, int64(h.Size), int64(h.PayloadSize))
+	_, err = io.Copy(hash, payload)
+	if err != nil {
+		err = fmt.Errorf("IndexHeader.VerifyChecksumAt: %v", err)
+		return
+	}
+
+	if hash.Sum32() != h.Checksum {
+		err = ChecksumMismatch
+	}
+
+	return
+}
@@ -0,0 +1,182 @@
+package smartsearch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestIndexHeader_Base(t *testing.T) {
+
+	buf := new(bytes.Buffer)
+	sz, err := WriteIndex(buf, 0, nil, nil)
+	if err != nil {
+		t.Errorf("Cannot write header: %v", err)
+	} else if sz != buf.Len() {
+		t.Errorf("Unexpected size: %v", sz)
+	}
+
+	expected := []byte{0x89, 'S', 'S', 'X', IndexFormatVersion, 0}
+	if bytes.Compare(buf.Bytes(), expected) != 0 {
+		t.Errorf("Unexpected serialization: %v", buf.Bytes())
+	}
+
+	header, err := ReadIndexHeader(buf.Bytes())
+	if err != nil {
+		t.Errorf("Cannot read header: %v", err)
+	} else if header.Version != IndexFormatVersion || header.Features != 0 ||
+		header.Size != len(expected) {
+		t.Errorf("Unexpected header: %v", header)
+	}
+}
+
+func TestIndexHeader_Errors(t *testing.T) {
+
+	var err error
+
+	_, err = ReadIndexHeader([]byte{0, 0})
+	if err != NotAnIndex {
+		t.Errorf("NotAnIndex was expected: %v", err)
+	}
+
+	_, err = ReadIndexHeader([]byte(IndexMagic))
+	if err == nil {
+		t.Error("Truncated header should fail")
+	}
+
+	_, err = ReadIndexHeader([]byte(IndexMagic + "\x07\x00"))
+	if versionErr, ok := err.(UnsupportedVersionError); !ok {
+		t.Errorf("UnsupportedVersionError was expected: %v", err)
+	} else if versionErr.Version != 7 {
+		t.Errorf("Unexpected version: %v", versionErr.Version)
+	}
+
+	_, err = ReadIndexHeader([]byte(IndexMagic + "\x01\x80\x08"))
+	if featuresErr, ok := err.(UnsupportedFeaturesError); !ok {
+		t.Errorf("UnsupportedFeaturesError was expected: %v", err)
+	} else if featuresErr.Features != 0x400 {
+		t.Errorf("Unexpected features: %v", featuresErr.Features)
+	}
+}
+
+func TestIndexHeader_NewIndex(t *testing.T) {
+
+	var err error
+
+	// A plain trie is not an index:
+	_, _, err = NewIndex(bytes.NewReader([]byte{0, 0}))
+	if !errors.Is(err, NotAnIndex) {
+		t.Errorf("NotAnIndex was expected: %v", err)
+	}
+
+	// An index from the future:
+	_, _, err = NewIndex(bytes.NewReader([]byte(IndexMagic + "\x02\x00\x00\x00")))
+	var versionErr UnsupportedVersionError
+	if !errors.As(err, &versionErr) {
+		t.Errorf("UnsupportedVersionError was expected: %v", err)
+	}
+
+	// Same for the trie reader:
+	_, _, err = NewTrieReader([]byte(IndexMagic + "\x02\x00\x00\x00"))
+	if !errors.As(err, &versionErr) {
+		t.Errorf("UnsupportedVersionError was expected: %v", err)
+	}
+
+	// A real index:
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "Header")
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+
+	if !HasIndexHeader(buf.Bytes()) {
+		t.Errorf("Index without header: %v", buf.Bytes())
+	}
+
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Errorf("Cannot create index: %v", err)
+	} else if postings, _ := index.Search("head", -1); len(postings) != 1 {
+		t.Errorf("Unexpected postings: %v", postings)
+	}
+}
+
+func TestIndexHeader_Checksum(t *testing.T) {
+
+	payload := []byte{0, 0}
+	buf := new(bytes.Buffer)
+	_, err := WriteIndex(buf, FeatureChecksum, nil, payload)
+	if err != nil {
+		t.Errorf("Cannot write header: %v", err)
+	}
+
+	header, err := ReadIndexHeader(buf.Bytes())
+	if err != nil {
+		t.Errorf("Cannot read header: %v", err)
+	} else if header.PayloadSize != 2 {
+		t.Errorf("Unexpected header: %v", header)
+	} else if err = header.VerifyChecksum(buf.Bytes()); err != nil {
+		t.Errorf("Unexpected checksum failure: %v", err)
+	}
+
+	// Bit flip:
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[len(corrupted)-1] ^= 0x10
+	if err = header.VerifyChecksum(corrupted); err != ChecksumMismatch {
+		t.Errorf("ChecksumMismatch was expected: %v", err)
+	}
+	_, _, err = NewTrieReader(corrupted)
+	if err != ChecksumMismatch {
+		t.Errorf("ChecksumMismatch was expected: %v", err)
+	}
+
+	// Truncation:
+	truncated := buf.Bytes()[:buf.Len()-1]
+	if err = header.VerifyChecksum(truncated); err != ChecksumMismatch {
+		t.Errorf("ChecksumMismatch was expected: %v", err)
+	}
+}
+
+func TestIndexHeader_Sections(t *testing.T) {
+
+	section := []byte{1, 2, 3}
+	trie := []byte{0, 0}
+	buf := new(bytes.Buffer)
+	features := FeatureChecksum | FeatureDocumentLengths
+	_, err := WriteIndex(buf, features,
+		IndexSections{FeatureDocumentLengths: section}, trie)
+	if err != nil {
+		t.Fatalf("Cannot write index: %v", err)
+	}
+
+	header, err := ReadIndexHeader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot read header: %v", err)
+	} else if header.PayloadSize != len(section)+len(trie) {
+		t.Errorf("Unexpected header: %v", header)
+	} else if err = header.VerifyChecksum(buf.Bytes()); err != nil {
+		t.Errorf("Unexpected checksum failure: %v", err)
+	}
+
+	offset, size, ok := header.Section(FeatureDocumentLengths)
+	if !ok || size != len(section) ||
+		!bytes.Equal(buf.Bytes()[offset:offset+size], section) {
+		t.Errorf("Unexpected section: offset=%v size=%v", offset, size)
+	} else if header.TrieOffset != offset+size {
+		t.Errorf("Unexpected trie offset: %v", header.TrieOffset)
+	}
+
+	if _, _, ok = header.Section(FeatureChecksum); ok {
+		t.Error("Unexpected section")
+	}
+
+	// Sections and features must match:
+	_, err = WriteIndex(new(bytes.Buffer), features, nil, trie)
+	if err == nil {
+		t.Error("Missing section should fail")
+	}
+	_, err = WriteIndex(new(bytes.Buffer), FeatureChecksum,
+		IndexSections{FeatureDocumentLengths: section}, trie)
+	if err == nil {
+		t.Error("Unexpected section should fail")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package smartsearch
+
+import (
+	"io"
+	"os"
+)
+
+// Fallback for platforms without memory mapping: it just reads the whole
+// content of the passed file.
+func mmapFile(file *os.File, size int) (bytes_ []byte, err error) {
+	bytes_ = make([]byte, size)
+	_, err = io.ReadFull(file, bytes_)
+	if err != nil {
+		bytes_ = nil
+	}
+	return
+}
+
+// It releases bytes previously returned by mmapFile.
+func munmapFile(bytes_ []byte) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package smartsearch
+
+import (
+	"os"
+	"syscall"
+)
+
+// It maps the whole content of the passed file in memory, read only.
+//
+// Pages are loaded lazily by the operating system and shared between all the
+// processes mapping the same file.
+func mmapFile(file *os.File, size int) (bytes_ []byte, err error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ,
+		syscall.MAP_SHARED)
+}
+
+// It releases bytes previously returned by mmapFile.
+func munmapFile(bytes_ []byte) error {
+	return syscall.Munmap(bytes_)
+}
@@ -0,0 +1,133 @@
+package smartsearch
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Statistics of the cache of nodes of an Index (see Index.SetNodeCache).
+type NodeCacheStats struct {
+	Size    int   `json:"size"`    // Maximum number of nodes, 0 if no cache.
+	Entries int   `json:"entries"` // Number of nodes currently cached.
+	Hits    int64 `json:"hits"`    // Terms whose node was found in the cache.
+	Misses  int64 `json:"misses"`  // Terms that had to be matched on the trie.
+}
+
+// A bounded cache of the nodes matched by the terms of the queries, that
+// discards the least recently used ones when full.
+//
+// Terms not found on the trie are cached too, with a zero Node.
+//
+// It is safe for concurrent use.
+type nodeCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element // Elements of lru by term.
+	lru     list.List                // Of nodeCacheEntry, most recent first.
+	hits    int64
+	misses  int64
+}
+
+// One cached node with its term.
+type nodeCacheEntry struct {
+	term string
+	node Node
+}
+
+// It creates a cache keeping at most the given number of nodes.
+func newNodeCache(size int) (cache *nodeCache) {
+	cache = &nodeCache{size: size, entries: make(map[string]*list.Element)}
+	return
+}
+
+// It looks for the node of the given term.
+//
+// It returns:
+// - the cached node.
+// - false if the term is not in the cache.
+func (nc *nodeCache) get(term string) (node Node, ok bool) {
+
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	var element *list.Element
+	element, ok = nc.entries[term]
+	if !ok {
+		nc.misses++
+		return
+	}
+
+	nc.hits++
+	nc.lru.MoveToFront(element)
+	node = element.Value.(*nodeCacheEntry).node
+	return
+}
+
+// It caches the node of the given term, discarding the least recently used
+// one if the cache is full.
+func (nc *nodeCache) put(term string, node Node) {
+
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	if element, ok := nc.entries[term]; ok {
+		element.Value.(*nodeCacheEntry).node = node
+		nc.lru.MoveToFront(element)
+		return
+	}
+
+	if nc.lru.Len() >= nc.size {
+		oldest := nc.lru.Back()
+		if oldest == nil {
+			return // Size is 0.
+		}
+		nc.lru.Remove(oldest)
+		delete(nc.entries, oldest.Value.(*nodeCacheEntry).term)
+	}
+	nc.entries[term] = nc.lru.PushFront(&nodeCacheEntry{term, node})
+}
+
+// It returns the statistics of the cache.
+func (nc *nodeCache) stats() (stats NodeCacheStats) {
+
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	stats = NodeCacheStats{
+		Size:    nc.size,
+		Entries: nc.lru.Len(),
+		Hits:    nc.hits,
+		Misses:  nc.misses}
+	return
+}
+
+// It matches the given term from the root node, like Reset followed by Match,
+// taking the node from the cache of the cursor if it has one (see
+// indexImpl.cursor).
+//
+// It returns:
+// - information about the final node, a zero Node if the term is not found.
+// - an error in case of failure.
+func (c *Cursor) matchTerm(term string) (node Node, err error) {
+
+	if c.nodes != nil {
+		var ok bool
+		node, ok = c.nodes.get(term)
+		if ok {
+			if node != (Node{}) {
+				err = c.JumpNode(node)
+			}
+			return
+		}
+	}
+
+	_, err = c.Reset()
+	if err != nil {
+		return
+	}
+	node, err = c.Match(term)
+	if err == nil && c.nodes != nil {
+		c.nodes.put(term, node)
+	}
+	return
+}
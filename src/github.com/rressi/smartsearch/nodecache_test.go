@@ -0,0 +1,98 @@
+package smartsearch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNodeCache_Base(t *testing.T) {
+
+	cache := newNodeCache(2)
+	nodes := []Node{{NumPostings: 1}, {NumPostings: 2}, {NumPostings: 3}}
+
+	if _, ok := cache.get("a"); ok {
+		t.Error("Unexpected node in an empty cache")
+	}
+	cache.put("a", nodes[0])
+	cache.put("b", nodes[1])
+	if node, ok := cache.get("a"); !ok || node != nodes[0] {
+		t.Errorf("Unexpected node for 'a': %v %v", node, ok)
+	}
+
+	// 'b' is now the least recently used:
+	cache.put("c", nodes[2])
+	if _, ok := cache.get("b"); ok {
+		t.Error("Node 'b' not discarded")
+	}
+	if node, ok := cache.get("a"); !ok || node != nodes[0] {
+		t.Errorf("Unexpected node for 'a': %v %v", node, ok)
+	}
+	if node, ok := cache.get("c"); !ok || node != nodes[2] {
+		t.Errorf("Unexpected node for 'c': %v %v", node, ok)
+	}
+
+	stats := cache.stats()
+	expected := NodeCacheStats{Size: 2, Entries: 2, Hits: 3, Misses: 2}
+	if stats != expected {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestNodeCache_Index(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "golden gate bridge")
+	builder.AddDocument(2, "golden gardens park")
+	builder.AddDocument(3, "bay bridge")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	if stats := index.NodeCacheStats(); stats != (NodeCacheStats{}) {
+		t.Errorf("Unexpected stats without cache: %+v", stats)
+	}
+	index.SetNodeCache(16)
+
+	queries := []struct {
+		query    string
+		expected []int
+	}{
+		{"golden ga", []int{1, 2}},
+		{"bridge", []int{1, 3}},
+		{"golden gate", []int{1}},
+		{"missing", nil},
+		{"\"golden gate\"", []int{1}}}
+	for round := 0; round < 2; round++ {
+		for _, query := range queries {
+			postings, err := index.Search(query.query, -1)
+			if err != nil {
+				t.Errorf("Search '%v' failed: %v", query.query, err)
+			} else if !reflect.DeepEqual(postings, query.expected) {
+				t.Errorf("Unexpected postings for '%v': %v", query.query,
+					postings)
+			}
+		}
+	}
+
+	// Terms matched once are all found in the cache the next times:
+	stats := index.NodeCacheStats()
+	expected := NodeCacheStats{Size: 16, Entries: 5, Hits: 11, Misses: 5}
+	if stats != expected {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	results, err := index.SearchRanked("golden ga", -1)
+	if err != nil || len(results) != 2 {
+		t.Errorf("Unexpected ranked results: %v %v", results, err)
+	}
+
+	index.SetNodeCache(0)
+	if stats := index.NodeCacheStats(); stats != (NodeCacheStats{}) {
+		t.Errorf("Unexpected stats without cache: %+v", stats)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"golang.org/x/text/unicode/norm"
+	"math"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 )
@@ -14,70 +16,254 @@ type Normalizer interface {
 }
 
 type normalizerImpl struct {
-	normalizationMap []rune
-	spaceCount       int
+	table      *normalizationTable
+	spaceCount int
 }
 
+// Runes normalized by the first version of the normalizer, the letters and
+// digits above it were left as they are.
 const MAX_MAP = (2 << 16)
 
+// Version of the normalization, it is increased every time the text is
+// normalized differently. Version 1 normalized only the runes below MAX_MAP,
+// without compatibility decomposition and each rune to exactly one rune,
+// leaving letters like "ß", "ς" and "ı" as they are. Versions 2 and 3 have
+// never been released.
+const normalizerVersion = 4
+
+// Letters that are folded in many letters after version 1, as they are often
+// written that way: the German "straße" as "strasse", the French "cœur" as
+// "coeur". Ligatures like "ﬁ" and digraphs like "ǆ" are expanded by their
+// compatibility decomposition instead.
+var letterExpansions = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'œ': "oe"}
+
+// What a normalization table does.
+type normalizationOptions struct {
+	version      int          // See normalizerVersion.
+	language     language.Tag // Language for lower-casing, if withLanguage.
+	withLanguage bool         // See NewNormalizerWithLanguage.
+}
+
+// It returns a key identifying normalization tables with the same options.
+func (o normalizationOptions) key() string {
+	if o.withLanguage {
+		return fmt.Sprintf("%v:%v", o.version, o.language)
+	}
+	return fmt.Sprintf("%v:", o.version)
+}
+
+// Normalization tables already generated, shared by all the normalizers with
+// the same options (see normalizationOptions.key).
+var normalizationTables = struct {
+	sync.Mutex
+	byKey map[string]*normalizationTable
+}{byKey: make(map[string]*normalizationTable)}
+
 func NewNormalizer() Normalizer {
+	return newNormalizer(normalizationOptions{version: normalizerVersion})
+}
+
+// Like NewNormalizer but letters are lower-cased with the rules of the given
+// language, like the Turkish dotted and dotless i ("I" becomes "ı" and "İ"
+// becomes "i").
+//
+// The Greek final sigma "ς" becomes "σ" as well, as it is just the form of
+// "σ" at the end of a word: a per-rune map cannot tell which one is the lower
+// case of "Σ". The dotless "ı" is not folded in "i", as NewNormalizer does,
+// because in that language they are different letters.
+//
+// The same normalizer has to be used for the documents and for the queries,
+// as the one of LanguageAnalyzer.
+//
+// The normalization table of each language is generated once and shared.
+func NewNormalizerWithLanguage(tag language.Tag) Normalizer {
+	return newNormalizer(normalizationOptions{
+		version:      normalizerVersion,
+		language:     tag,
+		withLanguage: true})
+}
+
+// It creates a normalizer with the given options, sharing its table with the
+// other normalizers with the same options.
+func newNormalizer(options normalizationOptions) Normalizer {
+
+	normalizationTables.Lock()
+	defer normalizationTables.Unlock()
+
+	table, ok := normalizationTables.byKey[options.key()]
+	if !ok {
+		table = makeNormalizationTable(options)
+		normalizationTables.byKey[options.key()] = table
+	}
 
 	normalizer := new(normalizerImpl)
+	normalizer.table = table
+	return normalizer
+}
+
+// Runes are grouped in blocks of 1<<normalizationBlockBits runes.
+const (
+	normalizationBlockBits = 8
+	normalizationBlockMask = 1<<normalizationBlockBits - 1
+)
+
+// Entry of a normalization table for the runes that become separators.
+const normalizationSeparator = math.MinInt32
+
+// Entries of a normalization table for the runes that become many runes: the
+// entry normalizationExpansion-i is for expansion i.
+const normalizationExpansion = -2 * (unicode.MaxRune + 1)
+
+// A table to normalize all the runes of UNICODE, in two levels: runes are
+// grouped in blocks and the blocks with the same entries are stored once.
+//
+// The entry of each rune is the difference between the normalized rune and
+// the rune itself, normalizationSeparator or the one of an expansion (see
+// normalizationExpansion). This way all the blocks of unassigned runes are
+// the same, and so are the ones of runes that are left as they are, like the
+// ideographs.
+type normalizationTable struct {
+	blocks     []uint16 // Block of each group of runes, by rune >> bits.
+	entries    []int32  // Entries of the distinct blocks, one after another.
+	expansions []string // Runes normalized to many runes, in UTF-8.
+}
+
+// The entries of one block of a normalization table.
+type normalizationBlock [1 << normalizationBlockBits]int32
+
+// It generates the normalization table with the given options.
+func makeNormalizationTable(
+	options normalizationOptions) (table *normalizationTable) {
 
-	// Uses the transformer to generate a normalization map:
-	normalizer.normalizationMap = make([]rune, MAX_MAP)
 	toLowerCase := cases.Lower(language.English)
-	for r := rune(0); r < rune(MAX_MAP); r++ {
+	if options.withLanguage {
+		toLowerCase = cases.Lower(options.language)
+	}
 
-		// We normalize only letters and digits, everything else is considered
-		// as a separator:
-		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
-			normalizer.normalizationMap[r] = 0
-			continue
+	table = &normalizationTable{
+		blocks: make([]uint16, (unicode.MaxRune+1)>>normalizationBlockBits)}
+	distinct := make(map[normalizationBlock]uint16)
+	expansions := make(map[string]int32)
+	var block normalizationBlock
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+
+		normalized := normalizeRune(r, toLowerCase, options)
+		nr, size := utf8.DecodeRuneInString(normalized)
+		if normalized == "" {
+			block[r&normalizationBlockMask] = normalizationSeparator
+		} else if size == len(normalized) {
+			block[r&normalizationBlockMask] = int32(nr - r)
+		} else {
+			id, ok := expansions[normalized]
+			if !ok {
+				id = int32(len(table.expansions))
+				expansions[normalized] = id
+				table.expansions = append(table.expansions, normalized)
+			}
+			block[r&normalizationBlockMask] = normalizationExpansion - id
 		}
 
-		// Takes the rune as UTF-8:
-		var src [16]byte
-		nSrc := utf8.EncodeRune(src[:], r)
-
-		// To lower case:
-		var dst [16]byte
-		nDst, _, err := toLowerCase.Transform(dst[:], src[:nSrc], true)
-		if nDst == 0 || err != nil {
-			normalizer.normalizationMap[r] = 0
-			panic(fmt.Sprintf("Cannot lower-case rune '%c' (%v): %v\n", r, r,
-				err))
+		// Stores each block once, at its last rune:
+		if r&normalizationBlockMask == normalizationBlockMask {
+			id, ok := distinct[block]
+			if !ok {
+				id = uint16(len(distinct))
+				distinct[block] = id
+				table.entries = append(table.entries, block[:]...)
+			}
+			table.blocks[r>>normalizationBlockBits] = id
 		}
+	}
 
-		// Unicode normalization:
-		var dst2 [16]byte
-		nDst2, _, err := norm.NFD.Transform(dst2[:], dst[:nDst], true)
-		if nDst2 == 0 || err != nil {
-			normalizer.normalizationMap[r] = 0
-			panic(fmt.Sprintf("Cannot normalize rune '%c' (%v): %v\n", r, r,
-				err))
+	return
+}
+
+// It normalizes one rune with the given lower-caser and options.
+//
+// It returns:
+// - the normalized runes in UTF-8, empty if the rune is a separator.
+func normalizeRune(r rune, toLowerCase cases.Caser,
+	options normalizationOptions) (normalized string) {
+
+	// We normalize only letters and digits, everything else is considered
+	// as a separator:
+	if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+		return
+	} else if options.version == 1 && r >= MAX_MAP {
+		normalized = string(r)
+		return
+	}
+
+	// Compatibility decomposition, so that for example the mathematical bold
+	// "𝐕" becomes "V" and the full width "Ａ" becomes "A":
+	text := string(r)
+	if options.version > 1 {
+		text = norm.NFKD.String(text)
+	}
+
+	// To lower case and then Unicode normalization:
+	text = norm.NFD.String(toLowerCase.String(text))
+
+	// Takes the first rune, after version 1 also the letters and digits
+	// following it but not the combining marks:
+	var folded []rune
+	for _, nr := range text {
+		if nr == 0 || nr == utf8.RuneError {
+			panic(fmt.Sprintf("Cannot normalize rune '%c' (%v) to %q\n", r,
+				r, text))
+		} else if len(folded) > 0 && (options.version == 1 ||
+			(!unicode.IsLetter(nr) && !unicode.IsDigit(nr))) {
+			continue
 		}
 
-		// From UTF-8:
-		var nr rune
-		nr, _ = utf8.DecodeRune(dst2[:nDst2])
-		if nr == 0 {
-			panic(fmt.Sprintf("Cannot decode rune '%c' (%v) fron bytes %v\n",
-				r, r, dst2[:nDst2]))
+		// After version 1 the letters whose lower case depends on the
+		// language are folded, so that a query matches whatever the language
+		// of the documents and however it is typed: the Greek final sigma
+		// "ς" becomes "σ", the Turkish dotless "ı" becomes "i" unless the
+		// language tells it apart (see NewNormalizerWithLanguage):
+		if nr == 'ς' && options.version > 1 {
+			nr = 'σ'
+		} else if nr == 'ı' && options.version > 1 && !options.withLanguage {
+			nr = 'i'
 		}
+		if expansion, ok := letterExpansions[nr]; ok && options.version > 1 {
+			folded = append(folded, []rune(expansion)...)
+		} else {
+			folded = append(folded, nr)
+		}
+	}
 
-		/*
-			if r == nr {
-				fmt.Printf("[%c] %v\n", r, r)
-			} else {
-				fmt.Printf("[%c] %v -> [%c] %v\n", r, r, nr, nr)
-			}
-		*/
+	normalized = string(folded)
+	return
+}
+
+// It normalizes the given rune.
+//
+// It returns:
+// - the normalized rune, 0 if it is a separator.
+// - the normalized runes in UTF-8 if they are many, empty otherwise.
+func (t *normalizationTable) lookup(r rune) (nr rune, expansion string) {
 
-		normalizer.normalizationMap[r] = nr
+	if r < 0 || r > unicode.MaxRune {
+		return
 	}
 
-	return normalizer
+	block := int(t.blocks[r>>normalizationBlockBits])
+	entry := t.entries[block<<normalizationBlockBits|
+		int(r&normalizationBlockMask)]
+	if entry == normalizationSeparator {
+		return
+	} else if entry <= normalizationExpansion {
+		expansion = t.expansions[normalizationExpansion-entry]
+		nr, _ = utf8.DecodeRuneInString(expansion)
+		return
+	}
+
+	nr = r + rune(entry)
+	return
 }
 
 func (n *normalizerImpl) Apply(src string) (result string) {
@@ -91,9 +277,8 @@ func (n *normalizerImpl) Apply(src string) (result string) {
 	nDst := 0
 	nSeparators := 1
 	for _, r := range src {
-		if r < MAX_MAP {
-			r = n.normalizationMap[r]
-		}
+		var expansion string
+		r, expansion = n.table.lookup(r) // Private use areas are separators.
 		if r == 0 {
 			r = ' '
 			nSeparators++
@@ -101,7 +286,17 @@ func (n *normalizerImpl) Apply(src string) (result string) {
 			nSeparators = 0
 		}
 		if nSeparators <= 1 {
-			nDst += utf8.EncodeRune(dst[nDst:], r)
+			// A normalized rune can take more bytes than the original one,
+			// like the Turkish 'ı' for 'I' or "ss" for 'ß':
+			if len(dst)-nDst < utf8.UTFMax+len(expansion) {
+				dst = append(dst,
+					make([]byte, utf8.UTFMax+len(expansion))...)
+			}
+			if expansion != "" {
+				nDst += copy(dst[nDst:], expansion)
+			} else {
+				nDst += utf8.EncodeRune(dst[nDst:], r)
+			}
 		}
 	}
 
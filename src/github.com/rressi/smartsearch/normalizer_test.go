@@ -1,6 +1,7 @@
 package smartsearch
 
 import (
+	"golang.org/x/text/language"
 	"testing"
 )
 
@@ -16,4 +17,113 @@ func TestNormalizer_Base(t *testing.T) {
 		t.Errorf("Unexpected result: '%v' and not '%v'", normalized,
 			expectedNormalized)
 	}
+
+	// Runes of private use areas are separators, also the ones of fields:
+	query = "a" + fieldPrefix(0) + "b\U0010FFFDc"
+	expectedNormalized = "a b c"
+	normalized = normalizer.Apply(query)
+	if normalized != expectedNormalized {
+		t.Errorf("Unexpected result: '%v' and not '%v'", normalized,
+			expectedNormalized)
+	}
+}
+
+func TestNormalizer_Language(t *testing.T) {
+
+	tests := []struct {
+		tag        language.Tag
+		query      string
+		normalized string
+	}{
+		{language.Turkish, "IŞIK İstanbul", "ısık istanbul"},
+		{language.Greek, "ΟΔΟΣ οδος", "οδοσ οδοσ"},
+		{language.English, "IŞIK ΟΔΟΣ οδος", "isik οδοσ οδοσ"}}
+	for _, test := range tests {
+		normalized := NewNormalizerWithLanguage(test.tag).Apply(test.query)
+		if normalized != test.normalized {
+			t.Errorf("Unexpected result with %v: '%v' and not '%v'",
+				test.tag, normalized, test.normalized)
+		}
+	}
+
+	// The default normalizer folds the letters whose lower case depends on
+	// the language:
+	normalized := NewNormalizer().Apply("IŞIK ışık İSTANBUL οδος ΟΔΟΣ")
+	if normalized != "isik isik istanbul οδοσ οδοσ" {
+		t.Errorf("Unexpected result: '%v'", normalized)
+	}
+
+	// In the first version they were left as they are:
+	legacy := newNormalizer(normalizationOptions{version: 1})
+	normalized = legacy.Apply("ışık οδος")
+	if normalized != "ısık οδος" {
+		t.Errorf("Unexpected result: '%v'", normalized)
+	}
+
+	// Normalization tables are shared:
+	first := NewNormalizerWithLanguage(language.Turkish).(*normalizerImpl)
+	second := NewNormalizerWithLanguage(language.Turkish).(*normalizerImpl)
+	if first.table != second.table {
+		t.Error("Normalization table not shared")
+	}
+}
+
+func TestNormalizer_SupplementaryPlanes(t *testing.T) {
+
+	normalizer := NewNormalizer()
+	tests := []struct {
+		query      string
+		normalized string
+	}{
+		{"𝐕𝐞𝐫𝐭𝐢𝐠𝐨", "vertigo"},           // Mathematical bold.
+		{"𝖁𝖊𝖗𝖙𝖎𝖌𝖔 𝟏𝟗𝟓𝟖", "vertigo 1958"}, // Fraktur, digits.
+		{"Ｖｅｒｔｉｇｏ", "vertigo"},           // Full width.
+		{"𐐀𐐨", "𐐨𐐨"},                     // Deseret, lower-cased.
+		{"𓀀 𠀀", "𓀀 𠀀"},                   // Hieroglyph and ideograph.
+		{"a😀b\U000E0041c", "a b c"},      // Emoji and tags are separators.
+		{"a\U0010FFFFb", "a b"}}          // Not a character.
+	for _, test := range tests {
+		normalized := normalizer.Apply(test.query)
+		if normalized != test.normalized {
+			t.Errorf("Unexpected result: '%v' and not '%v'", normalized,
+				test.normalized)
+		}
+	}
+
+	// The first version normalized only the runes below MAX_MAP, and
+	// without compatibility decomposition:
+	legacy := newNormalizer(normalizationOptions{version: 1})
+	normalized := legacy.Apply("𝐕𝐞𝐫𝐭𝐢𝐠𝐨 Ｖｅｒｔｉｇｏ 𐐀")
+	if normalized != "𝐕𝐞𝐫𝐭𝐢𝐠𝐨 ｖｅｒｔｉｇｏ 𐐨" {
+		t.Errorf("Unexpected result: '%v'", normalized)
+	}
+}
+
+func TestNormalizer_Expansions(t *testing.T) {
+
+	normalizer := NewNormalizer()
+	tests := []struct {
+		query      string
+		normalized string
+	}{
+		{"Straße STRAẞE", "strasse strasse"},
+		{"Æsir cœur ŒUVRE", "aesir coeur oeuvre"},
+		{"ﬁnal ﬂow", "final flow"}, // Ligatures.
+		{"Ǆ ǅ ǆ", "dz dz dz"},      // Digraphs.
+		{"ǣ Ǽ", "ae ae"}}           // With their diacritics removed.
+	for _, test := range tests {
+		normalized := normalizer.Apply(test.query)
+		if normalized != test.normalized {
+			t.Errorf("Unexpected result: '%v' and not '%v'", normalized,
+				test.normalized)
+		}
+	}
+
+	// In the first version each rune became exactly one rune, without
+	// compatibility decomposition:
+	legacy := newNormalizer(normalizationOptions{version: 1})
+	normalized := legacy.Apply("Straße Æ ﬁ Ǆ")
+	if normalized != "straße æ ﬁ ǆ" {
+		t.Errorf("Unexpected result: '%v'", normalized)
+	}
 }
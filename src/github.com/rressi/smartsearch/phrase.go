@@ -0,0 +1,189 @@
+package smartsearch
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// It represents a quoted phrase of a query.
+type Phrase struct {
+	Terms []string // Normalized terms, in the same order of the query.
+	Slop  int      // Number of extra terms allowed between the terms.
+}
+
+// Maximum slop of a phrase, a larger one is reduced to this. The fields of a
+// document are indexed with a larger gap between their positions (see
+// fieldPositionGap), so that phrases never match across fields.
+const maxPhraseSlop = 100
+
+// It extracts the quoted phrases from the passed query.
+//
+// A phrase is some text between double quotes optionally followed by '~' and
+// by the slop, the maximum number of extra terms that can be found between
+// the terms of the phrase, as in "golden gate"~2. The slop is at most
+// maxPhraseSlop. A quote not closed is ignored.
+//
+// It returns:
+// - the phrases, with the terms normalized with the given tokenizer.
+// - the remaining query, where each phrase is replaced by a space.
+func ExtractPhrases(query string, tokenizer Tokenizer) (phrases []Phrase,
+	remaining string) {
+
+	var rest strings.Builder
+	for {
+		begin := strings.IndexByte(query, '"')
+		if begin < 0 {
+			break
+		}
+		end := strings.IndexByte(query[begin+1:], '"')
+		if end < 0 {
+			break // Not closed.
+		}
+		end += begin + 1
+
+		phrase := Phrase{Terms: tokenizer.Apply(query[begin+1 : end])}
+		end++
+
+		// Optional slop:
+		if end < len(query) && query[end] == '~' {
+			digits := end + 1
+			for digits < len(query) && query[digits] >= '0' &&
+				query[digits] <= '9' {
+				digits++
+			}
+			if digits > end+1 {
+				// Too many digits do not fit an int:
+				slop, err := strconv.Atoi(query[end+1 : digits])
+				if err != nil || slop > maxPhraseSlop {
+					slop = maxPhraseSlop
+				}
+				phrase.Slop = slop
+				end = digits
+			}
+		}
+
+		if len(phrase.Terms) > 0 {
+			phrases = append(phrases, phrase)
+		}
+		rest.WriteString(query[:begin])
+		rest.WriteByte(' ')
+		query = query[end:]
+	}
+	rest.WriteString(query)
+
+	remaining = rest.String()
+	return
+}
+
+// It traverses the trie from the root node and collects the documents where
+// the terms of the given phrase are found in the same order, with at most
+// phrase.Slop extra terms between them all together.
+//
+// If the trie has not been generated with FeaturePositions the order of the
+// terms cannot be checked: all the documents containing all the terms match.
+//
+// At the end of the traversal the cursor is left in an undefined position,
+// methods Reset or JumpNode can be used to continue using it.
+//
+// It returns:
+// - postings of matching documents, sorted and deduplicated.
+// - an error in case of failure.
+func (c *Cursor) MatchPhrase(phrase Phrase) (postings []int, err error) {
+
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.MatchPhrase(%v): %v", phrase.Terms,
+				err)
+		}
+	}()
+
+	// Postings and positions of each term:
+	var candidates []int
+	termPostings := make([][]int, len(phrase.Terms))
+	termPositions := make([][][]int, len(phrase.Terms))
+	for i, term := range phrase.Terms {
+		var node Node
+		node, err = c.matchTerm(term)
+		if err != nil || node.NumPostings == 0 {
+			return
+		}
+
+		termPostings[i], termPositions[i], err =
+			c.ReadAllPostingsWithPositions()
+		if err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			return
+		}
+
+		if i == 0 {
+			candidates = termPostings[i]
+		} else {
+			candidates = IntersectPostings(candidates, termPostings[i])
+			if len(candidates) == 0 {
+				return // No result!
+			}
+		}
+	}
+
+	if c.trie.header.Features&FeaturePositions == 0 || len(phrase.Terms) < 2 {
+		postings = candidates
+		return
+	}
+
+	// Checks the positions in each candidate document:
+	next := make([]int, len(phrase.Terms))
+	positions := make([][]int, len(phrase.Terms))
+	for _, candidate := range candidates {
+		for i := range phrase.Terms {
+			for termPostings[i][next[i]] < candidate {
+				next[i]++
+			}
+			positions[i] = termPositions[i][next[i]]
+		}
+		if matchPhrasePositions(positions, phrase.Slop) {
+			postings = append(postings, candidate)
+		}
+	}
+
+	return
+}
+
+// It tells if, given the sorted positions of each term of a phrase in one
+// document, the terms are found in order with at most slop extra terms
+// between them.
+func matchPhrasePositions(positions [][]int, slop int) bool {
+
+	next := make([]int, len(positions))
+	for _, start := range positions[0] {
+
+		// Picking each time the nearest following position is the best
+		// choice, it leaves all the options open for the next terms:
+		previous := start
+		extra := 0
+		i := 1
+		for ; i < len(positions); i++ {
+			for next[i] < len(positions[i]) &&
+				positions[i][next[i]] <= previous {
+				next[i]++
+			}
+			if next[i] == len(positions[i]) {
+				return false // No more occurrences of this term.
+			}
+			extra += positions[i][next[i]] - previous - 1
+			if extra > slop {
+				break
+			}
+			previous = positions[i][next[i]]
+		}
+		if i == len(positions) {
+			return true
+		}
+	}
+
+	return false
+}
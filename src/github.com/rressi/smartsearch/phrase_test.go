@@ -0,0 +1,109 @@
+package smartsearch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExtractPhrases(t *testing.T) {
+
+	tokenizer := NewTokenizer()
+	phrases, remaining := ExtractPhrases(
+		`park "Golden Gate"~2 in "San Francisco" "!!" "open`, tokenizer)
+
+	expected := []Phrase{
+		{[]string{"golden", "gate"}, 2},
+		{[]string{"san", "francisco"}, 0}}
+	if !reflect.DeepEqual(phrases, expected) {
+		t.Errorf("Unexpected phrases: %v", phrases)
+	}
+	if remaining != `park   in     "open` {
+		t.Errorf("Unexpected remaining query: [%v]", remaining)
+	}
+
+	// The slop is at most maxPhraseSlop:
+	for _, query := range []string{`"a b"~1000`, `"a b"~99999999999999999999`} {
+		phrases, remaining = ExtractPhrases(query, tokenizer)
+		if len(phrases) != 1 || phrases[0].Slop != maxPhraseSlop ||
+			remaining != " " {
+			t.Errorf("Unexpected phrases: %v [%v]", phrases, remaining)
+		}
+	}
+}
+
+func TestMatchPhrasePositions(t *testing.T) {
+
+	positions := [][]int{{1, 10}, {4, 12}, {13}}
+	expected := map[int]bool{0: false, 1: true, 2: true, 5: true}
+	for slop, result := range expected {
+		if matchPhrasePositions(positions, slop) != result {
+			t.Errorf("Unexpected result with slop %v", slop)
+		}
+	}
+
+	// Order matters:
+	if matchPhrasePositions([][]int{{5}, {4}}, 10) {
+		t.Error("Unexpected match")
+	}
+
+	// The same term twice:
+	if !matchPhrasePositions([][]int{{3, 4}, {3, 4}}, 0) {
+		t.Error("Unexpected mismatch")
+	}
+}
+
+func TestIndex_SearchPhrase(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "Golden Gate Park")
+	builder.AddDocument(2, "Gate of the Golden Temple")
+	builder.AddDocument(3, "The golden old gate")
+	builder.AddDocument(4, "Golden Gate Bridge")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	queries := []string{`"golden gate"`, `golden gate `, `"golden gate"~1`,
+		`"golden gate" park`, `"golden gate" par`, `"gate golden"`,
+		`"golden gate park bridge"~10`, `"golden"`}
+	all_expected_postings := [][]int{{1, 4}, {1, 2, 3, 4}, {1, 3, 4}, {1},
+		{1}, nil, nil, {1, 2, 3, 4}}
+	for i, query := range queries {
+		postings, err := index.Search(query, -1)
+		if err != nil {
+			t.Errorf("Search failed with query %v: %v", query, err)
+		} else if !reflect.DeepEqual(postings, all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query [%v]: postings=%v", query,
+				postings)
+		}
+	}
+}
+
+func TestIndex_SearchPhraseWithoutPositions(t *testing.T) {
+
+	trieBuilder := NewTrieBuilder()
+	trieBuilder.Add(1, "golden")
+	trieBuilder.Add(1, "gate")
+	trieBuilder.Add(2, "golden")
+	trieBytes := new(bytes.Buffer)
+	trieBuilder.Dump(trieBytes)
+
+	buf := new(bytes.Buffer)
+	WriteIndex(buf, FeatureChecksum, nil, trieBytes.Bytes())
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	postings, err := index.Search(`"gate golden"`, -1)
+	if err != nil {
+		t.Errorf("Search failed: %v", err)
+	} else if !reflect.DeepEqual(postings, []int{1}) {
+		t.Errorf("Unexpected result: postings=%v", postings)
+	}
+}
@@ -0,0 +1,536 @@
+package smartsearch
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// An iterator decoding lazily a sorted and deduplicated sequence of postings.
+//
+// Iterators can be combined (see IntersectPostingIterators and
+// UnitePostingIterators) to decode only the postings needed to produce the
+// first results of a query, as when a limit is given.
+type PostingIterator interface {
+
+	// It returns the next posting, or io.EOF if there are no more postings.
+	Next() (posting int, err error)
+
+	// It skips all the postings lower than target and returns the next one,
+	// or io.EOF if there are no more postings.
+	SkipTo(target int) (posting int, err error)
+}
+
+// It reads the postings from the given iterator.
+//
+// It returns:
+// - at most limit postings (all of them if limit is negative).
+// - an error in case of failure.
+func ReadPostingIterator(iterator PostingIterator, limit int) (
+	postings []int, err error) {
+
+	var postings_ []int
+	for limit < 0 || len(postings_) < limit {
+		var posting int
+		posting, err = iterator.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		postings_ = append(postings_, posting)
+	}
+
+	postings = postings_
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// Iterator on the postings of a slice.
+type slicePostingIterator struct {
+	postings []int // Postings not returned yet.
+}
+
+// It creates an iterator on the given sorted and deduplicated postings.
+func NewSlicePostingIterator(postings []int) PostingIterator {
+	return &slicePostingIterator{postings}
+}
+
+// Implementation of PostingIterator.Next.
+func (it *slicePostingIterator) Next() (posting int, err error) {
+	if len(it.postings) == 0 {
+		err = io.EOF
+		return
+	}
+	posting = it.postings[0]
+	it.postings = it.postings[1:]
+	return
+}
+
+// Implementation of PostingIterator.SkipTo.
+func (it *slicePostingIterator) SkipTo(target int) (posting int, err error) {
+	i := GallopPostings(it.postings, 0, target)
+	it.postings = it.postings[i:]
+	return it.Next()
+}
+
+// -----------------------------------------------------------------------------
+
+// The state of a cursor decoding the postings of one node.
+type postingsState struct {
+	offset          int
+	postingsLeft    int
+	posting         int
+	edgesOffset     int
+	numPostings     int
+	skipsOffset     int
+	skipsLeft       int
+	skipPosting     int
+	skipBlockOffset int
+	skipBlock       int
+	container       int
+	containerOffset int
+	containerWord   int
+	containerBase   int
+}
+
+// It returns the state of this cursor decoding the postings of a node.
+func (c *Cursor) postingsState() postingsState {
+	return postingsState{c.tell(), c.postingsLeft, c.posting, c.edgesOffset,
+		c.numPostings, c.skipsOffset, c.skipsLeft, c.skipPosting,
+		c.skipBlockOffset, c.skipBlock, c.container, c.containerOffset,
+		c.containerWord, c.containerBase}
+}
+
+// It restores the state of this cursor decoding the postings of a node, as
+// returned by postingsState. Edges cannot be decoded after it.
+func (c *Cursor) setPostingsState(state postingsState) (err error) {
+	err = c.seek(state.offset)
+	c.postingsLeft = state.postingsLeft
+	c.edgesLeft = 0
+	c.posting = state.posting
+	c.edgesOffset = state.edgesOffset
+	c.numPostings = state.numPostings
+	c.skipsOffset = state.skipsOffset
+	c.skipsLeft = state.skipsLeft
+	c.skipPosting = state.skipPosting
+	c.skipBlockOffset = state.skipBlockOffset
+	c.skipBlock = state.skipBlock
+	c.container = state.container
+	c.containerOffset = state.containerOffset
+	c.containerWord = state.containerWord
+	c.containerBase = state.containerBase
+	return
+}
+
+// Iterator on the postings of one node of a trie.
+//
+// Many of them can share the same cursor to decode their postings, as each
+// call restores the state of the cursor from the iterator.
+type nodePostingIterator struct {
+	cursor *Cursor
+	state  postingsState
+}
+
+// It creates an iterator on the postings of the given node.
+//
+// The node is checked like with Cursor.JumpNode, the cursor is used only to
+// decode the postings and it is left in an undefined state.
+func newNodePostingIterator(cursor *Cursor, node Node) (
+	it *nodePostingIterator, err error) {
+
+	err = cursor.JumpNode(node)
+	if err != nil {
+		return
+	}
+
+	it = &nodePostingIterator{cursor, cursor.postingsState()}
+	return
+}
+
+// Implementation of PostingIterator.Next.
+func (it *nodePostingIterator) Next() (posting int, err error) {
+	return it.SkipTo(-1)
+}
+
+// Implementation of PostingIterator.SkipTo.
+func (it *nodePostingIterator) SkipTo(target int) (posting int, err error) {
+
+	if it.state.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	err = it.cursor.setPostingsState(it.state)
+	if err != nil {
+		return
+	}
+
+	posting, err = it.cursor.SkipTo(target)
+	if err != nil {
+		return
+	}
+
+	it.state = it.cursor.postingsState()
+	return
+}
+
+// It returns an iterator on the postings of the given node.
+//
+// The iterator decodes the postings with its own clone of this cursor, that
+// can be used freely.
+//
+// It returns:
+// - the iterator on the postings.
+// - an error in case of failure.
+func (c *Cursor) PostingIterator(node Node) (iterator PostingIterator,
+	err error) {
+
+	clone := *c
+	var it *nodePostingIterator
+	it, err = newNodePostingIterator(&clone, node)
+	if err != nil {
+		err = fmt.Errorf("Cursor.PostingIterator: %w", err)
+		return
+	}
+
+	iterator = it
+	return
+}
+
+// It returns an iterator on the postings of the given node and of all its
+// sub-nodes recursively, as the one of ReadAllPostingsRecursive.
+//
+// The sub-nodes are visited immediately but their postings are decoded lazily
+// and merged together as needed by the caller. The iterator uses its own
+// clone of this cursor, that can be used freely.
+//
+// It returns:
+// - the iterator on the postings.
+// - an error in case of failure.
+func (c *Cursor) PrefixPostingIterator(node Node) (iterator PostingIterator,
+	err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Cursor.PrefixPostingIterator: %w", err)
+		}
+	}()
+
+	clone := *c
+	err = clone.JumpNode(node)
+	if err != nil {
+		return
+	}
+
+	// Breadth-first traversal collecting the nodes with postings, the queue
+	// contains the edges of the nodes still to be visited:
+	var iterators []PostingIterator
+	var queue []Edge
+	for {
+		// The precomputed postings of the whole sub-trie, if any, replace
+		// the ones of all its nodes:
+		var subtree *subtreePostingIterator
+		subtree, err = clone.subtreePostings()
+		if err != nil {
+			return
+		} else if subtree != nil {
+			iterators = append(iterators, subtree)
+			clone.edgesLeft = 0
+		} else if node.NumPostings > 0 {
+			iterators = append(iterators, &nodePostingIterator{&clone,
+				clone.postingsState()})
+		}
+
+		for clone.edgesLeft > 0 {
+			var edge Edge
+			edge, err = clone.ReadEdge()
+			if err != nil {
+				return
+			}
+			queue = append(queue, edge)
+		}
+
+		if len(queue) == 0 {
+			break
+		}
+		node, err = clone.EnterNode(queue[0])
+		if err != nil {
+			return
+		}
+		queue = queue[1:]
+	}
+
+	iterator = UnitePostingIterators(iterators...)
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// Iterator on the postings of a sub-trie precomputed by the builder (see
+// FeatureSubtreePostings), it decodes from its own copy of the source.
+type subtreePostingIterator struct {
+	source       trieSource
+	postingsLeft int
+	posting      int
+	frequencies  bool // If each posting is followed by its frequency.
+}
+
+// It decodes the next posting.
+//
+// It returns:
+// - the posting and the summed frequencies of the terms of the sub-trie in
+//   its document, always 1 without FeatureFrequencies.
+// - io.EOF if there are no more postings, or another error in case of
+//   failure.
+func (it *subtreePostingIterator) next() (posting int, frequency int,
+	err error) {
+
+	if it.postingsLeft == 0 {
+		err = io.EOF
+		return
+	}
+
+	var increment, frequency_ uint64 = 0, 1
+	increment, err = binary.ReadUvarint(&it.source)
+	if err == nil && it.frequencies {
+		frequency_, err = binary.ReadUvarint(&it.source)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		it.postingsLeft = 0
+		return
+	}
+
+	it.posting += int(increment)
+	it.postingsLeft--
+	posting, frequency = it.posting, int(frequency_)
+	return
+}
+
+// It decodes all the remaining postings, with their frequencies.
+func (it *subtreePostingIterator) readAll() (postings []int,
+	frequencies []int, err error) {
+
+	postings_ := make([]int, it.postingsLeft)
+	frequencies_ := make([]int, it.postingsLeft)
+	for i := range postings_ {
+		postings_[i], frequencies_[i], err = it.next()
+		if err != nil {
+			return
+		}
+	}
+
+	postings, frequencies = postings_, frequencies_
+	return
+}
+
+// Implementation of PostingIterator.Next.
+func (it *subtreePostingIterator) Next() (posting int, err error) {
+	posting, _, err = it.next()
+	return
+}
+
+// Implementation of PostingIterator.SkipTo.
+func (it *subtreePostingIterator) SkipTo(target int) (posting int,
+	err error) {
+
+	for {
+		posting, _, err = it.next()
+		if err != nil || posting >= target {
+			return
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// Iterator on the postings found by all the given iterators.
+type intersectPostingIterator struct {
+	iterators []PostingIterator
+	next      int // Index of the iterator to be used first.
+}
+
+// It creates an iterator on the postings found by all the given iterators,
+// that skips ahead each of them as needed.
+//
+// Without iterators it returns no postings.
+func IntersectPostingIterators(iterators ...PostingIterator) PostingIterator {
+	if len(iterators) == 1 {
+		return iterators[0]
+	}
+	return &intersectPostingIterator{iterators: iterators}
+}
+
+// Implementation of PostingIterator.Next.
+func (it *intersectPostingIterator) Next() (posting int, err error) {
+
+	if len(it.iterators) == 0 {
+		err = io.EOF
+		return
+	}
+
+	var candidate int
+	candidate, err = it.iterators[it.next].Next()
+	if err != nil {
+		return
+	}
+	return it.align(candidate)
+}
+
+// Implementation of PostingIterator.SkipTo.
+func (it *intersectPostingIterator) SkipTo(target int) (posting int,
+	err error) {
+
+	if len(it.iterators) == 0 {
+		err = io.EOF
+		return
+	}
+
+	var candidate int
+	candidate, err = it.iterators[it.next].SkipTo(target)
+	if err != nil {
+		return
+	}
+	return it.align(candidate)
+}
+
+// It skips all the iterators to the given candidate, just returned by the
+// next iterator, until all of them agree on the same posting.
+func (it *intersectPostingIterator) align(candidate int) (posting int,
+	err error) {
+
+	n := len(it.iterators)
+	for matched := 1; matched < n; {
+		it.next = (it.next + 1) % n
+		var other int
+		other, err = it.iterators[it.next].SkipTo(candidate)
+		if err != nil {
+			return
+		} else if other == candidate {
+			matched++
+		} else {
+			candidate, matched = other, 1
+		}
+	}
+
+	it.next = (it.next + 1) % n
+	posting = candidate
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// One of the iterators of a unitePostingIterator, with its first posting not
+// returned yet.
+type unitedPostingIterator struct {
+	iterator PostingIterator
+	posting  int
+}
+
+// A min-heap of iterators sorted by their next posting.
+type unitedPostingIterators []unitedPostingIterator
+
+func (h unitedPostingIterators) Len() int { return len(h) }
+func (h unitedPostingIterators) Less(i, j int) bool {
+	return h[i].posting < h[j].posting
+}
+func (h unitedPostingIterators) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *unitedPostingIterators) Push(x interface{}) {
+	*h = append(*h, x.(unitedPostingIterator))
+}
+func (h *unitedPostingIterators) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Iterator on the postings found by any of the given iterators.
+type unitePostingIterator struct {
+	iterators []PostingIterator // Iterators not started yet.
+	heap      unitedPostingIterators
+}
+
+// It creates an iterator on the postings found by any of the given iterators,
+// merging them lazily.
+func UnitePostingIterators(iterators ...PostingIterator) PostingIterator {
+	if len(iterators) == 1 {
+		return iterators[0]
+	}
+	return &unitePostingIterator{iterators: iterators}
+}
+
+// It starts all the iterators, reading their first posting skipping the ones
+// lower than target.
+func (it *unitePostingIterator) start(target int) (err error) {
+
+	for _, iterator := range it.iterators {
+		var posting int
+		posting, err = iterator.SkipTo(target)
+		if err == io.EOF {
+			err = nil
+			continue
+		} else if err != nil {
+			return
+		}
+		it.heap = append(it.heap, unitedPostingIterator{iterator, posting})
+	}
+
+	it.iterators = nil
+	heap.Init(&it.heap)
+	return
+}
+
+// It advances the iterator at the top of the heap to its first posting not
+// lower than target.
+func (it *unitePostingIterator) advanceTop(target int) (err error) {
+
+	top := &it.heap[0]
+	top.posting, err = top.iterator.SkipTo(target)
+	if err == io.EOF {
+		err = nil
+		heap.Pop(&it.heap)
+	} else if err == nil {
+		heap.Fix(&it.heap, 0)
+	}
+	return
+}
+
+// Implementation of PostingIterator.Next.
+func (it *unitePostingIterator) Next() (posting int, err error) {
+	return it.SkipTo(-1)
+}
+
+// Implementation of PostingIterator.SkipTo.
+func (it *unitePostingIterator) SkipTo(target int) (posting int, err error) {
+
+	if it.iterators != nil {
+		err = it.start(target)
+		if err != nil {
+			return
+		}
+	}
+
+	for err == nil && len(it.heap) > 0 && it.heap[0].posting < target {
+		err = it.advanceTop(target)
+	}
+	if err != nil {
+		return
+	} else if len(it.heap) == 0 {
+		err = io.EOF
+		return
+	}
+
+	// Returns the lowest posting, skipping it on all the iterators:
+	posting = it.heap[0].posting
+	for err == nil && len(it.heap) > 0 && it.heap[0].posting == posting {
+		err = it.advanceTop(posting + 1)
+	}
+	return
+}
@@ -0,0 +1,178 @@
+package smartsearch
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPostingIterator_Slice(t *testing.T) {
+
+	iterator := NewSlicePostingIterator([]int{1, 3, 5, 7, 9})
+
+	var results []int
+	posting, err := iterator.Next()
+	results = append(results, posting)
+	posting, err = iterator.SkipTo(4)
+	results = append(results, posting)
+	posting, err = iterator.SkipTo(5)
+	results = append(results, posting)
+	posting, err = iterator.Next()
+	results = append(results, posting)
+	if err != nil || !reflect.DeepEqual(results, []int{1, 5, 7, 9}) {
+		t.Errorf("Unexpected postings: %v, err=%v", results, err)
+	}
+
+	_, err = iterator.Next()
+	if err != io.EOF {
+		t.Errorf("io.EOF was expected: %v", err)
+	}
+}
+
+func TestPostingIterator_IntersectUnite(t *testing.T) {
+
+	sequences := [][]int{
+		{1, 2, 3, 5, 8, 13, 21, 34},
+		{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31},
+		{1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 21, 23},
+		{}}
+	iterators := func(sequences ...[]int) (iterators []PostingIterator) {
+		for _, sequence := range sequences {
+			iterators = append(iterators, NewSlicePostingIterator(sequence))
+		}
+		return
+	}
+
+	intersection := IntersectPostings(IntersectPostings(sequences[0],
+		sequences[1]), sequences[2])
+	postings, err := ReadPostingIterator(
+		IntersectPostingIterators(iterators(sequences[:3]...)...), -1)
+	if err != nil || !reflect.DeepEqual(postings, intersection) {
+		t.Errorf("Unexpected intersection: %v, err=%v", postings, err)
+	}
+
+	union := UnitePostings(UnitePostings(sequences[0], sequences[1]),
+		sequences[2])
+	postings, err = ReadPostingIterator(
+		UnitePostingIterators(iterators(sequences...)...), -1)
+	if err != nil || !reflect.DeepEqual(postings, union) {
+		t.Errorf("Unexpected union: %v, err=%v", postings, err)
+	}
+
+	// With a limit:
+	postings, err = ReadPostingIterator(
+		UnitePostingIterators(iterators(sequences...)...), 4)
+	if err != nil || !reflect.DeepEqual(postings, union[:4]) {
+		t.Errorf("Unexpected union: %v, err=%v", postings, err)
+	}
+
+	// Skipping ahead:
+	iterator := IntersectPostingIterators(
+		UnitePostingIterators(iterators(sequences[0], sequences[1])...),
+		NewSlicePostingIterator(sequences[2]))
+	posting, err := iterator.SkipTo(12)
+	if err != nil || posting != 13 {
+		t.Errorf("Unexpected posting: %v, err=%v", posting, err)
+	}
+	postings, err = ReadPostingIterator(iterator, -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{17, 19, 21, 23}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+
+	// Empty intersections:
+	postings, err = ReadPostingIterator(
+		IntersectPostingIterators(iterators(sequences...)...), -1)
+	if err != nil || postings != nil {
+		t.Errorf("Unexpected intersection: %v, err=%v", postings, err)
+	}
+	postings, err = ReadPostingIterator(IntersectPostingIterators(), -1)
+	if err != nil || postings != nil {
+		t.Errorf("Unexpected intersection: %v, err=%v", postings, err)
+	}
+}
+
+func TestPostingIterator_Cursor(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "alpha beta gamma")
+	builder.AddDocument(2, "alpha alpine alps")
+	builder.AddDocument(3, "beta betamax")
+	builder.AddDocument(5, "gamma alpha alpha")
+	builder.AddDocument(8, "alphabet")
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	cursor, _ := trie.Root()
+
+	for _, term := range []string{"", "a", "alp", "alpha", "beta", "g", "x"} {
+		cursor.Reset()
+		node, _ := cursor.Match(term)
+		if term == "" {
+			node, _ = cursor.Reset()
+		}
+		if node == (Node{}) {
+			continue
+		}
+
+		expected, _ := cursor.ReadAllPostings()
+		iterator, err := cursor.PostingIterator(node)
+		if err != nil {
+			t.Errorf("PostingIterator failed with term '%v': %v", term, err)
+			continue
+		}
+		postings, err := ReadPostingIterator(iterator, -1)
+		if err != nil || !reflect.DeepEqual(postings, expected) {
+			t.Errorf("Unexpected postings with term '%v': %v, err=%v", term,
+				postings, err)
+		}
+
+		cursor.JumpNode(node)
+		expected, _ = cursor.ReadAllPostingsRecursive()
+		iterator, err = cursor.PrefixPostingIterator(node)
+		if err != nil {
+			t.Errorf("PrefixPostingIterator failed with term '%v': %v", term,
+				err)
+			continue
+		}
+		postings, err = ReadPostingIterator(iterator, -1)
+		if err != nil || !reflect.DeepEqual(postings, expected) {
+			t.Errorf("Unexpected postings with prefix '%v': %v, err=%v",
+				term, postings, err)
+		}
+	}
+
+	// Nodes of other tries are refused:
+	_, err = cursor.PrefixPostingIterator(Node{NumPostings: 1})
+	if err == nil {
+		t.Error("An error was expected with a foreign node")
+	}
+}
+
+func TestIndex_SearchWithLimit(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	for _, query := range []string{"", "a", "alpha b", "title:g", "zeta ",
+		"\"delta epsilon\" e"} {
+		all, err := index.Search(query, -1)
+		if err != nil || len(all) < 10 {
+			t.Errorf("Unexpected result with query [%v]: %v, err=%v", query,
+				all, err)
+			continue
+		}
+		postings, err := index.Search(query, 10)
+		if err != nil || !reflect.DeepEqual(postings, all[:10]) {
+			t.Errorf("Unexpected result with query [%v]: %v, err=%v", query,
+				postings, err)
+		}
+	}
+}
@@ -37,9 +37,42 @@ func SortDedupPostings(src []int) (postings []int) {
 	return
 }
 
+// Minimum ratio between the lengths of 2 sequences of postings to intersect
+// them with galloping search (see IntersectPostings).
+const gallopingRatio = 8
+
+// It searches target in the given sorted sequence of postings starting from
+// the given index: it probes the postings at exponentially growing distances
+// and then it searches between the last 2 probes, so that it is fast when
+// target is close.
+//
+// It returns:
+// - the index of the first posting not lower than target, or the length of
+//   the sequence if there are none.
+func GallopPostings(src []int, from int, target int) (i int) {
+
+	bound := 1
+	for from+bound < len(src) && src[from+bound] < target {
+		bound *= 2
+	}
+
+	low, high := from+bound/2, from+bound+1
+	if low > len(src) {
+		low = len(src)
+	}
+	if high > len(src) {
+		high = len(src)
+	}
+	i = low + sort.SearchInts(src[low:high], target)
+	return
+}
+
 // It takes 2 sorted and deduplicated sequences of postings and generates a new
 // sorted and deduplicated sequence that contains the intersection of
 // the postings.
+//
+// When one sequence is much shorter than the other one it uses galloping
+// search, skipping most of the postings of the longer one.
 func IntersectPostings(srcA []int, srcB []int) (postings []int) {
 
 	nA := len(srcA)
@@ -48,6 +81,25 @@ func IntersectPostings(srcA []int, srcB []int) (postings []int) {
 		return // No results!
 	}
 
+	// When one sequence is much shorter than the other one, each of its
+	// postings is searched in the longer one with galloping search:
+	if nA > nB {
+		srcA, srcB, nA, nB = srcB, srcA, nB, nA
+	}
+	if nA*gallopingRatio < nB {
+		var iB int
+		for _, a := range srcA {
+			iB = GallopPostings(srcB, iB, a)
+			if iB == nB {
+				break
+			} else if srcB[iB] == a {
+				postings = append(postings, a)
+				iB++
+			}
+		}
+		return
+	}
+
 	var iA, iB int
 	for iA < nA && iB < nB {
 		a := srcA[iA]
@@ -110,3 +162,120 @@ func UnitePostings(srcA []int, srcB []int) (postings []int) {
 
 	return
 }
+
+// It takes 2 sorted and deduplicated sequences of postings and generates a new
+// sorted and deduplicated sequence that contains the postings of the first
+// sequence that are not in the second one.
+func DifferencePostings(srcA []int, srcB []int) (postings []int) {
+
+	nA := len(srcA)
+	nB := len(srcB)
+
+	// Handles corner cases:
+	if nA == 0 {
+		return // No results!
+	} else if nB == 0 {
+		postings = srcA
+		return
+	}
+
+	var iA, iB int
+	for iA < nA && iB < nB {
+		a := srcA[iA]
+		b := srcB[iB]
+		if a < b {
+			postings = append(postings, a)
+			iA++
+		} else if a > b {
+			iB++
+		} else {
+			iA++
+			iB++
+		}
+	}
+
+	// Attaches the eventual tail:
+	if iA < nA {
+		postings = append(postings, srcA[iA:]...)
+	}
+
+	return
+}
+
+// It takes a sequence of postings, where each posting is repeated once for
+// each occurrence of a term in the related document, and counts them.
+//
+// It returns:
+// - postings, sorted and deduplicated.
+// - for each posting, the number of times it was found.
+func CountPostings(src []int) (postings []int, frequencies []int) {
+
+	if len(src) == 0 {
+		return
+	}
+
+	sorted := CopyPostings(src)
+	sort.Ints(sorted)
+
+	for i, posting := range sorted {
+		if i > 0 && posting == sorted[i-1] {
+			frequencies[len(frequencies)-1]++
+		} else {
+			postings = append(postings, posting)
+			frequencies = append(frequencies, 1)
+		}
+	}
+
+	return
+}
+
+// Like UnitePostings but each of the 2 sequences of postings comes together
+// with the frequency of each posting, frequencies of postings found on both
+// sequences are summed.
+func UnitePostingsWithFrequencies(srcA []int, freqA []int, srcB []int,
+	freqB []int) (postings []int, frequencies []int) {
+
+	nA := len(srcA)
+	nB := len(srcB)
+
+	// Handles corner cases:
+	if nA == 0 {
+		postings, frequencies = srcB, freqB
+		return
+	} else if nB == 0 {
+		postings, frequencies = srcA, freqA
+		return
+	}
+
+	// Fuses the 2 sequences:
+	var iA, iB int
+	for iA < nA && iB < nB {
+		a := srcA[iA]
+		b := srcB[iB]
+		if a < b {
+			postings = append(postings, a)
+			frequencies = append(frequencies, freqA[iA])
+			iA++
+		} else if a > b {
+			postings = append(postings, b)
+			frequencies = append(frequencies, freqB[iB])
+			iB++
+		} else {
+			postings = append(postings, a)
+			frequencies = append(frequencies, freqA[iA]+freqB[iB])
+			iA++
+			iB++
+		}
+	}
+
+	// Attaches the eventual tail:
+	if iA < nA {
+		postings = append(postings, srcA[iA:]...)
+		frequencies = append(frequencies, freqA[iA:]...)
+	} else if iB < nB {
+		postings = append(postings, srcB[iB:]...)
+		frequencies = append(frequencies, freqB[iB:]...)
+	}
+
+	return
+}
@@ -64,6 +64,41 @@ func TestPostings_IntersectPostings(t *testing.T) {
 	if !reflect.DeepEqual(result, expected_result) {
 		t.Errorf("Unexpected result: %v", result)
 	}
+
+	// Galloping search with sequences of very different lengths:
+	sourceA = []int{0, 33, 501, 998, 1001}
+	sourceB = nil
+	for i := 0; i < 1000; i += 3 {
+		sourceB = append(sourceB, i)
+	}
+	expected_result = []int{0, 33, 501}
+
+	result = IntersectPostings(sourceA, sourceB)
+	if !reflect.DeepEqual(result, expected_result) {
+		t.Errorf("Unexpected result: %v", result)
+	}
+	result = IntersectPostings(sourceB, sourceA)
+	if !reflect.DeepEqual(result, expected_result) {
+		t.Errorf("Unexpected result: %v", result)
+	}
+}
+
+func TestPostings_GallopPostings(t *testing.T) {
+
+	source := []int{1, 3, 5, 7, 9, 11, 13, 15, 17}
+	targets := []int{0, 1, 2, 9, 10, 17, 18}
+	from := []int{0, 0, 0, 2, 3, 0, 8}
+	expected := []int{0, 0, 1, 4, 5, 8, 9}
+	for i, target := range targets {
+		result := GallopPostings(source, from[i], target)
+		if result != expected[i] {
+			t.Errorf("Unexpected result with target %v from %v: %v", target,
+				from[i], result)
+		}
+	}
+	if result := GallopPostings(source, len(source), 1); result != 9 {
+		t.Errorf("Unexpected result: %v", result)
+	}
 }
 
 func TestPostings_UnitePostings(t *testing.T) {
@@ -115,3 +150,76 @@ func TestPostings_UnitePostings(t *testing.T) {
 		t.Errorf("Unexpected result: %v", result)
 	}
 }
+
+func TestPostings_DifferencePostings(t *testing.T) {
+
+	var sourceA, sourceB, expected_result, result []int
+
+	sourceA = []int{2, 3, 5, 10, 12}
+	sourceB = []int{1, 2, 5, 11}
+	expected_result = []int{3, 10, 12}
+
+	result = DifferencePostings(sourceA, sourceB)
+	if !reflect.DeepEqual(result, expected_result) {
+		t.Errorf("Unexpected result: %v", result)
+	}
+
+	sourceA = []int{}
+	sourceB = []int{1, 2, 5, 11}
+	expected_result = nil
+
+	result = DifferencePostings(sourceA, sourceB)
+	if !reflect.DeepEqual(result, expected_result) {
+		t.Errorf("Unexpected result: %v", result)
+	}
+
+	sourceA = []int{2, 6, 7}
+	sourceB = []int{}
+	expected_result = []int{2, 6, 7}
+
+	result = DifferencePostings(sourceA, sourceB)
+	if !reflect.DeepEqual(result, expected_result) {
+		t.Errorf("Unexpected result: %v", result)
+	}
+
+	sourceA = []int{2, 4, 6}
+	sourceB = []int{2, 4, 6, 8}
+	expected_result = nil
+
+	result = DifferencePostings(sourceA, sourceB)
+	if !reflect.DeepEqual(result, expected_result) {
+		t.Errorf("Unexpected result: %v", result)
+	}
+}
+
+func TestCountPostings(t *testing.T) {
+
+	postings, frequencies := CountPostings([]int{7, 3, 7, 1, 7, 3})
+	if !reflect.DeepEqual(postings, []int{1, 3, 7}) ||
+		!reflect.DeepEqual(frequencies, []int{1, 2, 3}) {
+		t.Errorf("Unexpected result: %v %v", postings, frequencies)
+	}
+
+	postings, frequencies = CountPostings(nil)
+	if postings != nil || frequencies != nil {
+		t.Errorf("Unexpected result: %v %v", postings, frequencies)
+	}
+}
+
+func TestUnitePostingsWithFrequencies(t *testing.T) {
+
+	postings, frequencies := UnitePostingsWithFrequencies(
+		[]int{1, 3, 5}, []int{1, 2, 3},
+		[]int{2, 3, 6, 7}, []int{4, 5, 6, 7})
+	if !reflect.DeepEqual(postings, []int{1, 2, 3, 5, 6, 7}) ||
+		!reflect.DeepEqual(frequencies, []int{1, 4, 7, 3, 6, 7}) {
+		t.Errorf("Unexpected result: %v %v", postings, frequencies)
+	}
+
+	postings, frequencies = UnitePostingsWithFrequencies(
+		nil, nil, []int{2}, []int{3})
+	if !reflect.DeepEqual(postings, []int{2}) ||
+		!reflect.DeepEqual(frequencies, []int{3}) {
+		t.Errorf("Unexpected result: %v %v", postings, frequencies)
+	}
+}
@@ -0,0 +1,489 @@
+package smartsearch
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// The kind of one node of a parsed query.
+type QueryOperator int
+
+const (
+	// Documents containing the term.
+	QueryTerm QueryOperator = iota
+
+	// Documents containing any term having the term as a prefix.
+	QueryPrefix
+
+	// Documents matching all the children.
+	QueryAnd
+
+	// Documents matching at least one of the children.
+	QueryOr
+
+	// Documents not matching the only child.
+	QueryNot
+)
+
+// It represents one node of a query parsed by ParseQuery.
+type Query struct {
+	Operator QueryOperator
+	Field    string   // Optional field key (QueryTerm, QueryPrefix).
+	Term     string   // Normalized term (QueryTerm, QueryPrefix).
+	Children []*Query // Operands (QueryAnd, QueryOr, QueryNot).
+}
+
+// It returns a compact representation of the query, mostly for debugging:
+// terms as they are, prefixes followed by '*' and operators as in
+// "(OR a (AND b (NOT c)))".
+func (q *Query) String() string {
+
+	field := ""
+	if q.Field != "" {
+		field = q.Field + ":"
+	}
+
+	switch q.Operator {
+	case QueryTerm:
+		return field + q.Term
+	case QueryPrefix:
+		return field + q.Term + "*"
+	}
+
+	names := map[QueryOperator]string{
+		QueryAnd: "AND",
+		QueryOr:  "OR",
+		QueryNot: "NOT"}
+	parts := []string{names[q.Operator]}
+	for _, child := range q.Children {
+		parts = append(parts, child.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// This error is returned by ParseQuery when the query is not well formed.
+type QuerySyntaxError struct {
+	Offset int    // Byte offset of the query where the problem has been found.
+	Reason string // Human readable description of the problem.
+}
+
+// Implementation of error.
+func (e QuerySyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %v: %v", e.Offset, e.Reason)
+}
+
+// It parses a query written with the boolean query language.
+//
+// The language is made of:
+// - terms: documents containing all of them match ("siddarth menon").
+// - prefixes: terms ending with '*' match all the terms starting with them
+//   ("sidd*").
+// - OR: documents matching any of the operands match ("siddarth OR nithya").
+// - NOT or '-': documents not matching the operand match ("-menon",
+//   "NOT menon").
+// - AND: optional, it is the same as putting operands one after the other.
+// - parentheses to group sub-queries ("(siddarth OR nithya) -menon").
+// - fields: terms preceded by the name of a field and ':' match only within
+//   that field ("title:vertigo"). The field is kept as a key (see fieldKey).
+//
+// NOT binds stronger than AND that binds stronger than OR. Keywords are
+// recognized only in upper case, terms are normalized with the given
+// tokenizer: a word that becomes many terms requires all of them.
+//
+// It returns:
+// - the parsed query, nil if the query has no terms (it matches everything).
+// - a QuerySyntaxError if the query is not well formed.
+func ParseQuery(query string, tokenizer Tokenizer) (parsed *Query,
+	err error) {
+
+	p := queryParser{tokenizer: tokenizer, end: len(query)}
+	p.tokens = lexQuery(query)
+
+	parsed, err = p.parseOr()
+	if err == nil && p.position < len(p.tokens) {
+		err = p.errorf("unexpected '%v'", p.tokens[p.position].text)
+	}
+	if err != nil {
+		parsed = nil
+	}
+	return
+}
+
+// One token of a query as returned by lexQuery.
+type queryToken struct {
+	text   string
+	offset int
+}
+
+// It splits a query in tokens: parentheses, '-' at the beginning of a word and
+// words separated by spaces or parentheses.
+func lexQuery(query string) (tokens []queryToken) {
+
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, queryToken{query[start:end], start})
+			start = -1
+		}
+	}
+
+	for i, r := range query {
+		if unicode.IsSpace(r) {
+			flush(i)
+		} else if r == '(' || r == ')' {
+			flush(i)
+			tokens = append(tokens, queryToken{string(r), i})
+		} else if r == '-' && start < 0 {
+			tokens = append(tokens, queryToken{"-", i})
+		} else if start < 0 {
+			start = i
+		}
+	}
+	flush(len(query))
+
+	return
+}
+
+// Used to implement ParseQuery, it is a recursive descent parser.
+type queryParser struct {
+	tokenizer Tokenizer
+	tokens    []queryToken
+	position  int
+	end       int // Offset used for errors at the end of the query.
+}
+
+// It creates a QuerySyntaxError at the current token.
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	offset := p.end
+	if p.position < len(p.tokens) {
+		offset = p.tokens[p.position].offset
+	}
+	return QuerySyntaxError{offset, fmt.Sprintf(format, args...)}
+}
+
+// It returns the text of the current token, an empty string at the end.
+func (p *queryParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position].text
+	}
+	return ""
+}
+
+// It parses a sequence of operands separated by OR.
+func (p *queryParser) parseOr() (query *Query, err error) {
+
+	var children []*Query
+	for {
+		start := p.position
+		var child *Query
+		child, err = p.parseAnd()
+		if err != nil {
+			return
+		} else if child != nil {
+			children = append(children, child)
+		}
+
+		if p.peek() != "OR" {
+			break
+		} else if p.position == start {
+			err = p.errorf("missing operand before OR")
+			return
+		}
+		p.position++
+		if next := p.peek(); next == "" || next == ")" || next == "OR" {
+			err = p.errorf("missing operand after OR")
+			return
+		}
+	}
+
+	query = newQueryNode(QueryOr, children)
+	return
+}
+
+// It parses a sequence of operands, optionally separated by AND.
+func (p *queryParser) parseAnd() (query *Query, err error) {
+
+	var children []*Query
+	for {
+		next := p.peek()
+		if next == "" || next == ")" || next == "OR" {
+			break
+		} else if next == "AND" {
+			p.position++
+			if next = p.peek(); next == "" || next == ")" || next == "OR" ||
+				next == "AND" {
+				err = p.errorf("missing operand after AND")
+				return
+			}
+			continue
+		}
+
+		var child *Query
+		child, err = p.parseNot()
+		if err != nil {
+			return
+		} else if child != nil {
+			children = append(children, child)
+		}
+	}
+
+	query = newQueryNode(QueryAnd, children)
+	return
+}
+
+// It parses one operand, optionally negated.
+func (p *queryParser) parseNot() (query *Query, err error) {
+
+	if next := p.peek(); next == "NOT" || next == "-" {
+		p.position++
+		if next = p.peek(); next == "" || next == ")" || next == "OR" {
+			err = p.errorf("missing operand after NOT")
+			return
+		}
+
+		var child *Query
+		child, err = p.parseNot()
+		if err == nil && child != nil {
+			query = &Query{Operator: QueryNot, Children: []*Query{child}}
+		}
+		return
+	}
+
+	return p.parsePrimary()
+}
+
+// It parses a group within parentheses or a single word.
+func (p *queryParser) parsePrimary() (query *Query, err error) {
+
+	token := p.tokens[p.position]
+	if token.text == "(" {
+		p.position++
+		query, err = p.parseOr()
+		if err != nil {
+			return
+		} else if p.peek() != ")" {
+			err = p.errorf("missing ')' for '(' at offset %v", token.offset)
+			return
+		}
+		p.position++
+		return
+	}
+
+	// A word, possibly a prefix and possibly scoped to a field, that may
+	// become many terms:
+	word := token.text
+	field := ""
+	if colon := strings.IndexByte(word, ':'); colon > 0 {
+		field = fieldKey(word[:colon], p.tokenizer)
+		if field == "" {
+			err = p.errorf("invalid field '%v'", word[:colon])
+			return
+		}
+		word = word[colon+1:]
+		if word == "" {
+			err = p.errorf("missing term after field '%v'", field)
+			return
+		}
+	}
+	p.position++
+	isPrefix := strings.HasSuffix(word, "*")
+	terms := p.tokenizer.Apply(strings.TrimRight(word, "*"))
+
+	var children []*Query
+	for i, term := range terms {
+		child := &Query{Operator: QueryTerm, Field: field, Term: term}
+		if isPrefix && i == len(terms)-1 {
+			child.Operator = QueryPrefix
+		}
+		children = append(children, child)
+	}
+
+	query = newQueryNode(QueryAnd, children)
+	return
+}
+
+// It creates a node with the given children, simplified when there are less
+// than 2 of them.
+func newQueryNode(operator QueryOperator, children []*Query) *Query {
+	if len(children) == 0 {
+		return nil
+	} else if len(children) == 1 {
+		return children[0]
+	}
+	return &Query{Operator: operator, Children: children}
+}
+
+// Private implementation of Index.SearchQuery.
+func (idx *indexImpl) SearchQuery(query string, limit int) (
+	postings []int, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Index.SearchQuery '%v': %w", query, err)
+		}
+	}()
+
+	if limit == 0 {
+		return // Nothing to do.
+	}
+
+	var parsed *Query
+	parsed, err = ParseQuery(query, idx.tokenizer)
+	if err != nil {
+		return
+	}
+
+	e := queryEvaluator{cursor: idx.cursor()}
+	defer idx.release(e.cursor)
+	e.fields, err = idx.fieldIds()
+	if err != nil {
+		return
+	}
+
+	var postings_ []int
+	postings_, err = e.evaluate(parsed)
+	if err != nil {
+		return
+	}
+
+	// In case we have a limit set it truncates the result:
+	if limit >= 0 && limit < len(postings_) {
+		postings = postings_[:limit]
+	} else {
+		postings = postings_
+	}
+
+	return
+}
+
+// Used to implement Index.SearchQuery.
+type queryEvaluator struct {
+	cursor      *Cursor
+	fields      map[string]int // Field ids by field key.
+	allPostings []int          // Postings of all the documents, fetched lazily.
+	allFetched  bool
+}
+
+// It returns the postings of all the indexed documents.
+func (e *queryEvaluator) all() (postings []int, err error) {
+
+	if !e.allFetched {
+		_, err = e.cursor.Reset()
+		if err == nil {
+			e.allPostings, err = e.cursor.ReadAllPostingsRecursive()
+		}
+		if err == io.EOF {
+			err = nil
+		} else if err != nil {
+			return
+		}
+		e.allFetched = true
+	}
+
+	postings = e.allPostings
+	return
+}
+
+// It returns the postings of the documents matching the given query, a nil
+// query matches all the documents.
+func (e *queryEvaluator) evaluate(query *Query) (postings []int, err error) {
+
+	if query == nil {
+		return e.all()
+	}
+
+	switch query.Operator {
+
+	case QueryTerm, QueryPrefix:
+		term := query.Term
+		if query.Field != "" {
+			id, ok := e.fields[query.Field]
+			if !ok {
+				err = UnknownFieldError{query.Field}
+				return
+			}
+			term = fieldPrefix(id) + term
+		}
+
+		var node Node
+		node, err = e.cursor.matchTerm(term)
+		if err != nil || (node.NumPostings == 0 && node.NumEdges == 0) {
+			return // Not found.
+		}
+		if query.Operator == QueryPrefix {
+			postings, err = e.cursor.ReadAllPostingsRecursive()
+		} else if node.NumPostings > 0 {
+			postings, err = e.cursor.ReadAllPostings()
+		}
+		if err == io.EOF {
+			err = nil
+		}
+
+	case QueryAnd:
+		// Negated operands are subtracted from the others, if there are:
+		var negated []*Query
+		first := true
+		for _, child := range query.Children {
+			if child.Operator == QueryNot {
+				negated = append(negated, child.Children[0])
+				continue
+			}
+
+			var childPostings []int
+			childPostings, err = e.evaluate(child)
+			if err != nil {
+				return
+			}
+			if first {
+				postings = childPostings
+				first = false
+			} else {
+				postings = IntersectPostings(postings, childPostings)
+			}
+			if len(postings) == 0 {
+				return // No result!
+			}
+		}
+		if first {
+			postings, err = e.all()
+			if err != nil {
+				return
+			}
+		}
+		for _, child := range negated {
+			var childPostings []int
+			childPostings, err = e.evaluate(child)
+			if err != nil {
+				return
+			}
+			postings = DifferencePostings(postings, childPostings)
+		}
+
+	case QueryOr:
+		for _, child := range query.Children {
+			var childPostings []int
+			childPostings, err = e.evaluate(child)
+			if err != nil {
+				return
+			}
+			postings = UnitePostings(postings, childPostings)
+		}
+
+	case QueryNot:
+		var allPostings, childPostings []int
+		allPostings, err = e.all()
+		if err == nil {
+			childPostings, err = e.evaluate(query.Children[0])
+		}
+		if err == nil {
+			postings = DifferencePostings(allPostings, childPostings)
+		}
+
+	default:
+		err = fmt.Errorf("invalid query operator %v", query.Operator)
+	}
+
+	return
+}
@@ -0,0 +1,117 @@
+package smartsearch
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery_Base(t *testing.T) {
+
+	tokenizer := NewTokenizer()
+	queries := []string{
+		"siddarth menon",
+		"siddarth OR Nithya",
+		"(siddarth OR nithya) -menon",
+		"NOT menon",
+		"jay* AND menon",
+		"a OR b c OR -d",
+		"Jay-Menon",
+		"- - a",
+		"((a))",
+		"",
+		"!!! ()"}
+	expected := []string{
+		"(AND siddarth menon)",
+		"(OR siddarth nithya)",
+		"(AND (OR siddarth nithya) (NOT menon))",
+		"(NOT menon)",
+		"(AND jay* menon)",
+		"(OR a (AND b c) (NOT d))",
+		"(AND jay menon)",
+		"(NOT (NOT a))",
+		"a",
+		"<nil>",
+		"<nil>"}
+	for i, query := range queries {
+		parsed, err := ParseQuery(query, tokenizer)
+		if err != nil {
+			t.Errorf("Cannot parse [%v]: %v", query, err)
+			continue
+		}
+
+		result := "<nil>"
+		if parsed != nil {
+			result = parsed.String()
+		}
+		if result != expected[i] {
+			t.Errorf("Unexpected result with query [%v]: %v", query, result)
+		}
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+
+	tokenizer := NewTokenizer()
+	queries := []string{"(a OR b", "a)", "a OR", "OR a", "a AND", "-",
+		"NOT )", "(a OR) b"}
+	offsets := []int{7, 1, 4, 0, 5, 1, 4, 5}
+	for i, query := range queries {
+		_, err := ParseQuery(query, tokenizer)
+		var syntaxErr QuerySyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("QuerySyntaxError was expected with query [%v]: %v",
+				query, err)
+		} else if syntaxErr.Offset != offsets[i] {
+			t.Errorf("Unexpected offset with query [%v]: %v", query,
+				syntaxErr.Offset)
+		}
+	}
+}
+
+func TestIndex_SearchQuery(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "Jayendra Menon")
+	builder.AddDocument(2, "Siddarth Jayanth")
+	builder.AddDocument(3, "Nithya Menon")
+	builder.AddDocument(4, "Vertigo")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	queries := []string{"(siddarth OR nithya) -menon", "menon", "menon -nithya",
+		"jay*", "jay", "-menon", "NOT (jay* OR menon)", "vertigo OR xyz",
+		"xyz", "xyz*", ""}
+	all_expected_postings := [][]int{{2}, {1, 3}, {1}, {1, 2}, nil, {2, 4},
+		{4}, {4}, nil, nil, {1, 2, 3, 4}}
+	for i, query := range queries {
+		postings, err := index.SearchQuery(query, -1)
+		if err != nil {
+			t.Errorf("SearchQuery failed with query %v: %v", query, err)
+		} else if !reflect.DeepEqual(postings, all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query [%v]: postings=%v", query,
+				postings)
+		}
+	}
+
+	// Limit:
+	postings, err := index.SearchQuery("menon OR vertigo", 2)
+	if err != nil {
+		t.Errorf("SearchQuery failed: %v", err)
+	} else if !reflect.DeepEqual(postings, []int{1, 3}) {
+		t.Errorf("Unexpected result: postings=%v", postings)
+	}
+
+	// Syntax errors:
+	_, err = index.SearchQuery("(menon", -1)
+	var syntaxErr QuerySyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("QuerySyntaxError was expected: %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package smartsearch
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Parameters of the BM25 ranking function: bm25K1 tunes the saturation of the
+// term frequencies while bm25B tunes the normalization by document length.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// It represents one document found by Index.SearchRanked together with its
+// relevance for the query.
+type ScoredPosting struct {
+	Posting int     `json:"id"`    // The document id.
+	Score   float64 `json:"score"` // Relevance, the higher the better.
+}
+
+// A sequence of scored postings.
+type ScoredPostings []ScoredPosting
+
+// Implementation of sort.Interface, sorting by decreasing score and then by
+// posting.
+func (s ScoredPostings) Len() int {
+	return len(s)
+}
+
+// Implementation of sort.Interface
+func (s ScoredPostings) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].Posting < s[j].Posting
+}
+
+// Implementation of sort.Interface
+func (s ScoredPostings) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// It returns the postings only, in the same order.
+func (s ScoredPostings) Postings() (postings []int) {
+	postings = make([]int, len(s))
+	for i := range s {
+		postings[i] = s[i].Posting
+	}
+	return
+}
+
+// Statistics about the indexed documents needed by the ranking function.
+type rankingStats struct {
+	lengths       DocumentLengths // Length of each document, if known.
+	averageLength float64         // Average length of the documents.
+	numDocuments  int             // Number of indexed documents.
+}
+
+// It loads the ranking statistics from the given trie.
+//
+// Indices generated without FeatureDocumentLengths are still supported: in
+// such case the number of documents is computed by visiting the whole trie and
+// all the documents are considered long as the average one.
+func loadRankingStats(trie *Trie) (stats rankingStats, err error) {
+
+	stats.lengths, err = trie.ReadDocumentLengths()
+	if err != nil {
+		return
+	} else if stats.lengths != nil {
+		stats.averageLength = stats.lengths.Average()
+		stats.numDocuments = len(stats.lengths)
+		return
+	}
+
+	cursor, _ := trie.Root()
+	var postings []int
+	postings, err = cursor.ReadAllPostingsRecursive()
+	if err == io.EOF {
+		err = nil
+	}
+	stats.numDocuments = len(postings)
+	return
+}
+
+// It computes the BM25 score of one term for one document.
+//
+// Parameters:
+// - tf: occurrences of the term in the document, weighted by field boosts.
+// - df: number of documents containing the term.
+// - length: number of terms of the document.
+func (s *rankingStats) score(tf float64, df int, length int) float64 {
+
+	n := float64(s.numDocuments)
+	if n < float64(df) {
+		n = float64(df)
+	}
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+
+	norm := 1.0
+	if s.averageLength > 0 {
+		norm = 1 - bm25B + bm25B*float64(length)/s.averageLength
+	}
+
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+// Postings of one term of a query with the related frequencies, weighted by
+// the field boosts.
+type rankedTerm struct {
+	postings []int
+	weights  []float64
+}
+
+// It fetches the postings and the weighted frequencies of one term.
+//
+// Parameters:
+// - term: the term, possibly prefixed by the one of a field.
+// - isPrefix: if all the terms having term as a prefix have to be matched.
+// - boost: the weight of each occurrence of the term.
+func rankTerm(cursor *Cursor, term string, isPrefix bool, boost float64) (
+	rt rankedTerm, err error) {
+
+	var node Node
+	node, err = cursor.matchTerm(term)
+	if err != nil || (node.NumPostings == 0 && node.NumEdges == 0) {
+		return
+	}
+
+	var frequencies []int
+	if isPrefix {
+		rt.postings, frequencies, err =
+			cursor.ReadAllPostingsRecursiveWithFrequencies()
+	} else if node.NumPostings > 0 {
+		rt.postings, frequencies, err =
+			cursor.ReadAllPostingsWithFrequencies()
+	}
+	if err == io.EOF {
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	rt.weights = make([]float64, len(frequencies))
+	for i, frequency := range frequencies {
+		rt.weights[i] = boost * float64(frequency)
+	}
+	return
+}
+
+// It adds the weights of the given term to the ones of this term, for the
+// postings they have in common.
+func (rt *rankedTerm) addWeights(other rankedTerm) {
+	j := 0
+	for i, posting := range rt.postings {
+		for j < len(other.postings) && other.postings[j] < posting {
+			j++
+		}
+		if j == len(other.postings) {
+			return
+		} else if other.postings[j] == posting {
+			rt.weights[i] += other.weights[j]
+		}
+	}
+}
+
+// Private implementation of Index.SearchRanked.
+func (idx *indexImpl) SearchRanked(query string, limit int) (
+	results ScoredPostings, err error) {
+	return idx.SearchRankedWithBoosts(query, nil, limit)
+}
+
+// Private implementation of Index.SearchRankedWithBoosts.
+func (idx *indexImpl) SearchRankedWithBoosts(query string, boosts FieldBoosts,
+	limit int) (results ScoredPostings, err error) {
+
+	defer func() {
+		if err == io.EOF {
+			// Simply there were nor results from one term:
+			err = nil
+		}
+		if err != nil {
+			err = fmt.Errorf("Index.SearchRanked '%v': %w", query, err)
+		}
+	}()
+
+	if limit == 0 {
+		return // Nothing to do.
+	}
+
+	idx.statsOnce.Do(func() {
+		idx.stats, idx.statsErr = loadRankingStats(idx.trie)
+	})
+	if idx.statsErr != nil {
+		err = idx.statsErr
+		return
+	}
+
+	var fields map[string]int
+	fields, err = idx.fieldIds()
+	if err != nil {
+		return
+	}
+
+	// Boosts by field id:
+	fieldBoosts := make(map[int]float64, len(boosts))
+	for name, boost := range boosts {
+		id, ok := fields[fieldKey(name, idx.tokenizer)]
+		if !ok {
+			err = UnknownFieldError{name}
+			return
+		} else if boost < 0 {
+			err = fmt.Errorf("invalid boost %v for field '%v'", boost, name)
+			return
+		}
+		fieldBoosts[id] = boost
+	}
+
+	// Extracts all the quoted phrases, the terms scoped to a field and then
+	// all the other terms. The terms of the phrases are scored like the
+	// others, while the phrases filter the matching documents like with
+	// Search:
+	phrases, rest := ExtractPhrases(query, idx.tokenizer)
+	fieldTerms, rest := extractFieldTerms(rest, idx.tokenizer, fields)
+	terms, incomplete_term := idx.tokenizer.ForSearch(rest)
+	for _, phrase := range phrases {
+		terms = append(terms, phrase.Terms...)
+	}
+	terms = sortDedupTokens(terms)
+
+	// Special case: all the documents match with the same score:
+	if len(terms) == 0 && len(incomplete_term) == 0 && len(fieldTerms) == 0 {
+		var postings []int
+		postings, err = idx.Search(query, limit)
+		for _, posting := range postings {
+			results = append(results, ScoredPosting{posting, 0})
+		}
+		return
+	}
+
+	cursor := idx.cursor()
+	defer idx.release(cursor)
+
+	// Fetches postings and frequencies of each term, the incomplete one is
+	// matched as a prefix. The occurrences found in boosted fields count as
+	// many times as the boost of the field:
+	var rankedTerms []rankedTerm
+	if len(incomplete_term) > 0 {
+		terms = append(terms, incomplete_term)
+	}
+	for i, term := range terms {
+		isPrefix := len(incomplete_term) > 0 && i == len(terms)-1
+
+		var rt rankedTerm
+		rt, err = rankTerm(cursor, term, isPrefix, 1)
+		if err != nil || len(rt.postings) == 0 {
+			return
+		}
+
+		for id, boost := range fieldBoosts {
+			var fieldRt rankedTerm
+			fieldRt, err = rankTerm(cursor, fieldPrefix(id)+term,
+				isPrefix, boost-1)
+			if err != nil {
+				return
+			}
+			rt.addWeights(fieldRt)
+		}
+
+		rankedTerms = append(rankedTerms, rt)
+	}
+	for _, fieldTerm := range fieldTerms {
+		boost, ok := fieldBoosts[fieldTerm.id]
+		if !ok {
+			boost = 1
+		}
+
+		for i, term := range fieldTerm.terms {
+			isPrefix := fieldTerm.incomplete && i == len(fieldTerm.terms)-1
+
+			var rt rankedTerm
+			rt, err = rankTerm(cursor, fieldTerm.prefix+term, isPrefix,
+				boost)
+			if err != nil || len(rt.postings) == 0 {
+				return
+			}
+			rankedTerms = append(rankedTerms, rt)
+		}
+	}
+
+	// Only the documents matching all the terms and all the phrases are
+	// scored:
+	mergedPostings := rankedTerms[0].postings
+	for _, rt := range rankedTerms[1:] {
+		mergedPostings = IntersectPostings(mergedPostings, rt.postings)
+		if len(mergedPostings) == 0 {
+			return // No result!
+		}
+	}
+	for _, phrase := range phrases {
+		var phrasePostings []int
+		phrasePostings, err = cursor.MatchPhrase(phrase)
+		if err != nil {
+			return
+		}
+		mergedPostings = IntersectPostings(mergedPostings, phrasePostings)
+		if len(mergedPostings) == 0 {
+			return // No result!
+		}
+	}
+
+	// Scores each matching document summing the scores of all the terms:
+	results_ := make(ScoredPostings, len(mergedPostings))
+	for i, posting := range mergedPostings {
+		results_[i].Posting = posting
+	}
+	for _, rt := range rankedTerms {
+		df := len(rt.postings)
+		j := 0
+		for i := range results_ {
+			for rt.postings[j] < results_[i].Posting {
+				j++
+			}
+			length := idx.stats.lengths[results_[i].Posting]
+			results_[i].Score += idx.stats.score(rt.weights[j], df, length)
+		}
+	}
+	sort.Sort(results_)
+
+	// In case we have a limit set it truncates the result:
+	if limit >= 0 && limit < len(results_) {
+		results = results_[:limit]
+	} else {
+		results = results_
+	}
+
+	return
+}
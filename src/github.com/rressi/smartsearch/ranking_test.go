@@ -0,0 +1,122 @@
+package smartsearch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestIndex_SearchRanked(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "apple apple banana")
+	builder.AddDocument(2, "apple cherry cherry cherry cherry cherry")
+	builder.AddDocument(3, "banana")
+	builder.AddDocument(4, "cherry")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	queries := []string{"apple ", "ban", "cherry ", "apple cherry ", "xyz",
+		""}
+	all_expected_postings := [][]int{{1, 2}, {3, 1}, {2, 4}, {2}, {},
+		{1, 2, 3, 4}}
+	for i, query := range queries {
+		results, err := index.SearchRanked(query, -1)
+		if err != nil {
+			t.Errorf("SearchRanked failed with query %v: %v", query, err)
+		} else if !reflect.DeepEqual(results.Postings(),
+			all_expected_postings[i]) {
+			t.Errorf("Unexpected result with query [%v]: results=%v", query,
+				results)
+		}
+
+		for j := 1; j < len(results); j++ {
+			if results[j].Score > results[j-1].Score {
+				t.Errorf("Results not sorted by score: %v", results)
+			}
+		}
+	}
+
+	// Limit:
+	results, err := index.SearchRanked("apple", 1)
+	if err != nil {
+		t.Errorf("SearchRanked failed: %v", err)
+	} else if len(results) != 1 || results[0].Posting != 1 ||
+		results[0].Score <= 0 {
+		t.Errorf("Unexpected result: results=%v", results)
+	}
+}
+
+func TestIndex_SearchRankedWithoutLengths(t *testing.T) {
+
+	trieBuilder := NewTrieBuilderWithFeatures(FeatureFrequencies)
+	trieBuilder.AddBulk(IndexedTerms{
+		{"apple", []int{1, 2}, []int{1, 3}, nil, 4},
+		{"pear", []int{3}, []int{1}, nil, 1}})
+	buf := new(bytes.Buffer)
+	trieBuilder.Dump(buf)
+
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	results, err := index.SearchRanked("apple ", -1)
+	if err != nil {
+		t.Errorf("SearchRanked failed: %v", err)
+	} else if !reflect.DeepEqual(results.Postings(), []int{2, 1}) {
+		t.Errorf("Unexpected result: results=%v", results)
+	}
+}
+
+func TestIndex_SearchRankedPhrases(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "Golden Gate Park")
+	builder.AddDocument(2, "Gate of the Golden Temple, golden gold")
+	builder.AddDocument(3, "The golden old gate")
+	builder.AddDocument(4, "Golden Gate Bridge, the gate")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	// Ranking changes the order of the documents found by Search, not the
+	// documents themselves:
+	queries := []string{`"golden gate"`, `"golden gate"~1`, `"gate golden"`,
+		`"golden gate" park`, `"the gate" gol`, `"golden"`}
+	for _, query := range queries {
+		postings, err := index.Search(query, -1)
+		if err != nil {
+			t.Errorf("Search failed with query %v: %v", query, err)
+			continue
+		}
+		results, err := index.SearchRanked(query, -1)
+		if err != nil {
+			t.Errorf("SearchRanked failed with query %v: %v", query, err)
+			continue
+		}
+		ranked := SortDedupPostings(results.Postings())
+		if len(ranked) == 0 {
+			ranked = nil
+		}
+		if !reflect.DeepEqual(ranked, postings) {
+			t.Errorf("Unexpected result with query [%v]: results=%v, "+
+				"postings=%v", query, results, postings)
+		}
+	}
+
+	// The terms of the phrase are scored:
+	results, err := index.SearchRanked(`"golden gate"`, -1)
+	if err != nil || len(results) != 2 || results[1].Score <= 0 {
+		t.Errorf("Unexpected result: results=%v, err=%v", results, err)
+	}
+}
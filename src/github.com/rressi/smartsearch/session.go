@@ -0,0 +1,485 @@
+package smartsearch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A search session for search-as-you-type, where each query is usually the
+// previous one plus or minus few characters.
+//
+// The session remembers the postings matching the complete terms of the
+// previous query and the node reached with its potentially incomplete term,
+// so that typing one more character is just a step down from that node and
+// completing a term reuses the postings of all the others.
+//
+// A session gives the very same results of Index.Search, whatever the
+// sequence of queries. It is not safe for concurrent use, but many sessions
+// can be used at the same time on the same Index.
+//
+// Its state can be saved with Token and restored with Index.NewSearchSession
+// by stateless clients, like the ones of an HTTP server.
+type SearchSession struct {
+	idx        *indexImpl
+	cursor     *Cursor
+	complete   bool        // If postings are the ones of the complete part.
+	phrases    []Phrase    // Phrases of the last query.
+	fieldTerms []fieldTerm // Field terms of the last query.
+	terms      []string    // Complete terms of the last query, sorted.
+	postings   []int       // Postings of all the above.
+	incomplete string      // Potentially incomplete term of the last query.
+	node       Node        // Node of incomplete, if matched.
+	query      string      // The last query.
+}
+
+// This error is returned when a session token is not valid.
+var InvalidSessionToken = errors.New("Invalid session token")
+
+// Maximum number of postings stored in a session token, the complete part of
+// the query is matched again when restoring a token with more postings.
+const maxSessionTokenPostings = 1024
+
+// Private implementation of Index.NewSearchSession.
+func (idx *indexImpl) NewSearchSession(token string) (
+	session *SearchSession, err error) {
+
+	session_ := &SearchSession{idx: idx}
+	session_.cursor, _ = idx.trie.Root()
+	if token != "" {
+		err = session_.restore(token)
+		if err != nil {
+			err = fmt.Errorf("Index.NewSearchSession: %w", err)
+			return
+		}
+	}
+
+	session = session_
+	return
+}
+
+// It clears the state of this session, as if no query was searched before.
+func (s *SearchSession) clear() {
+	idx, cursor := s.idx, s.cursor
+	*s = SearchSession{idx: idx, cursor: cursor}
+}
+
+// Like Index.Search, but reusing as much as possible the work done for the
+// previous query of this session.
+//
+// It returns:
+// - postings of matching documents, sorted and deduplicated.
+// - an error in case of failure
+func (s *SearchSession) Search(query string, limit int) (postings []int,
+	err error) {
+
+	defer func() {
+		if err != nil {
+			s.clear()
+			err = fmt.Errorf("SearchSession.Search '%v': %v", query, err)
+		}
+	}()
+
+	if limit == 0 {
+		return // Nothing to do.
+	}
+
+	var fields map[string]int
+	fields, err = s.idx.fieldIds()
+	if err != nil {
+		return
+	}
+
+	phrases, rest := ExtractPhrases(query, s.idx.tokenizer)
+	fieldTerms, rest := extractFieldTerms(rest, s.idx.tokenizer, fields)
+	terms, incomplete := s.idx.tokenizer.ForSearch(rest)
+
+	// The complete part of the query, if it is not just the previous one with
+	// more terms, is matched from scratch. The node of the incomplete term
+	// does not depend on it and it is kept:
+	extraTerms, isSuperset := differenceTerms(terms, s.terms)
+	if !s.complete || !isSuperset || !reflect.DeepEqual(phrases, s.phrases) ||
+		!reflect.DeepEqual(fieldTerms, s.fieldTerms) {
+		previousIncomplete, previousNode := s.incomplete, s.node
+		s.clear()
+		s.incomplete, s.node = previousIncomplete, previousNode
+		err = s.matchPhrasesAndFields(phrases, fieldTerms)
+		if err != nil {
+			return
+		}
+		extraTerms = terms
+	}
+
+	// Matches the new complete terms, the previous incomplete term is usually
+	// one of them. Only then its node is not useful anymore:
+	consumed := false
+	for _, term := range extraTerms {
+		err = s.matchTerm(term)
+		if err != nil {
+			return
+		}
+		consumed = consumed || term == s.incomplete
+	}
+	s.terms = terms
+	if consumed {
+		s.incomplete, s.node = "", Node{}
+	}
+
+	// Matches the incomplete term, from the node of the previous one if this
+	// is just a longer version of it:
+	var node Node
+	if incomplete == "" {
+		// pass
+	} else if s.incomplete != "" && strings.HasPrefix(incomplete,
+		s.incomplete) {
+		if s.node != (Node{}) {
+			node, err = s.match(s.node, incomplete[len(s.incomplete):])
+		}
+	} else {
+		node, err = s.match(Node{}, incomplete)
+	}
+	if err != nil {
+		return
+	}
+	s.incomplete, s.node, s.query = incomplete, node, query
+
+	postings, err = s.results(limit)
+	return
+}
+
+// It tells if the complete part of the last query has any constraint.
+func (s *SearchSession) constrained() bool {
+	return len(s.terms) > 0 || len(s.fieldTerms) > 0 || len(s.phrases) > 0
+}
+
+// It intersects the postings of the complete part of the last query with the
+// given ones.
+func (s *SearchSession) intersect(postings []int) {
+	if !s.constrained() {
+		s.postings = postings
+	} else {
+		s.postings = IntersectPostings(s.postings, postings)
+	}
+}
+
+// It sets the postings of the complete part of the query to the ones matching
+// the given phrases and field terms.
+//
+// It returns:
+// - an error in case of failure.
+func (s *SearchSession) matchPhrasesAndFields(phrases []Phrase,
+	fieldTerms []fieldTerm) (err error) {
+
+	var mergedPostings []int
+	first := true
+	intersect := func(postings []int) {
+		if first {
+			mergedPostings, first = postings, false
+		} else {
+			mergedPostings = IntersectPostings(mergedPostings, postings)
+		}
+	}
+
+	for _, fieldTerm := range fieldTerms {
+		for i, term := range fieldTerm.terms {
+			isPrefix := fieldTerm.incomplete && i == len(fieldTerm.terms)-1
+			var fieldPostings []int
+			fieldPostings, err = termPostings(s.cursor,
+				fieldTerm.prefix+term, isPrefix)
+			if err != nil {
+				return
+			}
+			intersect(fieldPostings)
+		}
+	}
+
+	for _, phrase := range phrases {
+		var phrasePostings []int
+		phrasePostings, err = s.cursor.MatchPhrase(phrase)
+		if err != nil {
+			return
+		}
+		intersect(phrasePostings)
+	}
+
+	s.phrases, s.fieldTerms = phrases, fieldTerms
+	s.postings, s.complete = mergedPostings, true
+	return
+}
+
+// It intersects the postings of the complete part of the query with the ones
+// of the given term.
+//
+// It returns:
+// - an error in case of failure.
+func (s *SearchSession) matchTerm(term string) (err error) {
+
+	var termPostings []int
+	if s.constrained() && len(s.postings) == 0 {
+		// pass, no result anyway.
+	} else {
+		// The previous incomplete term has been already matched:
+		node := s.node
+		if term != s.incomplete {
+			node, err = s.match(Node{}, term)
+		} else if node != (Node{}) {
+			err = s.cursor.JumpNode(node)
+		}
+		if err == nil && node.NumPostings > 0 {
+			termPostings, err = s.cursor.ReadAllPostings()
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	s.intersect(termPostings)
+	s.terms = append(s.terms, term)
+	return
+}
+
+// It matches the given term starting from the given node, or from the root
+// node if zeroed.
+//
+// It returns:
+// - the matched node, a zeroed one if not found.
+// - an error in case of failure.
+func (s *SearchSession) match(from Node, term string) (node Node, err error) {
+
+	if from == (Node{}) {
+		_, err = s.cursor.Reset()
+	} else {
+		err = s.cursor.JumpNode(from)
+	}
+	if err != nil || term == "" {
+		node = from
+		return
+	}
+
+	node, err = s.cursor.Match(term)
+	return
+}
+
+// It returns the postings of the last query, from the postings of its
+// complete part and from the node of its incomplete term.
+//
+// Postings of the incomplete term are decoded lazily, only the ones needed to
+// reach the given limit (no limit if negative).
+func (s *SearchSession) results(limit int) (postings []int, err error) {
+
+	var iterator PostingIterator
+	if s.incomplete == "" && s.constrained() {
+		iterator = NewSlicePostingIterator(s.postings)
+	} else if s.incomplete == "" {
+		// Special case: we need to extract all the postings:
+		var root Node
+		root, err = s.cursor.Reset()
+		if err == nil {
+			iterator, err = s.cursor.PrefixPostingIterator(root)
+		}
+	} else if s.node != (Node{}) && (!s.constrained() || len(s.postings) > 0) {
+		iterator, err = s.cursor.PrefixPostingIterator(s.node)
+		if err == nil && s.constrained() {
+			iterator = IntersectPostingIterators(
+				NewSlicePostingIterator(s.postings), iterator)
+		}
+	}
+	if err != nil || iterator == nil {
+		return
+	}
+
+	postings, err = ReadPostingIterator(iterator, limit)
+	return
+}
+
+// It takes 2 sorted and deduplicated sequences of terms.
+//
+// It returns:
+// - the terms of the first sequence that are not in the second one.
+// - true if the first sequence contains all the terms of the second one.
+func differenceTerms(termsA []string, termsB []string) (terms []string,
+	isSuperset bool) {
+
+	for _, term := range termsA {
+		i := sort.SearchStrings(termsB, term)
+		if i == len(termsB) || termsB[i] != term {
+			terms = append(terms, term)
+		}
+	}
+
+	isSuperset = len(termsA)-len(terms) == len(termsB)
+	return
+}
+
+// Session tokens are the state of a session encoded with base64 (URL
+// encoding, without padding):
+//
+//   [trie identity: 8 bytes little endian]
+//   [query length: UVarint] [query]
+//   [number of postings + 1: UVarint] [postings: UVarint deltas...]
+//   [node length: UVarint] [node (see Node.MarshalBinary)]
+//
+// The number of postings is 0 when they are not stored, while the length of
+// the node is 0 when the incomplete term was not found.
+//
+// Tokens are not signed: a client can only tamper the results of its own
+// session, and a tampered node is refused by Cursor.JumpNode.
+
+// It returns a token with the state of this session, that can be given to
+// Index.NewSearchSession to continue from the last query searched so far.
+//
+// The token is opaque and it is valid only with the same index, with another
+// one the new session just starts from scratch.
+func (s *SearchSession) Token() string {
+
+	buf := new(bytes.Buffer)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	writeInt := func(value int) {
+		numBytes := binary.PutUvarint(tmp, uint64(value))
+		buf.Write(tmp[:numBytes])
+	}
+
+	// Without its identity the index refuses the state of the token, and the
+	// next session just starts from scratch:
+	identity, _ := s.idx.trie.Identity()
+	binary.LittleEndian.PutUint64(tmp, identity)
+	buf.Write(tmp[:8])
+	writeInt(len(s.query))
+	buf.WriteString(s.query)
+
+	if !s.complete || len(s.postings) > maxSessionTokenPostings {
+		writeInt(0)
+	} else {
+		writeInt(len(s.postings) + 1)
+		previous := -1
+		for _, posting := range s.postings {
+			writeInt(posting - previous - 1)
+			previous = posting
+		}
+	}
+
+	var node []byte
+	if s.node != (Node{}) {
+		node, _ = s.node.MarshalBinary()
+	}
+	writeInt(len(node))
+	buf.Write(node)
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// It restores the state of this session from the given token (see Token).
+//
+// It returns:
+// - InvalidSessionToken if the token is not valid.
+// - an error in case of failure.
+func (s *SearchSession) restore(token string) (err error) {
+
+	defer func() {
+		if err != nil {
+			s.clear()
+			err = fmt.Errorf("%w: %v", InvalidSessionToken, err)
+		}
+	}()
+
+	var data []byte
+	data, err = base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return
+	} else if len(data) < 8 {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	identity := binary.LittleEndian.Uint64(data)
+	reader := bytes.NewReader(data[8:])
+	readBytes := func() (bytes_ []byte, err error) {
+		var size uint64
+		size, err = binary.ReadUvarint(reader)
+		if err == nil && size > uint64(reader.Len()) {
+			err = io.ErrUnexpectedEOF
+		} else if err == nil {
+			bytes_ = make([]byte, size)
+			reader.Read(bytes_)
+		}
+		return
+	}
+
+	var query []byte
+	query, err = readBytes()
+	if err != nil {
+		return
+	}
+
+	var numPostings uint64
+	numPostings, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return
+	} else if numPostings > maxSessionTokenPostings+1 {
+		err = fmt.Errorf("too many postings: %v", numPostings)
+		return
+	}
+	var postings []int
+	if numPostings > 0 {
+		postings = make([]int, numPostings-1)
+		previous := -1
+		for i := range postings {
+			var delta uint64
+			delta, err = binary.ReadUvarint(reader)
+			if err != nil {
+				return
+			} else if delta > uint64(maxHandleValue-previous-1) {
+				err = fmt.Errorf("invalid posting delta: %v", delta)
+				return
+			}
+			postings[i] = previous + 1 + int(delta)
+			previous = postings[i]
+		}
+	}
+
+	var nodeBytes []byte
+	var node Node
+	nodeBytes, err = readBytes()
+	if err == nil && len(nodeBytes) > 0 {
+		err = node.UnmarshalBinary(nodeBytes)
+	}
+	if err != nil {
+		return
+	} else if reader.Len() > 0 {
+		err = fmt.Errorf("%v trailing bytes", reader.Len())
+		return
+	}
+
+	// A token of another index is still valid, but its state is useless:
+	trieIdentity, identityErr := s.idx.trie.Identity()
+	if identityErr != nil || identity != trieIdentity {
+		return
+	}
+
+	// The query is parsed again to know its terms, that must be consistent
+	// with the stored node:
+	var fields map[string]int
+	fields, err = s.idx.fieldIds()
+	if err != nil {
+		return
+	}
+	s.query = string(query)
+	phrases, rest := ExtractPhrases(s.query, s.idx.tokenizer)
+	fieldTerms, rest := extractFieldTerms(rest, s.idx.tokenizer, fields)
+	terms, incomplete := s.idx.tokenizer.ForSearch(rest)
+	if incomplete == "" && node != (Node{}) {
+		err = errors.New("unexpected node")
+		return
+	}
+	s.incomplete, s.node = incomplete, node
+	if numPostings > 0 {
+		s.phrases, s.fieldTerms, s.terms = phrases, fieldTerms, terms
+		s.postings, s.complete = postings, true
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package smartsearch
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Queries typed one character at a time, with some corrections.
+var sessionTestQueries = []string{
+	"title:alpha gamma del",
+	"beta gamma zeta alpha",
+	"\"delta epsilon\" alp",
+	"zeta  epsilon x",
+	"body:gam beta",
+	"alphx",
+	"-gamma- ",
+	"ALPHA, Beta gam!"}
+
+// It returns all the queries typed while writing the given one, one character
+// at a time, also deleting and typing again the last 2 characters.
+func typedQueries(query string) (queries []string) {
+	for i := 1; i <= len(query); i++ {
+		queries = append(queries, query[:i])
+	}
+	if len(query) > 2 {
+		queries = append(queries, query[:len(query)-1], query[:len(query)-2],
+			query[:len(query)-1], query)
+	}
+	return
+}
+
+func TestSearchSession_Search(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	session, err := index.NewSearchSession("")
+	if err != nil {
+		t.Fatalf("NewSearchSession failed: %v", err)
+	}
+	for _, typed := range sessionTestQueries {
+		for _, query := range typedQueries(typed) {
+			for _, limit := range []int{-1, 3} {
+				expected, _ := index.Search(query, limit)
+				postings, err := session.Search(query, limit)
+				if err != nil {
+					t.Errorf("Search failed with query [%v]: %v", query, err)
+				} else if !reflect.DeepEqual(postings, expected) {
+					t.Errorf("Unexpected result with query [%v]: %v", query,
+						postings)
+				}
+			}
+		}
+	}
+
+	// The postings of the session cannot be altered by the caller:
+	postings, _ := session.Search("beta ", -1)
+	postings[0] = -1
+	postings, _ = session.Search("beta ", -1)
+	if len(postings) == 0 || postings[0] == -1 {
+		t.Errorf("Unexpected result: %v", postings)
+	}
+}
+
+func TestSearchSession_EditCompleteTerms(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	session, err := index.NewSearchSession("")
+	if err != nil {
+		t.Fatalf("NewSearchSession failed: %v", err)
+	}
+
+	// Marks the node of the incomplete term, to tell if it is matched again:
+	session.Search("alpha gam", -1)
+	session.node.Occurrences = -1
+
+	// Editing another term keeps the node of the incomplete one:
+	for _, query := range []string{"alpha beta gam", "beta gam", "beta gamm"} {
+		expected, _ := index.Search(query, -1)
+		postings, err := session.Search(query, -1)
+		if err != nil || !reflect.DeepEqual(postings, expected) {
+			t.Errorf("Unexpected result with query [%v]: %v, err=%v", query,
+				postings, err)
+		}
+		if query != "beta gamm" && session.node.Occurrences != -1 {
+			t.Errorf("Node matched again with query [%v]", query)
+		}
+	}
+
+	// Once completed the term is matched as a complete one:
+	postings, err := session.Search("beta gamm gamma", -1)
+	expected, _ := index.Search("beta gamm gamma", -1)
+	if err != nil || !reflect.DeepEqual(postings, expected) {
+		t.Errorf("Unexpected result: %v, err=%v", postings, err)
+	}
+}
+
+func TestSearchSession_Token(t *testing.T) {
+
+	raw := newConcurrencyTestIndex(t)
+	index, _, err := NewIndex(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	// Each query is searched by a new session continuing from the token of
+	// the previous one, like a stateless HTTP client would do:
+	var token string
+	for _, typed := range sessionTestQueries {
+		for _, query := range typedQueries(typed) {
+			session, err := index.NewSearchSession(token)
+			if err != nil {
+				t.Fatalf("NewSearchSession failed with token %v: %v", token,
+					err)
+			}
+			expected, _ := index.Search(query, -1)
+			postings, err := session.Search(query, -1)
+			if err != nil {
+				t.Errorf("Search failed with query [%v]: %v", query, err)
+			} else if !reflect.DeepEqual(postings, expected) {
+				t.Errorf("Unexpected result with query [%v]: %v", query,
+					postings)
+			}
+			token = session.Token()
+		}
+	}
+
+	// A token of another index is useless but valid:
+	builder := NewIndexBuilder()
+	builder.AddDocument(7, "alpha beta")
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	other, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+	session, err := other.NewSearchSession(token)
+	if err != nil {
+		t.Fatalf("NewSearchSession failed: %v", err)
+	}
+	postings, err := session.Search("alpha b", -1)
+	if err != nil || !reflect.DeepEqual(postings, []int{7}) {
+		t.Errorf("Unexpected result: %v, err=%v", postings, err)
+	}
+
+	// Invalid tokens:
+	for _, invalid := range []string{"!", "AAAA", token[:len(token)-2],
+		token + "AA"} {
+		_, err = index.NewSearchSession(invalid)
+		if !errors.Is(err, InvalidSessionToken) {
+			t.Errorf("InvalidSessionToken was expected with %v: %v", invalid,
+				err)
+		}
+	}
+}
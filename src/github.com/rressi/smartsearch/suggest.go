@@ -0,0 +1,154 @@
+package smartsearch
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// It represents one completion of a prefix as returned by method Suggest.
+type Suggestion struct {
+	Term  string `json:"term"`  // The completed term.
+	Count int    `json:"count"` // Number of documents containing the term.
+}
+
+// It tells if this suggestion is more relevant than the other one.
+func (s Suggestion) isBetterThan(other Suggestion) bool {
+	if s.Count != other.Count {
+		return s.Count > other.Count
+	}
+	return s.Term < other.Term
+}
+
+// A sequence of suggestions, from the most relevant.
+type Suggestions []Suggestion
+
+// Implementation of sort.Interface, sorting by decreasing count and then by
+// term.
+func (s Suggestions) Len() int {
+	return len(s)
+}
+
+// Implementation of sort.Interface
+func (s Suggestions) Less(i, j int) bool {
+	return s[i].isBetterThan(s[j])
+}
+
+// Implementation of sort.Interface
+func (s Suggestions) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// A heap keeping the least relevant suggestion on top, used to select the best
+// suggestions without sorting all of them.
+type suggestionsHeap struct {
+	Suggestions
+}
+
+// Implementation of heap.Interface
+func (h *suggestionsHeap) Less(i, j int) bool {
+	return h.Suggestions.Less(j, i)
+}
+
+// Implementation of heap.Interface
+func (h *suggestionsHeap) Push(x interface{}) {
+	h.Suggestions = append(h.Suggestions, x.(Suggestion))
+}
+
+// Implementation of heap.Interface
+func (h *suggestionsHeap) Pop() interface{} {
+	n := len(h.Suggestions)
+	x := h.Suggestions[n-1]
+	h.Suggestions = h.Suggestions[:n-1]
+	return x
+}
+
+// It traverses the trie from the root node to the given prefix and then
+// enumerates all the terms having that prefix (the prefix itself included).
+//
+// At the end of the traversal the cursor is left in an undefined position,
+// methods Reset or JumpNode can be used to continue using it.
+//
+// It returns:
+// - at most n completions (all of them if n is negative) ordered by
+//   decreasing number of documents and then by term.
+// - an error in case of failure.
+func (c *Cursor) Suggest(prefix string, n int) (suggestions Suggestions,
+	err error) {
+
+	defer func() {
+		if err != nil {
+			c.clear()
+			err = fmt.Errorf("Cursor.Suggest('%v'): %v", prefix, err)
+		}
+	}()
+
+	if n == 0 {
+		return
+	}
+
+	var node Node
+	node, err = c.Reset()
+	if err == nil && len(prefix) > 0 {
+		node, err = c.Match(prefix)
+	}
+	if err != nil || (node.NumPostings == 0 && node.NumEdges == 0) {
+		return
+	}
+
+	h := new(suggestionsHeap)
+	err = c.suggestRec(h, []rune(prefix), node, n)
+	if err != nil {
+		return
+	}
+
+	// The heap contains the best suggestions, we just need to sort them:
+	sort.Sort(h.Suggestions)
+	suggestions = h.Suggestions
+	return
+}
+
+// It collects recursively the suggestions from the current node of the cursor,
+// reached with the given path, keeping only the best n of them.
+func (c *Cursor) suggestRec(h *suggestionsHeap, path []rune, node Node,
+	n int) (err error) {
+
+	if node.NumPostings > 0 {
+		suggestion := Suggestion{string(path), node.NumPostings}
+		if n < 0 || h.Len() < n {
+			heap.Push(h, suggestion)
+		} else if suggestion.isBetterThan(h.Suggestions[0]) {
+			h.Suggestions[0] = suggestion
+			heap.Fix(h, 0)
+		}
+	}
+
+	var edges []Edge
+	edges, err = c.ReadAllEdges()
+	if err == io.EOF {
+		return nil // No sub-nodes.
+	} else if err != nil {
+		return
+	}
+
+	for _, edge := range edges {
+		if isFieldRune(edge.Rune) {
+			continue // Terms of one field, they are never suggested.
+		}
+
+		var child Node
+		child, err = c.EnterNode(edge)
+		if err != nil {
+			return
+		}
+
+		childPath := append(append(path, edge.Rune), []rune(edge.Suffix)...)
+		err = c.suggestRec(h, childPath, child, n)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,89 @@
+package smartsearch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCursor_Suggest(t *testing.T) {
+	testCursor_Suggest(t, 0)
+	testCursor_Suggest(t, FeatureRadixEdges)
+}
+
+func testCursor_Suggest(t *testing.T, features IndexFeatures) {
+
+	builder := NewTrieBuilderWithFeatures(features)
+	builder.Add(1, "golden")
+	builder.Add(2, "golden")
+	builder.Add(3, "golden")
+	builder.Add(1, "gate")
+	builder.Add(2, "gate")
+	builder.Add(4, "go")
+	builder.Add(5, "good")
+	builder.Add(6, "good")
+	builder.Add(7, "park")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	reader, _, err := NewTrieReader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie reader: %v", err)
+	}
+
+	cases := []struct {
+		prefix   string
+		n        int
+		expected Suggestions
+	}{
+		{"g", -1, Suggestions{{"golden", 3}, {"gate", 2}, {"good", 2},
+			{"go", 1}}},
+		{"g", 2, Suggestions{{"golden", 3}, {"gate", 2}}},
+		{"go", 3, Suggestions{{"golden", 3}, {"good", 2}, {"go", 1}}},
+		{"gold", 10, Suggestions{{"golden", 3}}},
+		{"golde", 10, Suggestions{{"golden", 3}}},
+		{"pa", 10, Suggestions{{"park", 1}}},
+		{"pak", 10, nil},
+		{"", 2, Suggestions{{"golden", 3}, {"gate", 2}}},
+		{"x", 10, nil},
+		{"g", 0, nil},
+	}
+
+	for _, c := range cases {
+		suggestions, err := reader.Suggest(c.prefix, c.n)
+		if err != nil {
+			t.Errorf("Suggest('%v') failed: %v", c.prefix, err)
+		} else if !reflect.DeepEqual(suggestions, c.expected) {
+			t.Errorf("Unexpected suggestions for '%v': %v", c.prefix,
+				suggestions)
+		}
+	}
+}
+
+func TestIndex_Suggest(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "Golden Gate Bridge")
+	builder.AddDocument(2, "Golden Gate Park")
+	builder.AddDocument(3, "Gateway")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+	index, _, err := NewIndex(buf)
+	if err != nil {
+		t.Fatalf("Cannot create index: %v", err)
+	}
+
+	suggestions, err := index.Suggest("Golden GA", 10)
+	expected := Suggestions{{"gate", 2}, {"gateway", 1}}
+	if err != nil {
+		t.Errorf("Suggest failed: %v", err)
+	} else if !reflect.DeepEqual(suggestions, expected) {
+		t.Errorf("Unexpected suggestions: %v", suggestions)
+	}
+
+	suggestions, err = index.Suggest("Golden ", 10)
+	if err != nil || suggestions != nil {
+		t.Errorf("Unexpected suggestions: %v, err=%v", suggestions, err)
+	}
+}
@@ -15,8 +15,14 @@ type tokenizerImpl struct {
 }
 
 func NewTokenizer() Tokenizer {
+	return NewTokenizerWithNormalizer(NewNormalizer())
+}
+
+// Like NewTokenizer but the text is normalized by the given normalizer, for
+// example the one of a language (see NewNormalizerWithLanguage).
+func NewTokenizerWithNormalizer(normalizer Normalizer) Tokenizer {
 	tokenizer := new(tokenizerImpl)
-	tokenizer.normalizer = NewNormalizer()
+	tokenizer.normalizer = normalizer
 	return tokenizer
 }
 
@@ -87,21 +93,32 @@ func (t *tokenizerImpl) ForSearch(query string) (tokens []string,
 		tokens_ = tokens_[:len(tokens_)-1]
 	}
 
-	// Sorts and deduplicates extracted tokens:
-	if len(tokens_) > 1 {
-		sort.Strings(tokens_)
+	// Generates the final result:
+	tokens = sortDedupTokens(tokens_)
+	incompleteToken = incompleteToken_
+	return
+}
+
+// It sorts and deduplicates the given tokens, in place.
+//
+// It returns:
+// - the sorted and deduplicated tokens, nil if there are none.
+func sortDedupTokens(tokens []string) (result []string) {
+
+	if len(tokens) == 0 {
+		return
+	} else if len(tokens) > 1 {
+		sort.Strings(tokens)
 		i := 0
-		for j := 1; j < len(tokens_); j++ {
-			if tokens_[i] != tokens_[j] {
+		for j := 1; j < len(tokens); j++ {
+			if tokens[i] != tokens[j] {
 				i++
-				tokens_[i] = tokens_[j]
+				tokens[i] = tokens[j]
 			}
 		}
-		tokens_ = tokens_[:i+1]
+		tokens = tokens[:i+1]
 	}
 
-	// Generates the final result:
-	tokens = append(tokens, tokens_...)
-	incompleteToken = incompleteToken_
+	result = tokens
 	return
 }
@@ -93,3 +93,21 @@ func TestTokenizer_Search(t *testing.T) {
 		t.Errorf("Unexpected result: incomplete_token=%v", incomplete_token)
 	}
 }
+
+func TestTokenizer_Expansions(t *testing.T) {
+
+	tokenizer := NewTokenizer()
+
+	tokens := tokenizer.Apply("Große Straße, grosse strasse")
+	expected := []string{"grosse", "strasse", "grosse", "strasse"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Unexpected result: tokens=%v", tokens)
+	}
+
+	tokens, incomplete := tokenizer.ForSearch("große straß")
+	if !reflect.DeepEqual(tokens, []string{"grosse"}) {
+		t.Errorf("Unexpected result: tokens=%v", tokens)
+	} else if incomplete != "strass" {
+		t.Errorf("Unexpected result: incomplete=%v", incomplete)
+	}
+}
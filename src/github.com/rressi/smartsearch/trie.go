@@ -0,0 +1,208 @@
+package smartsearch
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// An encoded trie, either a plain one generated by TrieBuilder or the one of a
+// whole index generated by IndexBuilder.
+//
+// A Trie is immutable: it is safe for concurrent use by multiple goroutines
+// and it is traversed through cursors (see Root), that carry all the state of
+// one traversal.
+type Trie struct {
+	header     IndexHeader
+	source     trieSource // Never moved, cursors read from their copies.
+	rootOffset int
+	root       Cursor // Positioned on the root node.
+	rootNode   Node
+
+	identityOnce sync.Once // Computes identity on the first call of Identity.
+	identity     uint64
+	identityErr  error
+}
+
+// It creates a new Trie from the given bytes.
+//
+// Passed bytes are not changed by the created trie, just shared lazily
+// decoded while traversing the trie. Changing this bytes may lead to undefined
+// behaviour of the Trie and of its cursors.
+//
+// Bytes can be either a plain trie generated by TrieBuilder or a whole index
+// generated by IndexBuilder. In the latter case the index header is validated
+// together with the checksum of the content, and the trie is decoded right
+// after it.
+//
+// It returns:
+// - the newly created Trie
+// - an error in case of failure
+func NewTrie(bytes_ []byte) (trie *Trie, err error) {
+	return newTrie(newTrieSourceFromBytes(bytes_), true)
+}
+
+// It creates a new Trie that decodes lazily the trie from the given
+// io.ReaderAt.
+//
+// Only the ranges of bytes touched while traversing the trie are read, so
+// huge tries can be used straight from a file without loading them in memory.
+//
+// Like with NewTrie the source can be a plain trie or a whole index. In the
+// latter case the index header is validated but only the size of the content
+// is checked, not its checksum: that would require reading all the bytes.
+// Method Verify can be used for a full check.
+//
+// It returns:
+// - the newly created Trie
+// - an error in case of failure
+func NewTrieAt(src io.ReaderAt, size int64) (trie *Trie, err error) {
+	return newTrie(newTrieSourceFromReaderAt(src, int(size)), false)
+}
+
+// It implements NewTrie and NewTrieAt.
+//
+// If the source is an index with FeatureChecksum, fullChecksum tells if the
+// checksum has to be verified or only the size of the content.
+func newTrie(source trieSource, fullChecksum bool) (trie *Trie, err error) {
+
+	// Reads enough bytes to decode the header, if any:
+	prefix := make([]byte, maxIndexHeaderSize)
+	if source.size < len(prefix) {
+		prefix = prefix[:source.size]
+	}
+	reader := source
+	for i := range prefix {
+		prefix[i], err = reader.ReadByte()
+		if err != nil {
+			err = fmt.Errorf("NewTrie: %v", err)
+			return
+		}
+	}
+
+	var header IndexHeader
+	if HasIndexHeader(prefix) {
+		header, err = ReadIndexHeader(prefix)
+		if err != nil {
+			return
+		}
+		if fullChecksum && source.bytes != nil {
+			err = header.VerifyChecksum(source.bytes)
+		} else if fullChecksum {
+			err = header.VerifyChecksumAt(source.src, int64(source.size))
+		} else if header.Features&FeatureChecksum != 0 &&
+			header.Size+header.PayloadSize != source.size {
+			err = ChecksumMismatch
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	trie_ := &Trie{
+		header:     header,
+		source:     source,
+		rootOffset: header.TrieOffset}
+	trie_.root = Cursor{trie: trie_, reader: source}
+	trie_.rootNode, err = trie_.root.Reset()
+	if err != nil {
+		return
+	}
+
+	trie = trie_
+	return
+}
+
+// It returns a new cursor positioned on the root node of this trie.
+//
+// Creating a cursor does not decode anything, the root node has already been
+// decoded when the trie has been created.
+//
+// It returns:
+// - the newly created cursor, for the exclusive use of the caller.
+// - information about the root node.
+func (t *Trie) Root() (cursor *Cursor, node Node) {
+	cursor_ := t.root
+	cursor = &cursor_
+	node = t.rootNode
+	return
+}
+
+// It returns a hash identifying the bytes of this trie, used to tag the nodes
+// and the edges decoded from it: a Node or an Edge can be used only with the
+// very same trie they come from, also when they are marshaled and passed to
+// another process (see Node.MarshalBinary).
+//
+// The identity is the size of the trie followed by the CRC-32 of its bytes,
+// 32 bits that tell apart different tries but that are easily forged. The
+// CRC-32 of an index with FeatureChecksum is the one of its header, otherwise
+// all the bytes are read the first time the identity is needed: when a handle
+// is marshaled or is used with another Trie than the one that decoded it.
+//
+// It returns:
+// - the identity.
+// - an error in case of failure.
+func (t *Trie) Identity() (identity uint64, err error) {
+	t.identityOnce.Do(func() {
+		t.identity, t.identityErr = t.computeIdentity()
+		if t.identityErr != nil {
+			t.identityErr = fmt.Errorf("Trie.Identity: %v", t.identityErr)
+		}
+	})
+	identity, err = t.identity, t.identityErr
+	return
+}
+
+// It computes the identity of this trie (see Identity).
+func (t *Trie) computeIdentity() (identity uint64, err error) {
+
+	checksum := t.header.Checksum
+	if t.header.Features&FeatureChecksum == 0 && t.source.bytes != nil {
+		checksum = crc32.Checksum(t.source.bytes, crc32Table)
+	} else if t.header.Features&FeatureChecksum == 0 {
+		hash := crc32.New(crc32Table)
+		_, err = io.Copy(hash,
+			io.NewSectionReader(t.source.src, 0, int64(t.source.size)))
+		if err != nil {
+			return
+		}
+		checksum = hash.Sum32()
+	}
+
+	identity = uint64(t.source.size)<<32 | uint64(checksum)
+	return
+}
+
+// It returns the header of the index of this trie.
+//
+// Plain tries generated by TrieBuilder have no header, in this case a zeroed
+// header is returned.
+func (t *Trie) Header() IndexHeader {
+	return t.header
+}
+
+// It decodes the length of each document from the index, as stored by
+// IndexBuilder with FeatureDocumentLengths.
+//
+// It returns:
+// - the length of each document, nil if the index does not store them.
+// - an error in case of failure.
+func (t *Trie) ReadDocumentLengths() (lengths DocumentLengths,
+	err error) {
+
+	offset, size, ok := t.header.Section(FeatureDocumentLengths)
+	if !ok {
+		return
+	}
+
+	var bytes_ []byte
+	bytes_, err = t.source.ReadRange(offset, size)
+	if err == nil {
+		lengths, err = DecodeDocumentLengths(bytes_)
+	}
+	if err != nil {
+		err = fmt.Errorf("Trie.ReadDocumentLengths: %w", err)
+	}
+	return
+}
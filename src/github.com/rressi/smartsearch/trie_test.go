@@ -0,0 +1,98 @@
+package smartsearch
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func makeTestTrie(t *testing.T) *Trie {
+
+	builder := NewTrieBuilder()
+	builder.Add(1, "ABC")
+	builder.Add(2, "ABD")
+	builder.Add(3, "AC")
+	builder.Add(4, "B")
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Error while dumping: %v", err)
+	}
+
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	}
+	return trie
+}
+
+func TestTrie_Root(t *testing.T) {
+
+	trie := makeTestTrie(t)
+
+	cursor, root := trie.Root()
+	if cursor.Trie() != trie {
+		t.Errorf("Unexpected trie: %v", cursor.Trie())
+	} else if root.NumPostings != 0 || root.NumEdges != 2 {
+		t.Errorf("Unexpected root node: %v", root)
+	}
+
+	// Cursors are independent from each other:
+	other, _ := trie.Root()
+	node, err := cursor.Match("AB")
+	if err != nil || node.NumEdges != 2 {
+		t.Errorf("Unexpected match: node=%v, err=%v", node, err)
+	}
+	postings, err := other.ReadAllPostingsRecursive()
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2, 3, 4}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+	postings, err = cursor.ReadAllPostingsRecursive()
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+
+	// A clone continues from the same position:
+	cursor.Reset()
+	cursor.Match("A")
+	clone := *cursor
+	edges, err := cursor.ReadAllEdges()
+	if err != nil || len(edges) != 2 {
+		t.Errorf("Unexpected edges: %v, err=%v", edges, err)
+	}
+	edge, err := clone.ReadEdge()
+	if err != nil || edge != edges[0] {
+		t.Errorf("Unexpected edge: %v, err=%v", edge, err)
+	}
+}
+
+func TestTrie_ConcurrentCursors(t *testing.T) {
+
+	trie := makeTestTrie(t)
+
+	terms := []string{"A", "AB", "ABC", "B", "C"}
+	expected := [][]int{{1, 2, 3}, {1, 2}, {1}, {4}, nil}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cursor, _ := trie.Root()
+			for j := 0; j < 100; j++ {
+				i := j % len(terms)
+				cursor.Reset()
+				cursor.Match(terms[i])
+				postings, _ := cursor.ReadAllPostingsRecursive()
+				if !reflect.DeepEqual(postings, expected[i]) {
+					t.Errorf("Unexpected postings with term %v: %v", terms[i],
+						postings)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
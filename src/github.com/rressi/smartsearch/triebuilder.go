@@ -9,37 +9,104 @@ import (
 )
 
 // A TrieBuilder is a tool that can be used to generate binary encoded tries
-// for TrieReader.
+// for Trie.
 type TrieBuilder interface {
 
 	// It adds one term to the trie to build, and associates it to one posting.
 	//
 	// The passed posting should be strictly positive.
 	//
+	// Adding the same term and posting many times counts as many occurrences
+	// of the term in the same document.
+	//
 	// If term is an empty string then the posting is added to the root node.
 	Add(posting int, term string)
 
+	// Like Add but it also records the position of the term in the document,
+	// that is the number of terms preceding it.
+	//
+	// Positions are encoded only with FeaturePositions.
+	AddAt(posting int, term string, position int)
+
 	// It adds many terms that have been already nicely indexed.
 	//
 	// Data is passed as a sorted list of terms, each term is packed together
-	// with its postings (sorted and deduplicated) and the number of
-	// times this term have been found.
+	// with its postings (sorted and deduplicated), how many times the term
+	// has been found on each posting, its positions on each posting and the
+	// number of times this term have been found overall.
 	//
 	// If a term contains an empty string then the posting is added to the root
 	// node.
 	AddBulk(data IndexedTerms)
 
+	// It returns the optional features of the encoding used by this builder.
+	Features() IndexFeatures
+
 	// Generates a trie and serializes to the passed io.Writer.
 	//
+	// If the builder has some features (see NewTrieBuilderWithFeatures) the
+	// trie is wrapped by an index header with them (see WriteIndex), as
+	// readers learn the features from it. Otherwise only the trie is
+	// written.
+	//
 	// It returns error on failures.
 	Dump(dst io.Writer) error
 }
 
+// Features of the binary format that are about the encoding of the trie
+// itself, and that TrieBuilder is therefore able to generate.
+const TrieFeatures = FeatureFrequencies | FeaturePositions |
+	FeatureSkipBlocks | FeaturePostingContainers | FeatureRadixEdges |
+	FeatureSubtreePostings
+
+// Number of postings of each block with FeatureSkipBlocks: only the nodes with
+// more postings than this have a table of skip entries.
+const skipBlockSize = 128
+
+// With FeatureSubtreePostings, the nodes with edges and at most this depth
+// store the postings of their sub-trie: the root and the nodes of the prefixes
+// of 1 or 2 runes.
+const subtreePostingsDepth = 2
+
+// With FeatureSubtreePostings, also the nodes with more nodes than this in
+// their sub-trie store its postings.
+const subtreePostingsNodes = 1024
+
+// Postings of a sub-trie collected by trieNode.dumpRec, with
+// FeatureSubtreePostings only.
+type subtreeSummary struct {
+	postings    []int // Sorted and deduplicated postings.
+	frequencies []int // Occurrences for each of the postings.
+	numNodes    int   // Nodes of the sub-trie, including its root.
+}
+
+// Containers of the postings of a node with FeaturePostingContainers, each
+// node starts its postings with the one that encodes them in fewer bytes.
+const (
+	// Each posting is encoded as the increment from the previous one, as
+	// without FeaturePostingContainers.
+	postingsDeltas = iota
+
+	// The first posting, the size of a bitmap and the bitmap itself, where
+	// bit i (least significant first) tells if the first posting plus i is
+	// one of the postings.
+	postingsBitmap
+
+	// The size of the runs followed by, for each run of consecutive postings,
+	// the increment of its first posting from the last one of the previous
+	// run and the number of other postings of the run.
+	postingsRuns
+)
+
 // A TrieBuilder's node used internally by its implementation.
 type trieNode struct {
-	edges            map[rune]*trieNode
-	postings         []int
-	appendedPostings int
+	edges           map[rune]*trieNode
+	postings        []int         // Sorted and deduplicated postings.
+	frequencies     []int         // Occurrences for each of the postings.
+	pendingPostings []int         // Postings added with Add, not sorted yet.
+	positions       map[int][]int // Sorted positions for each posting.
+	occurrences     int           // Total occurrences of the term.
+	features        IndexFeatures // Features of the encoding (root only).
 }
 
 // It creates a TrieBuilder's node.
@@ -51,6 +118,17 @@ func newTrieNode() *trieNode {
 
 // It implements TrieBuilder.Add
 func (t *trieNode) Add(posting int, term string) {
+	t.add(posting, term)
+}
+
+// It implements TrieBuilder.AddAt
+func (t *trieNode) AddAt(posting int, term string, position int) {
+	node := t.add(posting, term)
+	node.addPositions(posting, []int{position})
+}
+
+// It adds one posting to the node of the given term, the node is returned.
+func (t *trieNode) add(posting int, term string) *trieNode {
 	node := t
 	if len(term) > 0 {
 		for _, rune_ := range term {
@@ -62,8 +140,35 @@ func (t *trieNode) Add(posting int, term string) {
 			node = childNode
 		}
 	}
-	node.postings = append(node.postings, posting)
-	node.appendedPostings += 1
+	node.pendingPostings = append(node.pendingPostings, posting)
+	node.occurrences += 1
+	return node
+}
+
+// It merges the given sorted positions with the ones already known for the
+// given posting.
+func (t *trieNode) addPositions(posting int, positions []int) {
+	if len(positions) == 0 {
+		return
+	} else if t.positions == nil {
+		t.positions = make(map[int][]int)
+	}
+	t.positions[posting] = UnitePostings(t.positions[posting], positions)
+}
+
+// It merges pending postings, added with method Add, with all the others.
+func (t *trieNode) consolidate() {
+	if len(t.pendingPostings) > 0 {
+		postings, frequencies := CountPostings(t.pendingPostings)
+		t.postings, t.frequencies = UnitePostingsWithFrequencies(
+			t.postings, t.frequencies, postings, frequencies)
+		t.pendingPostings = nil
+	}
+}
+
+// Implementation of TrieBuilder.Features
+func (t *trieNode) Features() IndexFeatures {
+	return t.features
 }
 
 // Implementation of TrieBuilder.AddBulk
@@ -93,7 +198,8 @@ func (t *trieNode) AddBulk(data IndexedTerms) {
 		// Walks to the target node starting from the last node sharing the
 		// same prefix with last one previous:
 		node := t
-		for i, rune_ := range indexedTerm.term {
+		i := 0
+		for _, rune_ := range indexedTerm.term {
 			j := i + 1
 			if j <= currPosition && runes[j] == rune_ {
 				node = nodes[j] // Prefix match
@@ -108,27 +214,62 @@ func (t *trieNode) AddBulk(data IndexedTerms) {
 				}
 				nodes[j] = node
 			}
+			i = j
+		}
+
+		frequencies := indexedTerm.frequencies
+		if frequencies == nil {
+			frequencies = make([]int, len(indexedTerm.postings))
+			for k := range frequencies {
+				frequencies[k] = 1
+			}
 		}
 
-		if len(t.postings) > 0 && node.appendedPostings > 0 {
-			node.postings = SortDedupPostings(node.postings)
-			node.appendedPostings = 0
+		node.consolidate()
+		node.postings, node.frequencies = UnitePostingsWithFrequencies(
+			node.postings, node.frequencies, indexedTerm.postings, frequencies)
+		node.occurrences += indexedTerm.occurrences
+
+		for k, positions := range indexedTerm.positions {
+			node.addPositions(indexedTerm.postings[k], positions)
 		}
-		node.postings = UnitePostings(node.postings, indexedTerm.postings)
 	}
 }
 
 // It implements TrieBuilder.Dump
-func (t *trieNode) Dump(dst io.Writer) error {
-	_, err := t.dumpRec(dst)
+func (t *trieNode) Dump(dst io.Writer) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("trieNode.Dump: %v", err)
+		}
+	}()
+
+	if t.features == 0 {
+		err = t.dumpTrie(dst)
+		return
+	}
+
+	trieBytes := new(bytes.Buffer)
+	err = t.dumpTrie(trieBytes)
 	if err != nil {
-		fmt.Errorf("trieNode.Dump: %v", err)
+		return
 	}
+	_, err = WriteIndex(dst, t.features, nil, trieBytes.Bytes())
+	return
+}
+
+// It encodes the trie alone, without any index header.
+func (t *trieNode) dumpTrie(dst io.Writer) error {
+	_, _, err := t.dumpRec(dst, t.features, 0)
 	return err
 }
 
-// It recursively encodes one TrieBuilder's node.
-func (t *trieNode) dumpRec(dst io.Writer) (sz int, err error) {
+// It recursively encodes one TrieBuilder's node, found at the given depth.
+//
+// With FeatureSubtreePostings it also returns the postings of its sub-trie.
+func (t *trieNode) dumpRec(dst io.Writer, features IndexFeatures, depth int) (
+	sz int, subtree subtreeSummary, err error) {
 
 	// Utility function to save one value to a buffer:
 	tmp := make([]byte, 16)
@@ -138,9 +279,9 @@ func (t *trieNode) dumpRec(dst io.Writer) (sz int, err error) {
 	}
 
 	// Consolidates collected postings:
-	if len(t.postings) > 0 && t.appendedPostings > 0 {
-		t.postings = SortDedupPostings(t.postings)
-		t.appendedPostings = 0
+	t.consolidate()
+	if features&FeatureSubtreePostings != 0 {
+		subtree = subtreeSummary{t.postings, t.frequencies, 1}
 	}
 
 	var sz_ int
@@ -159,11 +300,23 @@ func (t *trieNode) dumpRec(dst io.Writer) (sz int, err error) {
 	}
 	sz += sz_
 
+	// Dumps total number of occurrences:
+	if features&FeatureFrequencies != 0 {
+		sz_, err = writeInt(dst, t.occurrences)
+		if err != nil {
+			return
+		}
+		sz += sz_
+	}
+
 	// If any, dumps postings:
 	if len(t.postings) > 0 {
 		// Dumps the postings on a temporary buffer:
 		encodedPostings := new(bytes.Buffer)
-		_, err = t.dumpPostings(encodedPostings)
+		_, err = t.dumpPostings(encodedPostings, features)
+		if err != nil {
+			return
+		}
 
 		// Dumps size of serialized posting buffer:
 		sz_, err = writeInt(dst, encodedPostings.Len())
@@ -198,12 +351,35 @@ func (t *trieNode) dumpRec(dst io.Writer) (sz int, err error) {
 		previousRune := 0
 		for _, rune_ := range runes {
 
-			// Fetches and dumps the children node:
+			// With FeatureRadixEdges the edge continues with the runes of
+			// the nodes having no postings and a single edge:
 			childNode := t.edges[rune(rune_)]
-			sz_, err = childNode.dumpRec(childNodeBytes)
+			var suffix []rune
+			for features&FeatureRadixEdges != 0 {
+				childNode.consolidate()
+				if len(childNode.postings) > 0 || len(childNode.edges) != 1 {
+					break
+				}
+				for r, grandChildNode := range childNode.edges {
+					suffix = append(suffix, r)
+					childNode = grandChildNode
+				}
+			}
+
+			// Fetches and dumps the children node:
+			var childSubtree subtreeSummary
+			sz_, childSubtree, err = childNode.dumpRec(childNodeBytes,
+				features, depth+1+len(suffix))
 			if err != nil {
 				return
 			}
+			if features&FeatureSubtreePostings != 0 {
+				subtree.postings, subtree.frequencies =
+					UnitePostingsWithFrequencies(subtree.postings,
+						subtree.frequencies, childSubtree.postings,
+						childSubtree.frequencies)
+				subtree.numNodes += childSubtree.numNodes + len(suffix)
+			}
 
 			// Dumps edge's rune:
 			_, err = writeInt(edgeBytes, rune_-previousRune)
@@ -217,9 +393,35 @@ func (t *trieNode) dumpRec(dst io.Writer) (sz int, err error) {
 				return
 			}
 
+			// Dumps the other runes of the edge, in UTF-8:
+			if features&FeatureRadixEdges != 0 {
+				_, err = writeInt(edgeBytes, len(string(suffix)))
+				if err != nil {
+					return
+				}
+				_, err = edgeBytes.WriteString(string(suffix))
+				if err != nil {
+					return
+				}
+			}
+
 			previousRune = rune_
 		}
 
+		// Dumps the postings of the sub-trie, if they are worth it:
+		if features&FeatureSubtreePostings != 0 {
+			if len(subtree.postings) == 0 || (depth > subtreePostingsDepth &&
+				subtree.numNodes <= subtreePostingsNodes) {
+				sz_, err = writeInt(dst, 0)
+			} else {
+				sz_, err = subtree.dump(dst, features)
+			}
+			if err != nil {
+				return
+			}
+			sz += sz_
+		}
+
 		// Dumps size of serialized edges:
 		sz_, err = writeInt(dst, edgeBytes.Len())
 		if err != nil {
@@ -246,36 +448,235 @@ func (t *trieNode) dumpRec(dst io.Writer) (sz int, err error) {
 }
 
 // It encodes all the postings associated to one TrieBuilder's node.
-func (t *trieNode) dumpPostings(dst io.Writer) (sz int, err error) {
+func (t *trieNode) dumpPostings(dst io.Writer, features IndexFeatures) (
+	sz int, err error) {
+
+	// Consolidates collected postings:
+	t.consolidate()
 
 	if len(t.postings) == 0 {
 		return
 	}
 
-	// Consolidates collected postings:
-	if t.appendedPostings > 0 {
-		t.postings = SortDedupPostings(t.postings)
-		t.appendedPostings = 0
+	// Utility function to save one value to the writer:
+	var sz_ int
+	tmp := make([]byte, binary.MaxVarintLen64)
+	writeInt := func(value int) (err error) {
+		numBytes := binary.PutUvarint(tmp, uint64(value))
+		sz_, err = dst.Write(tmp[:numBytes])
+		sz += sz_
+		return
+	}
+
+	// With FeaturePostingContainers the postings can be encoded apart, before
+	// their frequencies and positions:
+	container := postingsDeltas
+	if features&FeaturePostingContainers != 0 {
+		var encoded []byte
+		container, encoded = encodePostingsContainer(t.postings)
+		err = writeInt(container)
+		if err != nil {
+			return
+		}
+		sz_, err = dst.Write(encoded)
+		sz += sz_
+		if err != nil {
+			return
+		}
+	}
+
+	// With FeatureSkipBlocks the postings are dumped to a temporary buffer,
+	// to be preceded by the table of skip entries:
+	var blocks *bytes.Buffer
+	var skips []int
+	if features&FeatureSkipBlocks != 0 && len(t.postings) > skipBlockSize &&
+		container == postingsDeltas {
+		blocks = new(bytes.Buffer)
+		defer func(dst io.Writer) {
+			if err == nil {
+				sz_, err = dumpSkips(dst, skips, blocks)
+				sz += sz_ - blocks.Len()
+			}
+		}(dst)
+		dst = blocks
 	}
 
 	// Dumps all the postings:
-	var sz_ int
 	previousPosting := 0
-	tmp := make([]byte, 16)
-	for _, posting := range t.postings {
+	for i, posting := range t.postings {
+
+		// Takes note of the beginning of each block but the first one:
+		if blocks != nil && i > 0 && i%skipBlockSize == 0 {
+			skips = append(skips, previousPosting, blocks.Len())
+		}
 
 		// Serializes the increment of current posting:
-		numBytes := binary.PutUvarint(tmp, uint64(posting-previousPosting))
+		if container == postingsDeltas {
+			err = writeInt(posting - previousPosting)
+			if err != nil {
+				return
+			}
+		}
 
-		// Dumps it to the target writer:
-		sz_, err = dst.Write(tmp[:numBytes])
+		// Serializes the frequency of the term on current posting:
+		if features&FeatureFrequencies != 0 {
+			err = writeInt(t.frequencies[i])
+			if err != nil {
+				return
+			}
+		}
+
+		// Serializes the positions of the term on current posting, each one
+		// as an increment from the previous one:
+		if features&FeaturePositions != 0 {
+			positions := t.positions[posting]
+			err = writeInt(len(positions))
+			if err != nil {
+				return
+			}
+
+			previousPosition := 0
+			for _, position := range positions {
+				err = writeInt(position - previousPosition)
+				if err != nil {
+					return
+				}
+				previousPosition = position
+			}
+		}
+
+		previousPosting = posting
+	}
+
+	return
+}
+
+// It dumps the table of skip entries followed by the blocks of postings.
+//
+// Each skip entry is given by the last posting before one block and by the
+// byte offset of the block from the first one, both as increments from the
+// previous entry. The table is preceded by its size in bytes.
+func dumpSkips(dst io.Writer, skips []int, blocks *bytes.Buffer) (sz int,
+	err error) {
+
+	table := new(bytes.Buffer)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	previous := []int{0, 0}
+	for i, value := range skips {
+		numBytes := binary.PutUvarint(tmp, uint64(value-previous[i%2]))
+		table.Write(tmp[:numBytes])
+		previous[i%2] = value
+	}
+
+	numBytes := binary.PutUvarint(tmp, uint64(table.Len()))
+	var sz_ int
+	for _, chunk := range [][]byte{tmp[:numBytes], table.Bytes(),
+		blocks.Bytes()} {
+		sz_, err = dst.Write(chunk)
+		sz += sz_
 		if err != nil {
 			return
 		}
+	}
+	return
+}
+
+// It encodes the postings of a sub-trie: their number, the size of the
+// encoded postings and, for each posting, the increment from the previous one
+// followed by its frequency with FeatureFrequencies.
+func (s subtreeSummary) dump(dst io.Writer, features IndexFeatures) (sz int,
+	err error) {
+
+	buf := new(bytes.Buffer)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	writeInt := func(dst *bytes.Buffer, value int) {
+		numBytes := binary.PutUvarint(tmp, uint64(value))
+		dst.Write(tmp[:numBytes])
+	}
+
+	previousPosting := 0
+	for i, posting := range s.postings {
+		writeInt(buf, posting-previousPosting)
+		if features&FeatureFrequencies != 0 {
+			writeInt(buf, s.frequencies[i])
+		}
+		previousPosting = posting
+	}
+
+	header := new(bytes.Buffer)
+	writeInt(header, len(s.postings))
+	writeInt(header, buf.Len())
+
+	var sz_ int
+	for _, chunk := range [][]byte{header.Bytes(), buf.Bytes()} {
+		sz_, err = dst.Write(chunk)
 		sz += sz_
+		if err != nil {
+			return
+		}
+	}
+	return
+}
 
+// It chooses the container encoding the given postings in fewer bytes (see
+// postingsDeltas), preferring increments on ties.
+//
+// It returns:
+// - the chosen container.
+// - the encoded postings, nil with postingsDeltas as they are encoded
+//   together with their frequencies and positions.
+func encodePostingsContainer(postings []int) (container int, encoded []byte) {
+
+	tmp := make([]byte, binary.MaxVarintLen64)
+	sizeOf := func(value int) int {
+		return binary.PutUvarint(tmp, uint64(value))
+	}
+	withSize := func(prefix []byte, content []byte) []byte {
+		numBytes := binary.PutUvarint(tmp, uint64(len(content)))
+		prefix = append(prefix, tmp[:numBytes]...)
+		return append(prefix, content...)
+	}
+
+	// Size of the increments, and of the runs as they are:
+	var runs []byte
+	deltasSize := 0
+	previousPosting := 0
+	runStart := -1
+	for i, posting := range postings {
+		deltasSize += sizeOf(posting - previousPosting)
+		if i == 0 || posting != previousPosting+1 {
+			if runStart >= 0 {
+				numBytes := binary.PutUvarint(tmp, uint64(i-1-runStart))
+				runs = append(runs, tmp[:numBytes]...)
+			}
+			numBytes := binary.PutUvarint(tmp, uint64(posting-previousPosting))
+			runs = append(runs, tmp[:numBytes]...)
+			runStart = i
+		}
 		previousPosting = posting
 	}
+	numBytes := binary.PutUvarint(tmp, uint64(len(postings)-1-runStart))
+	runs = append(runs, tmp[:numBytes]...)
+
+	bestSize := deltasSize
+	if size := sizeOf(len(runs)) + len(runs); size < bestSize {
+		bestSize = size
+		container = postingsRuns
+		encoded = withSize(nil, runs)
+	}
+
+	// The bitmap is built only if it is smaller:
+	first := postings[0]
+	bitmapLen := (postings[len(postings)-1]-first)/8 + 1
+	if sizeOf(first)+sizeOf(bitmapLen)+bitmapLen < bestSize {
+		bitmap := make([]byte, bitmapLen)
+		for _, posting := range postings {
+			bitmap[(posting-first)/8] |= 1 << ((posting - first) % 8)
+		}
+		numBytes = binary.PutUvarint(tmp, uint64(first))
+		container = postingsBitmap
+		encoded = withSize(append([]byte{}, tmp[:numBytes]...), bitmap)
+	}
 
 	return
 }
@@ -286,3 +687,20 @@ func (t *trieNode) dumpPostings(dst io.Writer) (sz int, err error) {
 func NewTrieBuilder() TrieBuilder {
 	return newTrieNode()
 }
+
+// Creates a new TrieBuilder that generates a trie with the given optional
+// features.
+//
+// Only the features in TrieFeatures are about the encoding of the trie, the
+// other ones are ignored. The generated trie is wrapped by an index header
+// with the features (see TrieBuilder.Dump).
+func NewTrieBuilderWithFeatures(features IndexFeatures) TrieBuilder {
+	return newTrieBuilderWithFeatures(features)
+}
+
+// It implements NewTrieBuilderWithFeatures.
+func newTrieBuilderWithFeatures(features IndexFeatures) *trieNode {
+	t := newTrieNode()
+	t.features = features & TrieFeatures
+	return t
+}
@@ -2,6 +2,10 @@ package smartsearch
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -79,3 +83,418 @@ func TestTrieBuilder_Term(t *testing.T) {
 		t.Errorf("Unexpected serialization: %v,%d", buf.Bytes(), buf.Len())
 	}
 }
+
+func TestTrieBuilder_Frequencies(t *testing.T) {
+
+	builder := NewTrieBuilderWithFeatures(FeatureFrequencies | FeatureChecksum)
+	if builder.Features() != FeatureFrequencies {
+		t.Errorf("Unexpected features: %v", builder.Features())
+	}
+	builder.Add(1, "A")
+	builder.Add(2, "A")
+	builder.Add(1, "A")
+	builder.AddBulk(IndexedTerms{
+		{"A", []int{2, 3}, []int{2, 1}, nil, 3},
+		{"AB", []int{4}, []int{5}, nil, 5}})
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Errorf("Error while dumping: %v", err)
+	}
+
+	reader, _, err := NewTrieReader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie reader: %v", err)
+	} else if err = reader.Trie().Verify(); err != nil {
+		t.Errorf("Invalid trie: %v", err)
+	}
+
+	node, err := reader.Match("A")
+	if err != nil || node.NumPostings != 3 || node.Occurrences != 6 {
+		t.Errorf("Unexpected node: %+v, err=%v", node, err)
+	}
+
+	postings, frequencies, err := reader.ReadAllPostingsWithFrequencies()
+	if err != nil {
+		t.Errorf("Cannot read postings: %v", err)
+	} else if !reflect.DeepEqual(postings, []int{1, 2, 3}) ||
+		!reflect.DeepEqual(frequencies, []int{2, 3, 1}) {
+		t.Errorf("Unexpected postings: %v %v", postings, frequencies)
+	}
+
+	node, err = reader.Match("B")
+	if err != nil || node.NumPostings != 1 || node.Occurrences != 5 {
+		t.Errorf("Unexpected node: %+v, err=%v", node, err)
+	}
+
+	posting, frequency, err := reader.ReadPostingWithFrequency()
+	if err != nil || posting != 4 || frequency != 5 {
+		t.Errorf("Unexpected posting: %v %v, err=%v", posting, frequency, err)
+	}
+}
+
+func TestTrieBuilder_Positions(t *testing.T) {
+
+	builder := NewTrieBuilderWithFeatures(FeatureFrequencies |
+		FeaturePositions)
+	builder.AddAt(1, "A", 7)
+	builder.AddAt(1, "A", 2)
+	builder.AddAt(2, "A", 0)
+	builder.Add(3, "A")
+	builder.AddBulk(IndexedTerms{
+		{"A", []int{2, 4}, []int{1, 2}, [][]int{{5}, {1, 300}}, 3}})
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Errorf("Error while dumping: %v", err)
+	}
+
+	reader, _, err := NewTrieReader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie reader: %v", err)
+	} else if err = reader.Trie().Verify(); err != nil {
+		t.Errorf("Invalid trie: %v", err)
+	}
+
+	reader.Match("A")
+	postings, positions, err := reader.ReadAllPostingsWithPositions()
+	if err != nil {
+		t.Errorf("Cannot read postings: %v", err)
+	} else if !reflect.DeepEqual(postings, []int{1, 2, 3, 4}) ||
+		!reflect.DeepEqual(positions, [][]int{{2, 7}, {0, 5}, nil, {1, 300}}) {
+		t.Errorf("Unexpected postings: %v %v", postings, positions)
+	}
+
+	// Without the feature positions are not encoded:
+	builder = NewTrieBuilder()
+	builder.AddAt(1, "A", 7)
+	buf.Reset()
+	builder.Dump(buf)
+	reader, _, _ = NewTrieReader(buf.Bytes())
+	reader.Match("A")
+	postings, positions, err = reader.ReadAllPostingsWithPositions()
+	if err != nil || !reflect.DeepEqual(postings, []int{1}) ||
+		positions[0] != nil {
+		t.Errorf("Unexpected postings: %v %v, err=%v", postings, positions,
+			err)
+	}
+}
+
+func TestTrieBuilder_AddBulkMultiByte(t *testing.T) {
+
+	builder := NewTrieBuilder()
+	builder.AddBulk(IndexedTerms{
+		{"αβγ", []int{1}, nil, nil, 1},
+		{"αβδ", []int{2}, nil, nil, 1},
+		{"αδ", []int{3}, nil, nil, 1}})
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Errorf("Error while dumping: %v", err)
+	}
+
+	reader, _, err := NewTrieReader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie reader: %v", err)
+	}
+	for i, term := range []string{"αβγ", "αβδ", "αδ"} {
+		reader.Reset()
+		reader.Match(term)
+		postings, err := reader.ReadAllPostings()
+		if err != nil || !reflect.DeepEqual(postings, []int{i + 1}) {
+			t.Errorf("Unexpected postings for '%v': %v, err=%v", term,
+				postings, err)
+		}
+	}
+}
+
+func TestTrieBuilder_SkipBlocks(t *testing.T) {
+
+	features := FeatureFrequencies | FeaturePositions | FeatureSkipBlocks
+	builder := NewTrieBuilderWithFeatures(features)
+	var expected []int
+	for posting := 1; posting <= 1000; posting++ {
+		builder.AddAt(posting*posting, "A", posting%7)
+		expected = append(expected, posting*posting)
+		if posting%100 == 0 {
+			builder.Add(posting, "B")
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Errorf("Error while dumping: %v", err)
+	}
+
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	} else if err = trie.Verify(); err != nil {
+		t.Errorf("Invalid trie: %v", err)
+	}
+
+	// Postings are read as usual:
+	cursor, _ := trie.Root()
+	node, _ := cursor.Match("A")
+	postings, err := cursor.ReadAllPostings()
+	if err != nil || !reflect.DeepEqual(postings, expected) {
+		t.Errorf("Unexpected postings: %v, err=%v", postings, err)
+	}
+	cursor.JumpNode(node)
+	_, positions, _ := cursor.ReadAllPostingsWithPositions()
+	if len(positions) != 1000 {
+		t.Errorf("Unexpected postings: %v", positions)
+	}
+
+	// Skipping postings, also within the same block:
+	cursor.JumpNode(node)
+	for _, target := range []int{0, 5, 4096, 4097, 4300, 250000, 250001,
+		998002} {
+		i := sort.SearchInts(expected, target)
+		posting, err := cursor.SkipTo(target)
+		if err != nil || posting != expected[i] {
+			t.Errorf("Unexpected posting skipping to %v: %v, err=%v", target,
+				posting, err)
+		}
+	}
+	_, err = cursor.SkipTo(1000001)
+	if err != io.EOF {
+		t.Errorf("io.EOF was expected: %v", err)
+	}
+
+	// The trie is still traversed as usual:
+	cursor.Reset()
+	other, err := cursor.Match("B")
+	if err != nil || other.NumPostings != 10 {
+		t.Errorf("Unexpected node: %v, err=%v", other, err)
+	}
+
+	// The skip entries are verified:
+	cursor.JumpNode(node)
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[cursor.skipsOffset]++ // Posting of the first skip entry.
+	trie.source = newTrieSourceFromBytes(corrupted)
+	var corruptedErr CorruptedTrieError
+	if err = trie.Verify(); !errors.As(err, &corruptedErr) {
+		t.Errorf("Corruption not detected: %v", err)
+	}
+}
+
+func TestTrieBuilder_PostingContainers(t *testing.T) {
+
+	terms := []string{"dense", "even", "sparse"}
+	expected := make([][]int, len(terms))
+	for posting := 1; posting <= 3000; posting++ {
+		if posting <= 1000 || posting > 2000 {
+			expected[0] = append(expected[0], posting)
+		}
+		if posting%2 == 0 {
+			expected[1] = append(expected[1], posting)
+		}
+		if posting%1000 == 0 {
+			expected[2] = append(expected[2], posting)
+		}
+	}
+	expectedContainers := []int{postingsRuns, postingsBitmap, postingsDeltas}
+
+	for _, features := range []IndexFeatures{
+		FeaturePostingContainers,
+		FeaturePostingContainers | FeatureFrequencies | FeaturePositions |
+			FeatureSkipBlocks} {
+
+		sizes := make([]int, 2)
+		var trie *Trie
+		for i, features := range []IndexFeatures{
+			features &^ FeaturePostingContainers, features} {
+
+			builder := NewTrieBuilderWithFeatures(features)
+			for j, term := range terms {
+				for _, posting := range expected[j] {
+					builder.AddAt(posting, term, posting%5)
+				}
+			}
+			buf := new(bytes.Buffer)
+			err := builder.Dump(buf)
+			if err != nil {
+				t.Errorf("Error while dumping: %v", err)
+			}
+			sizes[i] = buf.Len()
+
+			trie, err = NewTrie(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Cannot create trie: %v", err)
+			} else if err = trie.Verify(); err != nil {
+				t.Errorf("Invalid trie with features %v: %v", features, err)
+			}
+		}
+		if sizes[1] >= sizes[0] {
+			t.Errorf("Containers do not save space with features %v: %v",
+				features, sizes)
+		}
+
+		cursor, _ := trie.Root()
+		for j, term := range terms {
+			cursor.Reset()
+			node, _ := cursor.Match(term)
+			if cursor.container != expectedContainers[j] {
+				t.Errorf("Unexpected container for %v: %v", term,
+					cursor.container)
+			}
+			postings, positions, err := cursor.ReadAllPostingsWithPositions()
+			if err != nil || !reflect.DeepEqual(postings, expected[j]) {
+				t.Errorf("Unexpected postings for %v: %v, err=%v", term,
+					postings, err)
+			} else if features&FeaturePositions != 0 &&
+				!reflect.DeepEqual(positions[1], []int{postings[1] % 5}) {
+				t.Errorf("Unexpected positions for %v: %v", term, positions[1])
+			}
+
+			// Skipping postings:
+			cursor.JumpNode(node)
+			posting, err := cursor.SkipTo(1501)
+			i := sort.SearchInts(expected[j], 1501)
+			if err != nil || posting != expected[j][i] {
+				t.Errorf("Unexpected posting for %v: %v, err=%v", term, posting,
+					err)
+			}
+
+			// Intersecting iterators:
+			iterator, _ := cursor.PostingIterator(node)
+			iterator = IntersectPostingIterators(iterator,
+				NewSlicePostingIterator(expected[1]))
+			postings, err = ReadPostingIterator(iterator, -1)
+			intersection := IntersectPostings(expected[j], expected[1])
+			if err != nil || !reflect.DeepEqual(postings, intersection) {
+				t.Errorf("Unexpected intersection for %v: %v, err=%v", term,
+					postings, err)
+			}
+		}
+
+		// The containers are verified, here the length of the first run:
+		cursor.Reset()
+		cursor.Match("dense")
+		corrupted, _ := trie.source.ReadRange(0, trie.source.size)
+		corrupted = append([]byte{}, corrupted...)
+		corrupted[cursor.containerOffset+1]++
+		trie.source = newTrieSourceFromBytes(corrupted)
+		var corruptedErr CorruptedTrieError
+		if err := trie.Verify(); !errors.As(err, &corruptedErr) {
+			t.Errorf("Corruption not detected: %v", err)
+		}
+	}
+}
+
+func TestTrieBuilder_SubtreePostings(t *testing.T) {
+
+	words := []string{"alpha", "alpine", "alps", "beta", "betamax", "bet",
+		"gamma", "a", "al"}
+	prefixes := []string{"", "a", "al", "alp", "alph", "b", "bet", "betam",
+		"g", "x"}
+
+	tries := make([]*Trie, 3)
+	for i, features := range []IndexFeatures{FeatureFrequencies,
+		FeatureFrequencies | FeatureSubtreePostings,
+		FeatureFrequencies | FeatureSubtreePostings | FeatureRadixEdges} {
+
+		builder := NewTrieBuilderWithFeatures(features)
+		for posting := 1; posting <= 50; posting++ {
+			for j, word := range words {
+				if posting%(j+2) == 0 {
+					builder.Add(posting, word)
+				}
+			}
+		}
+		buf := new(bytes.Buffer)
+		builder.Dump(buf)
+
+		var err error
+		tries[i], err = NewTrie(buf.Bytes())
+		if err != nil {
+			t.Fatalf("Cannot create trie: %v", err)
+		} else if err = tries[i].Verify(); err != nil {
+			t.Errorf("Invalid trie with features %v: %v", features, err)
+		}
+	}
+
+	// Postings are precomputed only up to 2 runes and for real nodes:
+	precomputed := []map[string]bool{
+		{},
+		{"": true, "a": true, "al": true, "b": true, "g": true},
+		{"": true, "a": true, "al": true}}
+
+	for _, prefix := range prefixes {
+		var expected []int
+		var expectedFrequencies []int
+		for i, trie := range tries {
+			cursor, node := trie.Root()
+			if prefix != "" {
+				node, _ = cursor.Match(prefix)
+			}
+
+			subtree, err := cursor.subtreePostings()
+			if err != nil || (subtree != nil) != precomputed[i][prefix] {
+				t.Errorf("Unexpected sub-trie postings for '%v' in trie %v: "+
+					"%v, err=%v", prefix, i, subtree, err)
+			}
+
+			postings, err := cursor.ReadAllPostingsRecursive()
+			if err != nil && err != io.EOF {
+				t.Errorf("Cannot read postings: %v", err)
+			}
+			cursor.JumpNode(node)
+			postings_, frequencies, _ :=
+				cursor.ReadAllPostingsRecursiveWithFrequencies()
+			iterator, _ := cursor.PrefixPostingIterator(node)
+			var postings__ []int
+			if iterator != nil {
+				postings__, _ = ReadPostingIterator(iterator, -1)
+			}
+			if i == 0 {
+				expected, expectedFrequencies = postings, frequencies
+			}
+			if !reflect.DeepEqual(postings, expected) ||
+				!reflect.DeepEqual(postings_, expected) ||
+				!reflect.DeepEqual(frequencies, expectedFrequencies) ||
+				!reflect.DeepEqual(postings__, expected) {
+				t.Errorf("Unexpected postings for '%v' in trie %v: %v %v %v %v",
+					prefix, i, postings, postings_, frequencies, postings__)
+			}
+		}
+	}
+}
+
+func TestTrieBuilder_DumpWithFeatures(t *testing.T) {
+
+	features := FeatureFrequencies | FeatureRadixEdges | FeatureSkipBlocks
+	builder := NewTrieBuilderWithFeatures(features)
+	builder.Add(1, "golden")
+	builder.Add(2, "gate")
+	buf := new(bytes.Buffer)
+	err := builder.Dump(buf)
+	if err != nil {
+		t.Fatalf("Error while dumping: %v", err)
+	}
+
+	// The trie is wrapped by an index header with its features:
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	} else if trie.Header().Features != features {
+		t.Errorf("Unexpected features: 0x%x", uint(trie.Header().Features))
+	}
+
+	cursor, _ := trie.Root()
+	node, err := cursor.Match("golden")
+	if err != nil || node.NumPostings != 1 {
+		t.Errorf("Unexpected node: %+v %v", node, err)
+	}
+	cursor, _ = trie.Root()
+	postings, err := cursor.ReadAllPostingsRecursive()
+	if err != nil || !reflect.DeepEqual(postings, []int{1, 2}) {
+		t.Errorf("Unexpected postings: %v %v", postings, err)
+	}
+}
@@ -0,0 +1,105 @@
+package smartsearch
+
+import (
+	"io"
+)
+
+// Number of bytes fetched at once by a trieSource reading from an io.ReaderAt.
+const trieSourcePageSize = 256
+
+// A cursor to read bytes from an encoded trie, used internally by Cursor.
+//
+// Bytes can come either from memory or from an io.ReaderAt. In the latter case
+// only the small ranges of bytes touched while decoding are fetched, so that a
+// huge trie stored on a file can be used without loading it.
+//
+// It is a plain value without pointers to shared mutable state, so it can be
+// copied together with the Cursor that contains it.
+type trieSource struct {
+	bytes     []byte      // All the bytes of the trie, when in memory.
+	src       io.ReaderAt // Source of the bytes when not in memory.
+	size      int         // Total number of bytes.
+	offset    int         // Offset of the next byte to be read.
+	pageStart int         // Offset of the first byte cached in page.
+	pageLen   int         // Number of bytes cached in page.
+	page      [trieSourcePageSize]byte
+}
+
+// It creates a trieSource reading from memory.
+func newTrieSourceFromBytes(bytes_ []byte) trieSource {
+	return trieSource{bytes: bytes_, size: len(bytes_)}
+}
+
+// It creates a trieSource reading from an io.ReaderAt.
+func newTrieSourceFromReaderAt(src io.ReaderAt, size int) trieSource {
+	return trieSource{src: src, size: size}
+}
+
+// It returns the number of bytes left to be read.
+func (s *trieSource) Len() int {
+	return s.size - s.offset
+}
+
+// Implementation of io.ByteReader.
+func (s *trieSource) ReadByte() (b byte, err error) {
+
+	if s.offset >= s.size {
+		err = io.EOF
+		return
+	}
+
+	if s.bytes != nil {
+		b = s.bytes[s.offset]
+		s.offset++
+		return
+	}
+
+	// Fetches a new page if needed:
+	if s.offset < s.pageStart || s.offset >= s.pageStart+s.pageLen {
+		var n int
+		n, err = s.src.ReadAt(s.page[:], int64(s.offset))
+		if n > 0 && err == io.EOF {
+			err = nil
+		} else if n == 0 && err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			s.pageLen = 0
+			return
+		}
+		s.pageStart = s.offset
+		s.pageLen = n
+	}
+
+	b = s.page[s.offset-s.pageStart]
+	s.offset++
+	return
+}
+
+// It reads size bytes starting from the given offset, without changing the
+// offset of the next byte to be read.
+//
+// It returns:
+// - the read bytes, shared with the source when it is in memory.
+// - an error in case of failure.
+func (s *trieSource) ReadRange(offset int, size int) (bytes_ []byte,
+	err error) {
+
+	if offset < 0 || size < 0 || offset+size > s.size {
+		err = OutOfBounds
+		return
+	}
+
+	if s.bytes != nil {
+		bytes_ = s.bytes[offset : offset+size]
+		return
+	}
+
+	bytes_ = make([]byte, size)
+	var n int
+	n, err = s.src.ReadAt(bytes_, int64(offset))
+	if n == size && err == io.EOF {
+		err = nil
+	}
+	return
+}
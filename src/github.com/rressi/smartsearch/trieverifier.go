@@ -0,0 +1,577 @@
+package smartsearch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This error is returned by Trie.Verify when an inconsistency is found
+// in the encoded trie.
+type CorruptedTrieError struct {
+	Offset int    // Byte offset where the inconsistency has been found.
+	Reason string // Human readable description of the problem.
+}
+
+// Implementation of error.
+func (e CorruptedTrieError) Error() string {
+	return fmt.Sprintf("Corrupted trie at offset %d: %v", e.Offset, e.Reason)
+}
+
+// It checks the whole trie for consistency.
+//
+// It verifies the checksum of the index (if any), decodes its sections and
+// then walks every node, edge and posting checking that:
+// - all the sizes and offsets are within the bounds of their container.
+// - the edges of each node are sorted by strictly increasing UNICODE code
+//   point.
+// - the postings of each node are strictly increasing.
+// - frequencies, if any, are consistent with the occurrences of their node.
+// - positions, if any, are strictly increasing and consistent with the
+//   frequencies.
+// - there are no trailing bytes after the trie.
+//
+// It is meant to be used when accepting an index from an untrusted source,
+// before using it for search.
+//
+// It returns:
+// - a CorruptedTrieError or ChecksumMismatch if the trie is not valid.
+func (t *Trie) Verify() (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Trie.Verify: %w", err)
+		}
+	}()
+
+	size := t.source.size
+	if t.source.bytes != nil {
+		err = t.header.VerifyChecksum(t.source.bytes)
+	} else {
+		err = t.header.VerifyChecksumAt(t.source.src, int64(size))
+	}
+	if err != nil {
+		return
+	}
+
+	_, err = t.ReadDocumentLengths()
+	if err != nil {
+		return
+	}
+
+	_, err = t.ReadAnalyzerConfig()
+	if err != nil {
+		return
+	}
+
+	v := trieVerifier{source: t.source, features: t.header.Features}
+	var end int
+	end, err = v.verifyNode(t.rootOffset, size)
+	if err == nil && end != size {
+		err = CorruptedTrieError{end, "trailing bytes after the trie"}
+	}
+
+	return
+}
+
+// Used to implement Trie.Verify, it decodes from its own copy of the
+// source.
+type trieVerifier struct {
+	source   trieSource
+	features IndexFeatures
+}
+
+// It decodes one integer in Uvarint format found at the given offset without
+// going beyond the passed limit.
+//
+// It returns:
+// - the decoded value.
+// - the offset of the next byte.
+// - an error in case of failure.
+func (v *trieVerifier) readInt(offset int, limit int, what string) (
+	value int, next int, err error) {
+
+	if offset >= limit {
+		err = CorruptedTrieError{offset, "missing " + what}
+		return
+	}
+
+	v.source.offset = offset
+	value_, err_ := binary.ReadUvarint(&v.source)
+	if err_ != nil || v.source.offset > limit || value_ > math.MaxInt64>>1 {
+		err = CorruptedTrieError{offset, "invalid " + what}
+		return
+	}
+
+	value = int(value_)
+	next = v.source.offset
+	return
+}
+
+// It verifies the positions of one posting, that cannot be more than the
+// frequency of the posting if it is known (not negative).
+//
+// It returns:
+// - the offset of the first byte after the positions.
+// - an error in case of failure.
+func (v *trieVerifier) verifyPositions(offset int, limit int,
+	frequency int) (end int, err error) {
+
+	var numPositions int
+	numPositions, offset, err = v.readInt(offset, limit, "number of positions")
+	if err != nil {
+		return
+	}
+	if frequency >= 0 && numPositions > frequency {
+		err = CorruptedTrieError{offset, "positions above frequency"}
+		return
+	}
+
+	for i := 0; i < numPositions; i++ {
+		var increment int
+		increment, offset, err = v.readInt(offset, limit, "position")
+		if err != nil {
+			return
+		}
+		if i > 0 && increment == 0 {
+			err = CorruptedTrieError{offset, "positions not increasing"}
+			return
+		}
+	}
+
+	end = offset
+	return
+}
+
+// It decodes the table of skip entries of the postings of one node (see
+// FeatureSkipBlocks).
+//
+// It returns:
+// - the last posting before each block and the offset of the block from the
+//   first one, for each entry.
+// - the offset of the first byte after the table.
+// - an error in case of failure.
+func (v *trieVerifier) readSkips(offset int, limit int, numSkips int) (
+	skips []int, end int, err error) {
+
+	var size int
+	size, offset, err = v.readInt(offset, limit, "size of skip entries")
+	if err != nil {
+		return
+	}
+	skipsEnd := offset + size
+	if skipsEnd > limit || numSkips > size/2 {
+		err = CorruptedTrieError{offset, "skip entries out of bounds"}
+		return
+	}
+
+	skips_ := make([]int, 2*numSkips)
+	for i := range skips_ {
+		var increment int
+		increment, offset, err = v.readInt(offset, skipsEnd, "skip entry")
+		if err != nil {
+			return
+		}
+		if i >= 2 {
+			increment += skips_[i-2]
+		}
+		skips_[i] = increment
+	}
+	if offset != skipsEnd {
+		err = CorruptedTrieError{offset, "unexpected size of skip entries"}
+		return
+	}
+
+	skips, end = skips_, offset
+	return
+}
+
+// It verifies the postings of the sub-trie of one node (see
+// FeatureSubtreePostings).
+//
+// It returns:
+// - the offset of the first byte after them.
+// - an error in case of failure.
+func (v *trieVerifier) verifySubtreePostings(offset int, limit int) (
+	end int, err error) {
+
+	var numPostings int
+	numPostings, offset, err = v.readInt(offset, limit,
+		"number of sub-trie postings")
+	if err != nil || numPostings == 0 {
+		end = offset
+		return
+	}
+
+	var size int
+	size, offset, err = v.readInt(offset, limit, "size of sub-trie postings")
+	if err != nil {
+		return
+	}
+	postingsEnd := offset + size
+	if postingsEnd > limit || numPostings > size {
+		err = CorruptedTrieError{offset, "sub-trie postings out of bounds"}
+		return
+	}
+
+	for i := 0; i < numPostings; i++ {
+		var increment int
+		increment, offset, err = v.readInt(offset, postingsEnd,
+			"sub-trie posting")
+		if err != nil {
+			return
+		}
+		if i > 0 && increment == 0 {
+			err = CorruptedTrieError{offset,
+				"sub-trie postings not increasing"}
+			return
+		}
+		if v.features&FeatureFrequencies != 0 {
+			var frequency int
+			frequency, offset, err = v.readInt(offset, postingsEnd,
+				"sub-trie frequency")
+			if err != nil {
+				return
+			}
+			if frequency == 0 {
+				err = CorruptedTrieError{offset, "invalid sub-trie frequency"}
+				return
+			}
+		}
+	}
+	if offset != postingsEnd {
+		err = CorruptedTrieError{offset,
+			"unexpected size of sub-trie postings"}
+		return
+	}
+
+	end = offset
+	return
+}
+
+// It verifies the suffix of one edge (see FeatureRadixEdges), that must be
+// valid UTF-8 without reserved runes.
+//
+// It returns:
+// - the offset of the first byte after the suffix.
+// - an error in case of failure.
+func (v *trieVerifier) verifySuffix(offset int, limit int) (end int,
+	err error) {
+
+	var size int
+	size, offset, err = v.readInt(offset, limit, "size of edge suffix")
+	if err != nil {
+		return
+	}
+	if size > limit-offset {
+		err = CorruptedTrieError{offset, "edge suffix out of bounds"}
+		return
+	}
+
+	var suffix []byte
+	suffix, err = v.source.ReadRange(offset, size)
+	if err != nil {
+		return
+	}
+	if !utf8.Valid(suffix) ||
+		strings.IndexFunc(string(suffix), isFieldRune) >= 0 {
+		err = CorruptedTrieError{offset, "invalid edge suffix"}
+		return
+	}
+
+	end = offset + size
+	return
+}
+
+// It decodes the container of the postings of one node (see
+// FeaturePostingContainers), that must contain exactly numPostings postings.
+//
+// It returns:
+// - the container of the postings.
+// - the decoded postings, nil if they are encoded as increments together with
+//   their frequencies and positions.
+// - the offset of the first byte after the container.
+// - an error in case of failure.
+func (v *trieVerifier) readContainer(offset int, limit int, numPostings int) (
+	container int, postings []int, end int, err error) {
+
+	container, offset, err = v.readInt(offset, limit, "container")
+	if err != nil {
+		return
+	}
+
+	var first int
+	switch container {
+	case postingsDeltas:
+		end = offset
+		return
+	case postingsBitmap:
+		first, offset, err = v.readInt(offset, limit, "first posting")
+		if err != nil {
+			return
+		}
+	case postingsRuns:
+	default:
+		err = CorruptedTrieError{offset, "unknown container"}
+		return
+	}
+
+	var size int
+	size, offset, err = v.readInt(offset, limit, "size of container")
+	if err != nil {
+		return
+	}
+	containerEnd := offset + size
+	if containerEnd > limit {
+		err = CorruptedTrieError{offset, "container out of bounds"}
+		return
+	}
+
+	tooMany := CorruptedTrieError{offset, "too many postings in container"}
+	postings_ := make([]int, 0, numPostings)
+	if container == postingsBitmap {
+		var bytes_ []byte
+		bytes_, err = v.source.ReadRange(offset, size)
+		if err != nil {
+			return
+		}
+		for i, byte_ := range bytes_ {
+			for ; byte_ != 0; byte_ &= byte_ - 1 {
+				if len(postings_) == numPostings {
+					err = tooMany
+					return
+				}
+				postings_ = append(postings_,
+					first+8*i+bits.TrailingZeros8(byte_))
+			}
+		}
+		offset = containerEnd
+	} else {
+		posting := 0
+		for offset < containerEnd {
+			var increment, length int
+			increment, offset, err = v.readInt(offset, containerEnd,
+				"increment of run")
+			if err == nil {
+				length, offset, err = v.readInt(offset, containerEnd,
+					"length of run")
+			}
+			if err != nil {
+				return
+			}
+			if len(postings_) > 0 && increment == 0 {
+				err = CorruptedTrieError{offset, "postings not increasing"}
+				return
+			} else if length >= numPostings-len(postings_) {
+				err = tooMany
+				return
+			}
+			posting += increment
+			for j := 0; j <= length; j++ {
+				postings_ = append(postings_, posting+j)
+			}
+			posting += length
+		}
+	}
+
+	if len(postings_) != numPostings {
+		err = CorruptedTrieError{offset, "too few postings in container"}
+		return
+	}
+
+	postings, end = postings_, offset
+	return
+}
+
+// It verifies one node and, recursively, all its sub-nodes.
+//
+// It returns:
+// - the offset of the first byte after the node.
+// - an error in case of failure.
+func (v *trieVerifier) verifyNode(offset int, limit int) (end int,
+	err error) {
+
+	var numPostings, numEdges int
+	numPostings, offset, err = v.readInt(offset, limit, "number of postings")
+	if err != nil {
+		return
+	}
+	numEdges, offset, err = v.readInt(offset, limit, "number of edges")
+	if err != nil {
+		return
+	}
+	var occurrences int
+	if v.features&FeatureFrequencies != 0 {
+		occurrences, offset, err = v.readInt(offset, limit, "occurrences")
+		if err != nil {
+			return
+		}
+	}
+
+	// Verifies the postings:
+	if numPostings > 0 {
+		var size int
+		size, offset, err = v.readInt(offset, limit, "size of postings")
+		if err != nil {
+			return
+		}
+		postingsEnd := offset + size
+		if postingsEnd > limit {
+			err = CorruptedTrieError{offset, "postings out of bounds"}
+			return
+		}
+
+		// Postings in a bitmap or in runs are decoded upfront:
+		var postings []int
+		container := postingsDeltas
+		if v.features&FeaturePostingContainers != 0 {
+			container, postings, offset, err = v.readContainer(offset,
+				postingsEnd, numPostings)
+			if err != nil {
+				return
+			}
+		}
+
+		var skips []int
+		if v.features&FeatureSkipBlocks != 0 && numPostings > skipBlockSize &&
+			container == postingsDeltas {
+			skips, offset, err = v.readSkips(offset, postingsEnd,
+				(numPostings-1)/skipBlockSize)
+			if err != nil {
+				return
+			}
+		}
+		blocksOffset := offset
+
+		posting := 0
+		for i := 0; i < numPostings; i++ {
+
+			// Each skip entry must match the block it refers to:
+			if skips != nil && i > 0 && i%skipBlockSize == 0 {
+				j := 2 * (i/skipBlockSize - 1)
+				if skips[j] != posting || skips[j+1] != offset-blocksOffset {
+					err = CorruptedTrieError{offset, "invalid skip entry"}
+					return
+				}
+			}
+
+			if postings != nil {
+				posting = postings[i]
+			} else {
+				var increment int
+				increment, offset, err = v.readInt(offset, postingsEnd,
+					"posting")
+				if err != nil {
+					return
+				}
+				if i > 0 && increment == 0 {
+					err = CorruptedTrieError{offset, "postings not increasing"}
+					return
+				}
+				posting += increment
+			}
+			frequency := -1
+			if v.features&FeatureFrequencies != 0 {
+				frequency, offset, err = v.readInt(offset, postingsEnd,
+					"frequency")
+				if err != nil {
+					return
+				}
+				if frequency == 0 {
+					err = CorruptedTrieError{offset, "invalid frequency"}
+					return
+				}
+				occurrences -= frequency
+			}
+			if v.features&FeaturePositions != 0 {
+				offset, err = v.verifyPositions(offset, postingsEnd, frequency)
+				if err != nil {
+					return
+				}
+			}
+		}
+		if occurrences < 0 {
+			err = CorruptedTrieError{offset, "frequencies above occurrences"}
+			return
+		}
+		if offset != postingsEnd {
+			err = CorruptedTrieError{offset, "unexpected size of postings"}
+			return
+		}
+	}
+
+	// Verifies edges and sub-nodes:
+	if numEdges > 0 {
+		if v.features&FeatureSubtreePostings != 0 {
+			offset, err = v.verifySubtreePostings(offset, limit)
+			if err != nil {
+				return
+			}
+		}
+
+		var size int
+		size, offset, err = v.readInt(offset, limit, "size of edges")
+		if err != nil {
+			return
+		}
+		edgesEnd := offset + size
+		if edgesEnd > limit {
+			err = CorruptedTrieError{offset, "edges out of bounds"}
+			return
+		}
+
+		childOffset := edgesEnd
+		rune_ := 0
+		for i := 0; i < numEdges; i++ {
+			var increment, childSize int
+			increment, offset, err = v.readInt(offset, edgesEnd, "edge rune")
+			if err != nil {
+				return
+			}
+			if increment == 0 || rune_+increment > unicode.MaxRune {
+				err = CorruptedTrieError{offset, "edges not increasing"}
+				return
+			}
+			rune_ += increment
+
+			childSize, offset, err = v.readInt(offset, edgesEnd, "node size")
+			if err != nil {
+				return
+			}
+			if v.features&FeatureRadixEdges != 0 {
+				offset, err = v.verifySuffix(offset, edgesEnd)
+				if err != nil {
+					return
+				}
+			}
+			childEnd := childOffset + childSize
+			if childSize == 0 || childEnd > limit {
+				err = CorruptedTrieError{offset, "sub-node out of bounds"}
+				return
+			}
+
+			var end_ int
+			end_, err = v.verifyNode(childOffset, childEnd)
+			if err != nil {
+				return
+			}
+			if end_ != childEnd {
+				err = CorruptedTrieError{end_, "unexpected size of sub-node"}
+				return
+			}
+			childOffset = childEnd
+		}
+		if offset != edgesEnd {
+			err = CorruptedTrieError{offset, "unexpected size of edges"}
+			return
+		}
+		offset = childOffset
+	}
+
+	end = offset
+	return
+}
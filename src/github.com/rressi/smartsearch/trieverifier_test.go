@@ -0,0 +1,70 @@
+package smartsearch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTrie_Verify(t *testing.T) {
+
+	validTries := [][]byte{
+		{0, 0},
+		{2, 0, 2, 1, 1},
+		{0, 2, 4, 65, 5, 1, 5, 2, 0, 2, 1, 1, 2, 0, 2, 1, 1},
+		{0, 3, 6, 65, 14, 1, 14, 1, 14, 0, 1, 2, 66, 9, 0, 1, 2, 67, 4, 1, 0,
+			1, 1, 0, 1, 2, 67, 9, 0, 1, 2, 65, 4, 1, 0, 1, 2, 0, 1, 2, 65, 9,
+			0, 1, 2, 66, 4, 1, 0, 1, 3}}
+	for i, source_bytes := range validTries {
+		trie, err := NewTrie(source_bytes)
+		if err != nil {
+			t.Errorf("Cannot create trie[%v]: %v", i, err)
+		} else if err = trie.Verify(); err != nil {
+			t.Errorf("Unexpected failure with trie[%v]: %v", i, err)
+		}
+	}
+
+	invalidTries := [][]byte{
+		{0, 0, 0},       // Trailing bytes
+		{2, 0, 2, 1, 0}, // Duplicated posting
+		{2, 0, 3, 1, 1}, // Postings out of bounds
+		{2, 0, 1, 1, 1}, // Wrong size of postings
+		{0, 2, 4, 66, 5, 0, 5, 2, 0, 2, 1, 1, 2, 0, 2, 1, 1}, // Same rune
+		{0, 2, 4, 65, 5, 1, 6, 2, 0, 2, 1, 1, 2, 0, 2, 1, 1}, // Bad node size
+		{0, 2, 4, 65, 5, 1, 5, 2, 0, 2, 1, 1, 2, 0, 2, 1},    // Truncated
+	}
+	for i, source_bytes := range invalidTries {
+		trie := &Trie{source: newTrieSourceFromBytes(source_bytes)}
+		err := trie.Verify()
+		var corruptedErr CorruptedTrieError
+		if !errors.As(err, &corruptedErr) {
+			t.Errorf("Corruption not detected with trie[%v]: %v", i, err)
+		}
+	}
+}
+
+func TestTrie_VerifyIndex(t *testing.T) {
+
+	builder := NewIndexBuilder()
+	builder.AddDocument(1, "This is a text to test something")
+	builder.AddDocument(2, "This is another text to test something else")
+	builder.AddDocument(3, "Now we would like to add another document")
+
+	buf := new(bytes.Buffer)
+	builder.Dump(buf)
+
+	trie, err := NewTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Cannot create trie: %v", err)
+	} else if err = trie.Verify(); err != nil {
+		t.Errorf("Unexpected failure: %v", err)
+	}
+
+	// Corruption detected by the checksum:
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[len(corrupted)-3] ^= 0x01
+	trie.source = newTrieSourceFromBytes(corrupted)
+	if err = trie.Verify(); !errors.Is(err, ChecksumMismatch) {
+		t.Errorf("ChecksumMismatch was expected: %v", err)
+	}
+}
@@ -22,13 +22,18 @@ func main() {
 	jsonId := flags.String("id", "id", "Json attribute for document ids")
 	jsonContents := flags.String("content", "content",
 		"Json attributes to be indexed, comma separated")
+	scopedFields := flags.Bool("fields", false, "Index each content attribute"+
+		" also as a field, for queries like 'title:vertigo'")
+	jsonLanguage := flags.String("lang", "",
+		"Optional Json attribute with the language of each document")
 	err = flags.Parse(os.Args[1:])
 	if err == flag.ErrHelp {
 		flag.Usage()
 		return
 	}
 
-	runMakeIndex(*inputFile, *outputFile, *jsonId, *jsonContents)
+	runMakeIndex(*inputFile, *outputFile, *jsonId, *jsonContents,
+		*scopedFields, *jsonLanguage)
 }
 
 // Takes as input a file with a stream of JSON documents and generates an index
@@ -43,11 +48,17 @@ func main() {
 // - jsonContents: A list of top level attributes in each document whose
 //                 values need to be indexed. It is ok if a document miss
 //                 some or all of this attributes.
+// - scopedFields: If each one of the attributes has to be indexed also as a
+//                 field (see IndexBuilder.SetScopedFields).
+// - jsonLanguage: Optional attribute with the language of each document, like
+//                 "tr", used to lower-case its content.
 func runMakeIndex(
 	inputFile string,
 	outputFile string,
 	jsonId string,
-	jsonContents string) {
+	jsonContents string,
+	scopedFields bool,
+	jsonLanguage string) {
 
 	// Handles feedback:
 	fmt.Fprint(os.Stderr, "[makeindex]\n")
@@ -55,6 +66,10 @@ func runMakeIndex(
 	fmt.Fprintf(os.Stderr, "output file: %v\n", outputFile)
 	fmt.Fprintf(os.Stderr, "json id: %v\n", jsonId)
 	fmt.Fprintf(os.Stderr, "json contents: %v\n", jsonContents)
+	fmt.Fprintf(os.Stderr, "scoped fields: %v\n", scopedFields)
+	if jsonLanguage != "" {
+		fmt.Fprintf(os.Stderr, "json language: %v\n", jsonLanguage)
+	}
 	var err error
 	defer func() {
 		if err == nil {
@@ -85,6 +100,8 @@ func runMakeIndex(
 	var numLines int
 	builder := smartsearch.NewIndexBuilder()
 	defer builder.Abort() // This protects us from leaking some go-routine
+	builder.SetScopedFields(scopedFields)
+	builder.SetJsonLanguageField(jsonLanguage)
 	jsonContentsSplit := strings.Split(jsonContents, ",")
 	numLines, err = builder.IndexJsonStream(bufInput, jsonId, jsonContentsSplit)
 	if err != nil {
@@ -30,8 +30,12 @@ func main() {
 	jsonId := flags.String("id", "id", "Json attribute for document ids")
 	jsonContents := flags.String("content", "content",
 		"Json attributes to be indexed, comma separated")
+	scopedFields := flags.Bool("fields", false, "Index each content attribute"+
+		" also as a field, for queries like 'title:vertigo'")
 	staticAppFolder := flags.String("app", "", "optionally serves a static web"+
 		" app from this passed folder")
+	nodeCacheSize := flags.Int("cache", 0, "Number of nodes of frequent terms"+
+		" to be cached, 0 to disable the cache")
 	err = flags.Parse(os.Args[1:])
 	if err == flag.ErrHelp {
 		flag.Usage()
@@ -44,6 +48,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Documents file:     %v\n", *documentsFile)
 		fmt.Fprintf(os.Stderr, "Id attribute:       %v\n", *jsonId)
 		fmt.Fprintf(os.Stderr, "Content attributes: %v\n", *jsonContents)
+		fmt.Fprintf(os.Stderr, "Scoped fields:      %v\n", *scopedFields)
 	}
 	if *indexFile != "" {
 		fmt.Fprintf(os.Stderr, "input file:         %v\n", *indexFile)
@@ -53,6 +58,9 @@ func main() {
 	}
 	fmt.Fprintf(os.Stderr, "http host name:     %v\n", *httpHostName)
 	fmt.Fprintf(os.Stderr, "http port:          %v\n", *httpPort)
+	if *nodeCacheSize > 0 {
+		fmt.Fprintf(os.Stderr, "node cache size:    %v\n", *nodeCacheSize)
+	}
 	defer func() {
 		if err == nil {
 			fmt.Fprint(os.Stderr, "Done.\n\n")
@@ -63,7 +71,8 @@ func main() {
 
 	var ctx AppContext
 	if *documentsFile != "" {
-		ctx, err = LoadDocuments(*documentsFile, *jsonId, *jsonContents)
+		ctx, err = LoadDocuments(*documentsFile, *jsonId, *jsonContents,
+			*scopedFields)
 	} else {
 		ctx, err = LoadIndex(*indexFile)
 	}
@@ -74,6 +83,7 @@ func main() {
 	if *staticAppFolder != "" {
 		ctx.staticAppFolder = *staticAppFolder
 	}
+	ctx.index.SetNodeCache(*nodeCacheSize)
 
 	// Executes our service:
 	fmt.Fprint(os.Stderr, "listening...\n")
@@ -101,12 +111,14 @@ type AppContext struct {
 // - jsonContents: A list of top level attributes in each document whose
 //                 values need to be indexed. It is ok if a document miss
 //                 some or all of this attributes.
+// - scopedFields: If each one of the attributes has to be indexed also as a
+//                 field (see IndexBuilder.SetScopedFields).
 //
 // It returns:
 // - ctx: A context it creates for this application.
 // - err: An error message in case of failure.
-func LoadDocuments(documentFile string, jsonId string, jsonContents string) (
-	ctx AppContext, err error) {
+func LoadDocuments(documentFile string, jsonId string, jsonContents string,
+	scopedFields bool) (ctx AppContext, err error) {
 
 	defer func() {
 		if err != nil {
@@ -134,6 +146,7 @@ func LoadDocuments(documentFile string, jsonId string, jsonContents string) (
 	// Loads and indexes all the documents:
 	builder := smartsearch.NewIndexBuilder()
 	defer builder.Abort() // This protects us from leaking some go-routine
+	builder.SetScopedFields(scopedFields)
 	jsonContentsSplit := strings.Split(jsonContents, ",")
 	ctx.docs, err = builder.LoadAndIndexJsonStream(bufInput, jsonId,
 		jsonContentsSplit)
@@ -165,20 +178,13 @@ func LoadIndex(inputFile string) (ctx AppContext, err error) {
 		}
 	}()
 
-	// Selects the input stream:
-	var input io.ReadCloser
+	// Loads the index from the standard input, or maps it from the file so
+	// that big indices are usable immediately:
 	if inputFile == "-" {
-		input = os.Stdin
+		ctx.index, ctx.rawIndex, err = smartsearch.NewIndex(os.Stdin)
 	} else {
-		input, err = os.Open(inputFile)
-		defer input.Close()
-		if err != nil {
-			return
-		}
+		ctx.index, ctx.rawIndex, err = smartsearch.NewIndexFromFile(inputFile)
 	}
-
-	// Loads the index from the input stream:
-	ctx.index, ctx.rawIndex, err = smartsearch.NewIndex(input)
 	return
 }
 
@@ -210,7 +216,9 @@ func RunSearchService(ctx AppContext, httpHostName string, httpPort uint) (
 
 	// Creates the web server and listen for incoming requests:
 	http.HandleFunc("/search", smartsearch.ServeSearch(ctx.index))
+	http.HandleFunc("/suggest", smartsearch.ServeSuggest(ctx.index))
 	http.HandleFunc("/rawIndex", smartsearch.ServeRawBytes(ctx.rawIndex))
+	http.HandleFunc("/cacheStats", smartsearch.ServeNodeCacheStats(ctx.index))
 	if ctx.docs != nil {
 		docsHandler := smartsearch.ServeDocuments(ctx.docs)
 		http.Handle("/docs", docsHandler)